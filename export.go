@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/db"
+	"github.com/duo/octopus/internal/export"
+	"github.com/duo/octopus/internal/manager"
+	"github.com/duo/octopus/internal/master"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// export messages of slave chat, e.g. octopus export --limb qq;10000;20000 --from 2024-01-01 --out backup
+func exportChat(config *common.Configure, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	limb := flags.String("limb", "", "slave chat to export (vendor;uid;chatid)")
+	from := flags.String("from", "", "start date (YYYY-MM-DD)")
+	to := flags.String("to", "", "end date, inclusive (YYYY-MM-DD)")
+	out := flags.String("out", ".", "output directory")
+	media := flags.Bool("media", true, "download media from Telegram")
+	cache := flags.String("cache", "", "local media cache directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if _, err := common.LimbFromString(*limb); err != nil {
+		return errors.New("invalid or missing --limb")
+	}
+	start, end, err := export.ParseRange(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.Open(config.Database.Driver, databaseDSN(config, config.Database.Driver))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	manager.Init(manager.NewStore(config.Database.Driver, conn))
+
+	opts := &export.Options{
+		SlaveLimb: *limb,
+		From:      start,
+		To:        end,
+		CacheDir:  *cache,
+	}
+	if chat, err := manager.GetChat(*limb); err == nil && chat != nil {
+		opts.Title = chat.Title
+	}
+	if *media {
+		if opts.Fetch, err = master.NewFetcher(config); err != nil {
+			return err
+		}
+	}
+	if *cache != "" {
+		if err := os.MkdirAll(*cache, 0o755); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+
+	name := filepath.Join(*out, strings.NewReplacer(";", "_", "/", "_").Replace(*limb))
+	htmlFile, err := os.Create(name + ".html")
+	if err != nil {
+		return err
+	}
+	defer htmlFile.Close()
+	jsonFile, err := os.Create(name + ".json")
+	if err != nil {
+		return err
+	}
+	defer jsonFile.Close()
+
+	result, err := export.Export(opts, htmlFile, jsonFile)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Exported %d messages (%d media, %d missing) to %s.html and %s.json",
+		result.Messages, result.Media, result.Missing, name, name)
+	return nil
+}
@@ -1,21 +1,85 @@
 package common
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 const (
-	defaultPageSize    = 10
-	defaultSendTimeout = 3 * time.Minute
+	defaultPageSize     = 10
+	defaultSendTimeout  = 3 * time.Minute
+	defaultMemberTTL    = 30 * time.Minute
+	defaultSyncInterval = time.Hour
+	defaultDrainTimeout = 30 * time.Second
+	defaultDatabase     = "sqlite"
+	defaultDatabasePath = "master.db"
+
+	defaultPurgeInterval  = time.Hour
+	defaultPurgeBatchSize = 1000
+	defaultVacuumInterval = 24 * time.Hour
+
+	defaultWebhookRetries  = 5
+	defaultWebhookTimeout  = 10 * time.Second
+	defaultWebhookBlobTTL  = 24 * time.Hour
+	defaultWebhookLogTTL   = 7 * 24 * time.Hour
+	defaultWebhookBlobPath = "webhook_blobs"
+)
+
+// chat types archive bindings apply to
+const (
+	ArchiveAll     = ""
+	ArchivePrivate = "private"
+	ArchiveGroup   = "group"
 )
 
 type ArchiveChat struct {
-	Vendor string `yaml:"vendor"`
-	UID    string `yaml:"uid"`
-	ChatID int64  `yaml:"chat_id"`
+	Vendor   string `yaml:"vendor"`
+	UID      string `yaml:"uid"`
+	ChatType string `yaml:"chat_type"`
+	ChatID   int64  `yaml:"chat_id"`
+}
+
+const (
+	RetentionDelete    = "delete"
+	RetentionAnonymize = "anonymize"
+)
+
+const (
+	VisibilityShow = "show"
+	VisibilityHide = "hide"
+)
+
+// QuietHours silence notifications daily between start and end (HH:MM) in time zone
+type QuietHours struct {
+	Start      string   `yaml:"start"`
+	End        string   `yaml:"end"`
+	TimeZone   string   `yaml:"time_zone"`
+	Exceptions []string `yaml:"exceptions"`
+}
+
+type SatoriEndpoint struct {
+	Endpoint string `yaml:"endpoint"`
+	Token    string `yaml:"token"`
+	Vendor   string `yaml:"vendor"`
+	SelfID   string `yaml:"self_id"`
+}
+
+type WebhookEndpoint struct {
+	Name       string   `yaml:"name"`
+	URL        string   `yaml:"url"`
+	Secret     string   `yaml:"secret"`
+	Directions []string `yaml:"directions"`
+	Vendors    []string `yaml:"vendors"`
+	Chats      []string `yaml:"chats"`
+	Events     []string `yaml:"events"`
 }
 
 type Configure struct {
@@ -28,21 +92,69 @@ type Configure struct {
 		PageSize  int           `yaml:"page_size"`
 		Archive   []ArchiveChat `yaml:"archive"`
 
+		Notice map[string]string `yaml:"notice"`
+
+		QuietHours QuietHours `yaml:"quiet_hours"`
+
 		Telegraph struct {
-			Enable bool     `ymal:"enable"`
+			Enable bool     `yaml:"enable"`
 			Proxy  string   `yaml:"proxy"`
 			Tokens []string `yaml:"tokens"`
 		} `yaml:"telegraph"`
 	} `yaml:"master"`
 
 	Service struct {
-		Addr        string        `yaml:"addr"`
-		Secret      string        `yaml:"secret"`
-		SendTiemout time.Duration `yaml:"send_timeout"`
+		Addr         string        `yaml:"addr"`
+		Secret       string        `yaml:"secret"`
+		SendTiemout  time.Duration `yaml:"send_timeout"`
+		MemberTTL    time.Duration `yaml:"member_ttl"`
+		SyncInterval time.Duration `yaml:"sync_interval"`
+		DrainTimeout time.Duration `yaml:"drain_timeout"`
+		MetricsToken string        `yaml:"metrics_token"`
+		APIToken     string        `yaml:"api_token"`
+
+		RequiredVendors []string `yaml:"required_vendors"`
+
+		EventBuffer struct {
+			MemoryMB int  `yaml:"memory_mb"`
+			Spill    bool `yaml:"spill"`
+		} `yaml:"event_buffer"`
+
+		UploadFolders map[string]string `yaml:"upload_folders"`
+
+		Satori []SatoriEndpoint `yaml:"satori"`
 	} `yaml:"service"`
 
+	Database struct {
+		Driver string `yaml:"driver"`
+		Path   string `yaml:"path"`
+		DSN    string `yaml:"dsn"`
+
+		Retention struct {
+			MaxAge         time.Duration            `yaml:"max_age"`
+			Mode           string                   `yaml:"mode"`
+			Chats          map[string]time.Duration `yaml:"chats"`
+			PurgeInterval  time.Duration            `yaml:"purge_interval"`
+			BatchSize      int                      `yaml:"batch_size"`
+			VacuumInterval time.Duration            `yaml:"vacuum_interval"`
+		} `yaml:"retention"`
+	} `yaml:"database"`
+
+	Webhook struct {
+		PublicURL  string            `yaml:"public_url"`
+		BlobPath   string            `yaml:"blob_path"`
+		BlobTTL    time.Duration     `yaml:"blob_ttl"`
+		LogTTL     time.Duration     `yaml:"log_ttl"`
+		MaxRetries int               `yaml:"max_retries"`
+		Timeout    time.Duration     `yaml:"timeout"`
+		Endpoints  []WebhookEndpoint `yaml:"endpoints"`
+	} `yaml:"webhook"`
+
 	Log struct {
-		Level string `yaml:"level"`
+		Level       string `yaml:"level"`
+		Format      string `yaml:"format"`
+		MaskContent bool   `yaml:"mask_content"`
+		MaskIDs     bool   `yaml:"mask_ids"`
 	} `yaml:"log"`
 }
 
@@ -56,9 +168,51 @@ func LoadConfig(path string) (*Configure, error) {
 	config.Master.APIURL = "https://api.telegram.org"
 	config.Master.PageSize = defaultPageSize
 	config.Service.SendTiemout = defaultSendTimeout
-	if err := yaml.Unmarshal(file, &config); err != nil {
+	config.Service.MemberTTL = defaultMemberTTL
+	config.Service.SyncInterval = defaultSyncInterval
+	config.Service.DrainTimeout = defaultDrainTimeout
+	config.Service.EventBuffer.Spill = true
+	config.Database.Driver = defaultDatabase
+	config.Database.Path = defaultDatabasePath
+	config.Database.Retention.Mode = RetentionDelete
+	config.Database.Retention.PurgeInterval = defaultPurgeInterval
+	config.Database.Retention.BatchSize = defaultPurgeBatchSize
+	config.Database.Retention.VacuumInterval = defaultVacuumInterval
+	config.Webhook.BlobPath = defaultWebhookBlobPath
+	config.Webhook.BlobTTL = defaultWebhookBlobTTL
+	config.Webhook.LogTTL = defaultWebhookLogTTL
+	config.Webhook.MaxRetries = defaultWebhookRetries
+	config.Webhook.Timeout = defaultWebhookTimeout
+	config.Log.Format = LogFormatText
+
+	// unknown keys are mostly typos, reject instead of ignoring
+	decoder := yaml.NewDecoder(bytes.NewReader(file))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			err = readableTypeError(typeErr)
+		}
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	if err := config.applyEnv(); err != nil {
 		return nil, err
 	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s:\n%w", path, err)
+	}
 
 	return config, nil
 }
+
+var unknownFieldPattern = regexp.MustCompile(`field (\S+) not found in type .*`)
+
+// yaml names anonymous config structs in full, keep only the field
+func readableTypeError(err *yaml.TypeError) error {
+	lines := make([]string, 0, len(err.Errors))
+	for _, line := range err.Errors {
+		lines = append(lines, unknownFieldPattern.ReplaceAllString(line, "unknown field $1"))
+	}
+	return errors.New(strings.Join(lines, "\n"))
+}
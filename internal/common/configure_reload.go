@@ -0,0 +1,87 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+)
+
+// config fields applied at runtime on reload, everything else needs restart
+var reloadableFields = []string{
+	"master.page_size",
+	"master.archive",
+	"master.notice",
+	"master.quiet_hours",
+	"master.telegraph",
+	"database.retention.max_age",
+	"database.retention.mode",
+	"database.retention.chats",
+	"database.retention.batch_size",
+	"log",
+}
+
+// ReloadConfig load config file again, return current config with reloadable fields replaced,
+// along with the fields applied and the changed fields ignored until restart
+func ReloadConfig(path string, current *Configure) (config *Configure, applied []string, restart []string, err error) {
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// values of current config are shared, so fields are replaced as a whole and never modified
+	next := *current
+	for _, field := range reloadableFields {
+		configField(&next, field).Set(configField(loaded, field))
+	}
+
+	applied = diffConfig(reflect.ValueOf(*current), reflect.ValueOf(next), "")
+	restart = diffConfig(reflect.ValueOf(next), reflect.ValueOf(*loaded), "")
+
+	return &next, applied, restart, nil
+}
+
+// field of config by dotted yaml path
+func configField(config *Configure, path string) reflect.Value {
+	v := reflect.ValueOf(config).Elem()
+	for _, name := range strings.Split(path, ".") {
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if yamlName(v.Type().Field(i)) == name {
+				v = v.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			panic("unknown config field " + path)
+		}
+	}
+	return v
+}
+
+// yaml paths of changed fields, values are left out as they may be secrets
+func diffConfig(a, b reflect.Value, prefix string) []string {
+	if a.Kind() != reflect.Struct {
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return nil
+		}
+		return []string{prefix}
+	}
+
+	var changed []string
+	for i := 0; i < a.NumField(); i++ {
+		name := yamlName(a.Type().Field(i))
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		changed = append(changed, diffConfig(a.Field(i), b.Field(i), name)...)
+	}
+	return changed
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
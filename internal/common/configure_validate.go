@@ -0,0 +1,203 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// environment variables override secrets of config file
+var envOverrides = []struct {
+	name  string
+	field func(c *Configure) *string
+}{
+	{"OCTOPUS_MASTER_TOKEN", func(c *Configure) *string { return &c.Master.Token }},
+	{"OCTOPUS_MASTER_PROXY", func(c *Configure) *string { return &c.Master.Proxy }},
+	{"OCTOPUS_SERVICE_SECRET", func(c *Configure) *string { return &c.Service.Secret }},
+	{"OCTOPUS_SERVICE_METRICS_TOKEN", func(c *Configure) *string { return &c.Service.MetricsToken }},
+	{"OCTOPUS_SERVICE_API_TOKEN", func(c *Configure) *string { return &c.Service.APIToken }},
+	{"OCTOPUS_DATABASE_DSN", func(c *Configure) *string { return &c.Database.DSN }},
+}
+
+func (c *Configure) applyEnv() error {
+	for _, env := range envOverrides {
+		if value, ok := os.LookupEnv(env.name); ok && value != "" {
+			*env.field(c) = value
+		}
+	}
+
+	if value := os.Getenv("OCTOPUS_MASTER_ADMIN_ID"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid OCTOPUS_MASTER_ADMIN_ID %q: %w", value, err)
+		}
+		c.Master.AdminID = id
+	}
+
+	return nil
+}
+
+// Validate check required fields and value ranges, all problems are reported together
+func (c *Configure) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+	checkURL := func(field, value string, required bool) {
+		if value == "" {
+			if required {
+				fail(field, "required")
+			}
+			return
+		}
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			fail(field, "invalid url %q", value)
+		}
+	}
+
+	if c.Master.AdminID == 0 {
+		fail("master.admin_id", "required, messages from anyone else are ignored")
+	}
+	if c.Master.Token == "" {
+		fail("master.token", "required")
+	}
+	checkURL("master.api_url", c.Master.APIURL, true)
+	checkURL("master.proxy", c.Master.Proxy, false)
+	if c.Master.PageSize <= 0 {
+		fail("master.page_size", "must be positive")
+	}
+	archived := make(map[string]bool)
+	for i, archive := range c.Master.Archive {
+		field := fmt.Sprintf("master.archive[%d]", i)
+		if archive.Vendor == "" || archive.UID == "" {
+			fail(field, "vendor and uid are required")
+		}
+		if archive.ChatID == 0 {
+			fail(field+".chat_id", "required")
+		}
+		if !slices.Contains([]string{ArchiveAll, ArchivePrivate, ArchiveGroup}, archive.ChatType) {
+			fail(field+".chat_type", "must be %s or %s if set, got %q", ArchivePrivate, ArchiveGroup, archive.ChatType)
+		}
+		key := Vendor{Type: archive.Vendor, UID: archive.UID}.String() + " " + archive.ChatType
+		if archived[key] {
+			fail(field, "duplicated vendor and chat type %s", key)
+		}
+		archived[key] = true
+	}
+	for notice, visibility := range c.Master.Notice {
+		if visibility != VisibilityShow && visibility != VisibilityHide {
+			fail("master.notice."+notice, "must be %s or %s, got %q", VisibilityShow, VisibilityHide, visibility)
+		}
+	}
+	if quiet := c.Master.QuietHours; quiet.Start != "" || quiet.End != "" {
+		if _, err := time.Parse("15:04", quiet.Start); err != nil {
+			fail("master.quiet_hours.start", "must be HH:MM, got %q", quiet.Start)
+		}
+		if _, err := time.Parse("15:04", quiet.End); err != nil {
+			fail("master.quiet_hours.end", "must be HH:MM, got %q", quiet.End)
+		}
+		if _, err := time.LoadLocation(quiet.TimeZone); err != nil {
+			fail("master.quiet_hours.time_zone", "%v", err)
+		}
+	}
+	if c.Master.Telegraph.Enable && len(c.Master.Telegraph.Tokens) == 0 {
+		fail("master.telegraph.tokens", "required when telegraph is enabled")
+	}
+	checkURL("master.telegraph.proxy", c.Master.Telegraph.Proxy, false)
+
+	if c.Service.Addr == "" {
+		fail("service.addr", "required")
+	}
+	if c.Service.Secret == "" {
+		fail("service.secret", "required, limbs authenticate with it")
+	}
+	if c.Service.SendTiemout <= 0 {
+		fail("service.send_timeout", "must be positive")
+	}
+	if c.Service.MemberTTL < 0 {
+		fail("service.member_ttl", "must not be negative")
+	}
+	if c.Service.SyncInterval < 0 {
+		fail("service.sync_interval", "must not be negative")
+	}
+	if c.Service.DrainTimeout < 0 {
+		fail("service.drain_timeout", "must not be negative")
+	}
+	if c.Service.EventBuffer.MemoryMB < 0 {
+		fail("service.event_buffer.memory_mb", "must not be negative")
+	}
+	for i, satori := range c.Service.Satori {
+		checkURL(fmt.Sprintf("service.satori[%d].endpoint", i), satori.Endpoint, true)
+	}
+
+	switch c.Database.Driver {
+	case "sqlite":
+		if c.Database.Path == "" {
+			fail("database.path", "required for sqlite")
+		}
+	case "postgres":
+		if c.Database.DSN == "" {
+			fail("database.dsn", "required for postgres")
+		}
+	default:
+		fail("database.driver", "must be sqlite or postgres, got %q", c.Database.Driver)
+	}
+	retention := c.Database.Retention
+	if retention.Mode != RetentionDelete && retention.Mode != RetentionAnonymize {
+		fail("database.retention.mode", "must be %s or %s, got %q", RetentionDelete, RetentionAnonymize, retention.Mode)
+	}
+	if retention.MaxAge < 0 {
+		fail("database.retention.max_age", "must not be negative")
+	}
+	for limb, maxAge := range retention.Chats {
+		if maxAge < 0 {
+			fail("database.retention.chats."+limb, "must not be negative")
+		}
+	}
+	if retention.BatchSize <= 0 {
+		fail("database.retention.batch_size", "must be positive")
+	}
+	if retention.PurgeInterval < 0 {
+		fail("database.retention.purge_interval", "must not be negative")
+	}
+	if retention.VacuumInterval < 0 {
+		fail("database.retention.vacuum_interval", "must not be negative")
+	}
+
+	checkURL("webhook.public_url", c.Webhook.PublicURL, false)
+	if c.Webhook.MaxRetries < 0 {
+		fail("webhook.max_retries", "must not be negative")
+	}
+	if c.Webhook.Timeout <= 0 {
+		fail("webhook.timeout", "must be positive")
+	}
+	if len(c.Webhook.Endpoints) > 0 && c.Webhook.BlobPath == "" {
+		fail("webhook.blob_path", "required")
+	}
+	for i, endpoint := range c.Webhook.Endpoints {
+		field := fmt.Sprintf("webhook.endpoints[%d]", i)
+		checkURL(field+".url", endpoint.URL, true)
+		for _, direction := range endpoint.Directions {
+			if !slices.Contains([]string{"in", "out"}, direction) {
+				fail(field+".directions", "must be in or out, got %q", direction)
+			}
+		}
+	}
+
+	if c.Log.Level != "" {
+		if _, err := log.ParseLevel(c.Log.Level); err != nil {
+			fail("log.level", "%v", err)
+		}
+	}
+	if c.Log.Format != LogFormatText && c.Log.Format != LogFormatJSON {
+		fail("log.format", "must be %s or %s, got %q", LogFormatText, LogFormatJSON, c.Log.Format)
+	}
+
+	return errors.Join(errs...)
+}
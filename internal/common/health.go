@@ -0,0 +1,11 @@
+package common
+
+import "context"
+
+// HealthCheck reports an error when a component is unhealthy, detail is shown either way
+type HealthCheck struct {
+	Name string
+	// liveness checks fail /healthz and /readyz, others fail /readyz only
+	Liveness bool
+	Check    func(ctx context.Context) (detail string, err error)
+}
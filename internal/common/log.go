@@ -0,0 +1,233 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Redaction controls how events are written to logs, blobs are always summarised
+type Redaction struct {
+	MaskContent bool
+	MaskIDs     bool
+}
+
+var redaction atomic.Pointer[Redaction]
+
+func SetRedaction(r Redaction) {
+	redaction.Store(&r)
+}
+
+func currentRedaction() Redaction {
+	if r := redaction.Load(); r != nil {
+		return *r
+	}
+	return Redaction{}
+}
+
+// NewTraceID random correlation id of an event
+func NewTraceID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Trace return correlation id of event, assign one if missing
+func (o *OctopusEvent) Trace() string {
+	if o.TraceID == "" {
+		o.TraceID = NewTraceID()
+	}
+	return o.TraceID
+}
+
+// EventLog logger with correlation id and redacted identity of event
+func EventLog(event *OctopusEvent) *log.Entry {
+	r := currentRedaction()
+	return log.WithFields(log.Fields{
+		"trace_id": event.Trace(),
+		"vendor":   event.Vendor.Type + VENDOR_SEP + r.id(event.Vendor.UID),
+		"chat":     r.id(event.Chat.ID),
+		"type":     event.Type.String(),
+	})
+}
+
+// String redacted summary of event for logs
+func (o *OctopusEvent) String() string {
+	data, err := json.Marshal(currentRedaction().event(o))
+	if err != nil {
+		return fmt.Sprintf("OctopusEvent{trace_id: %s, type: %s}", o.TraceID, o.Type)
+	}
+	return string(data)
+}
+
+// String summary of blob without binary
+func (b *BlobData) String() string {
+	if b == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("BlobData{name: %s, mime: %s, size: %d}", b.Name, b.Mime, len(b.Binary))
+}
+
+type blobSummary struct {
+	Name string `json:"name,omitempty"`
+	Mime string `json:"mime,omitempty"`
+	Size int    `json:"size"`
+}
+
+type redactedEvent struct {
+	TraceID   string     `json:"trace_id,omitempty"`
+	Vendor    Vendor     `json:"vendor"`
+	ID        string     `json:"id,omitempty"`
+	ThreadID  string     `json:"thread_id,omitempty"`
+	Timestamp int64      `json:"timestamp,omitempty"`
+	From      User       `json:"from"`
+	Chat      Chat       `json:"chat"`
+	Type      string     `json:"type"`
+	Content   string     `json:"content,omitempty"`
+	Reply     *ReplyInfo `json:"reply,omitempty"`
+	Data      any        `json:"data,omitempty"`
+}
+
+func (r Redaction) event(o *OctopusEvent) *redactedEvent {
+	if o == nil {
+		return nil
+	}
+
+	e := &redactedEvent{
+		TraceID:   o.TraceID,
+		Vendor:    Vendor{Type: o.Vendor.Type, UID: r.id(o.Vendor.UID)},
+		ID:        r.id(o.ID),
+		ThreadID:  r.id(o.ThreadID),
+		Timestamp: o.Timestamp,
+		From:      r.user(o.From),
+		Chat:      Chat{ID: r.id(o.Chat.ID), Type: o.Chat.Type, Title: r.content(o.Chat.Title)},
+		Type:      o.Type.String(),
+		Content:   r.content(o.Content),
+		Data:      r.data(o.Data),
+	}
+	if o.Reply != nil {
+		e.Reply = &ReplyInfo{
+			ID:        r.id(o.Reply.ID),
+			Timestamp: o.Reply.Timestamp,
+			Sender:    r.id(o.Reply.Sender),
+			Content:   r.content(o.Reply.Content),
+		}
+	}
+
+	return e
+}
+
+func (r Redaction) data(data any) any {
+	switch v := data.(type) {
+	case *BlobData:
+		return summarizeBlob(v)
+	case []*BlobData:
+		blobs := make([]*blobSummary, 0, len(v))
+		for _, blob := range v {
+			blobs = append(blobs, summarizeBlob(blob))
+		}
+		return blobs
+	case *AppData:
+		if v == nil {
+			return nil
+		}
+		app := map[string]any{
+			"title":  r.content(v.Title),
+			"desc":   r.content(v.Description),
+			"source": v.Source,
+			"url":    r.content(v.URL),
+			"raw":    r.content(v.Content),
+		}
+		if len(v.Blobs) > 0 {
+			blobs := make(map[string]*blobSummary, len(v.Blobs))
+			for key, blob := range v.Blobs {
+				blobs[key] = summarizeBlob(blob)
+			}
+			app["blobs"] = blobs
+		}
+		return app
+	case *ForwardData:
+		if v == nil {
+			return nil
+		}
+		messages := make([]*redactedEvent, 0, len(v.Messages))
+		for _, message := range v.Messages {
+			messages = append(messages, r.event(message))
+		}
+		return map[string]any{"title": r.content(v.Title), "messages": messages}
+	case *LocationData:
+		if v == nil || !r.MaskContent {
+			return v
+		}
+		return map[string]any{"name": r.content(v.Name), "address": r.content(v.Address)}
+	case *NoticeData:
+		if v == nil || !r.MaskIDs {
+			return v
+		}
+		notice := *v
+		if v.Target != nil {
+			target := r.user(*v.Target)
+			notice.Target = &target
+		}
+		if v.Operator != nil {
+			operator := r.user(*v.Operator)
+			notice.Operator = &operator
+		}
+		return &notice
+	case *RequestData:
+		if v == nil {
+			return nil
+		}
+		request := *v
+		request.UserID = r.id(v.UserID)
+		request.GroupID = r.id(v.GroupID)
+		request.Flag = r.id(v.Flag)
+		request.Comment = r.content(v.Comment)
+		return &request
+	default:
+		return data
+	}
+}
+
+// RedactID id masked by current log settings
+func RedactID(s string) string {
+	return currentRedaction().id(s)
+}
+
+func (r Redaction) user(u User) User {
+	return User{ID: r.id(u.ID), Username: r.content(u.Username), Remark: r.content(u.Remark)}
+}
+
+// masked id keeps a short hash so log lines of the same id can be matched
+func (r Redaction) id(s string) string {
+	if !r.MaskIDs || s == "" {
+		return s
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "#" + hex.EncodeToString(sum[:4])
+}
+
+func (r Redaction) content(s string) string {
+	if !r.MaskContent || s == "" {
+		return s
+	}
+	return fmt.Sprintf("[%d chars]", utf8.RuneCountInString(s))
+}
+
+func summarizeBlob(b *BlobData) *blobSummary {
+	if b == nil {
+		return nil
+	}
+	return &blobSummary{Name: b.Name, Mime: b.Mime, Size: len(b.Binary)}
+}
@@ -1,63 +1,375 @@
 package common
 
-// unbounded channel
+import (
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// rough memory of an event besides blobs and content
+	eventOverhead = 512
+
+	spillBatchSize     = 64
+	spillRetryInterval = time.Second
+
+	// capacity of in channel when bounded, events in it are not counted in memory.
+	// out is unbuffered then, so spilled events leave disk only once consumer takes them
+	boundedChanCapacity = 1
+)
+
+// SpillQueue keeps events over memory budget on disk, in order
+type SpillQueue interface {
+	Push(event *OctopusEvent) error
+	// return oldest events not returned yet, they stay on disk until acknowledged
+	Peek(limit int) ([]*OctopusEvent, error)
+	// remove oldest count events returned by Peek
+	Ack(count int) error
+	Len() (int, error)
+}
+
+// unbounded channel, or bounded by memory budget with disk spill or backpressure
 type MessageChan struct {
-	in     chan<- *OctopusEvent
-	out    <-chan *OctopusEvent
-	buffer []*OctopusEvent
+	in       chan *OctopusEvent
+	out      chan *OctopusEvent
+	buffer   []*OctopusEvent
+	buffered atomic.Int64
+	consumed atomic.Int64
+
+	budget     int64
+	memory     atomic.Int64
+	spillQueue SpillQueue
+	spilled    atomic.Int64 // events on disk not loaded yet
+	spillTotal atomic.Int64
+
+	// events sent after sealed, kept apart so spill order follows send order
+	held []*OctopusEvent
+
+	// events behind those on disk, failed to spill or with callback, retried before receiving more
+	pending []*OctopusEvent
+	// buffered events with callback, which can't be spilled
+	unspillable int
+	// events at front of buffer loaded from disk, and those taken but failed to acknowledge
+	unacked int
+	acks    int
+
+	seal  chan func(*OctopusEvent)
+	flush chan chan int
+	exit  chan struct{}
 }
 
 func NewMessageChan(capacity int) *MessageChan {
-	in := make(chan *OctopusEvent, capacity)
-	out := make(chan *OctopusEvent, capacity)
+	return NewBoundedMessageChan(capacity, 0, nil)
+}
+
+// NewBoundedMessageChan buffer up to budget bytes of events, unbounded if budget is zero;
+// events over budget go to spill queue, or block senders without one.
+// Events with callback never spill, senders are blocked while they are over budget or behind spilled events
+func NewBoundedMessageChan(capacity int, budget int64, spillQueue SpillQueue) *MessageChan {
+	inCapacity, outCapacity := capacity, capacity
+	if budget > 0 {
+		inCapacity, outCapacity = boundedChanCapacity, 0
+	}
 
 	ch := &MessageChan{
-		in:     in,
-		out:    out,
-		buffer: make([]*OctopusEvent, 0, capacity),
+		in:         make(chan *OctopusEvent, inCapacity),
+		out:        make(chan *OctopusEvent, outCapacity),
+		buffer:     make([]*OctopusEvent, 0, capacity),
+		budget:     budget,
+		spillQueue: spillQueue,
+		seal:       make(chan func(*OctopusEvent)),
+		flush:      make(chan chan int),
+		exit:       make(chan struct{}),
+	}
+
+	// events spilled before restart are delivered first
+	if spillQueue != nil {
+		if count, err := spillQueue.Len(); err != nil {
+			log.Warnf("Failed to count spilled events: %v", err)
+		} else {
+			ch.spilled.Store(int64(count))
+		}
 	}
 
-	go func() {
-		defer close(out)
+	go ch.run(capacity)
 
-	loop:
-		for {
-			val, ok := <-in
-			if !ok {
-				break loop
+	return ch
+}
+
+func (ch *MessageChan) run(capacity int) {
+	defer close(ch.exit)
+	defer close(ch.out)
+
+	// events sent after sealed go to spill instead of consumers, directly once flushed
+	var spill func(*OctopusEvent)
+	sealed, flushed := false, false
+
+	var retry <-chan time.Time
+
+	for {
+		if len(ch.pending) > 0 && retry == nil {
+			if err := ch.spillPending(); err != nil {
+				log.Warnf("Failed to spill event, retry in %v: %v", spillRetryInterval, err)
+				retry = time.After(spillRetryInterval)
+			}
+		}
+		if len(ch.buffer) == 0 && ch.spilled.Load() > 0 && retry == nil {
+			if err := ch.unspill(); err != nil {
+				log.Warnf("Failed to load spilled events: %v", err)
+				retry = time.After(spillRetryInterval)
 			}
+		}
 
-			select {
-			case out <- val:
+		// size is taken before consumer gets the event and filters change it
+		var out chan *OctopusEvent
+		var next *OctopusEvent
+		var nextSize int64
+		if len(ch.buffer) > 0 {
+			out = ch.out
+			next = ch.buffer[0]
+			nextSize = eventSize(next)
+		}
+
+		// stop receiving when over budget and nowhere to spill, or until disk is back
+		in := ch.in
+		overBudget := ch.budget > 0 && ch.memory.Load() >= ch.budget &&
+			(ch.spillQueue == nil || ch.unspillable > 0)
+		if (overBudget || len(ch.pending) > 0) && !sealed {
+			in = nil
+		}
+
+		select {
+		case val, ok := <-in:
+			if !ok {
+				for _, val := range append(ch.buffer, ch.pending...) {
+					ch.out <- val
+					ch.consumed.Add(1)
+					ch.buffered.Add(-1)
+					ch.taken()
+				}
+				return
+			}
+			if sealed && flushed {
+				spill(val)
+				continue
+			} else if sealed {
+				ch.held = append(ch.held, val)
 				continue
-			default:
 			}
 
-			ch.buffer = append(ch.buffer, val)
-			for len(ch.buffer) > 0 {
+			// skip buffer when consumer keeps up
+			if len(ch.buffer) == 0 && ch.spilled.Load() == 0 {
 				select {
-				case val, ok := <-in:
-					if !ok {
-						break loop
-					}
-					ch.buffer = append(ch.buffer, val)
-
-				case out <- ch.buffer[0]:
-					ch.buffer = ch.buffer[1:]
-					if len(ch.buffer) == 0 {
-						ch.buffer = make([]*OctopusEvent, 0, capacity)
-					}
+				case ch.out <- val:
+					ch.consumed.Add(1)
+					continue
+				default:
 				}
 			}
-		}
 
-		for len(ch.buffer) > 0 {
-			out <- ch.buffer[0]
+			size := eventSize(val)
+			if ch.spillQueue != nil && ch.budget > 0 && val.Callback == nil &&
+				(ch.spilled.Load() > 0 || ch.memory.Load()+size > ch.budget) {
+				ch.spillEvent(val)
+				continue
+			}
+			// callback event can't jump spilled ones, wait until they left disk
+			if ch.spilled.Load() > 0 {
+				ch.pending = append(ch.pending, val)
+				ch.buffered.Add(1)
+				continue
+			}
+			ch.push(val, size)
+
+		case out <- next:
 			ch.buffer = ch.buffer[1:]
+			ch.buffered.Add(-1)
+			ch.consumed.Add(1)
+			ch.memory.Add(-nextSize)
+			if next.Callback != nil {
+				ch.unspillable--
+			}
+			ch.taken()
+			if len(ch.buffer) == 0 {
+				ch.buffer = make([]*OctopusEvent, 0, capacity)
+			}
+
+		case <-retry:
+			retry = nil
+
+		case spill = <-ch.seal:
+			sealed = true
+
+		case done := <-ch.flush:
+			flushed = sealed
+			done <- ch.spillAll(spill)
 		}
-	}()
+	}
+}
 
-	return ch
+func (ch *MessageChan) push(val *OctopusEvent, size int64) {
+	ch.buffer = append(ch.buffer, val)
+	ch.buffered.Add(1)
+	ch.memory.Add(size)
+	if val.Callback != nil {
+		ch.unspillable++
+	}
+}
+
+// write event to disk, once spilled new events follow until disk is drained to keep order
+func (ch *MessageChan) spillEvent(val *OctopusEvent) {
+	err := ch.spillQueue.Push(val)
+	if err != nil && ch.spilled.Load() == 0 {
+		log.Warnf("Failed to spill event, keep in memory: %v", err)
+		ch.push(val, eventSize(val))
+		return
+	}
+
+	// can't jump the queue, hold it and stop receiving until disk is back
+	if err != nil {
+		log.Warnf("Failed to spill event, retry in %v: %v", spillRetryInterval, err)
+		ch.pending = append(ch.pending, val)
+		ch.buffered.Add(1)
+		return
+	}
+	ch.spilled.Add(1)
+	ch.spillTotal.Add(1)
+}
+
+// retry events failed to spill, to memory once events before them left disk
+func (ch *MessageChan) spillPending() error {
+	for len(ch.pending) > 0 {
+		val := ch.pending[0]
+		if ch.spilled.Load() == 0 {
+			ch.push(val, eventSize(val))
+		} else if val.Callback != nil {
+			return nil
+		} else if err := ch.spillQueue.Push(val); err != nil {
+			return err
+		} else {
+			ch.spilled.Add(1)
+			ch.spillTotal.Add(1)
+		}
+		ch.pending = ch.pending[1:]
+		ch.buffered.Add(-1)
+	}
+	ch.pending = nil
+	return nil
+}
+
+// load oldest spilled events back to buffer, they are removed from disk once taken
+func (ch *MessageChan) unspill() error {
+	events, err := ch.spillQueue.Peek(spillBatchSize)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		ch.spilled.Store(0)
+		return nil
+	}
+
+	ch.spilled.Store(max(ch.spilled.Load()-int64(len(events)), 0))
+	for _, val := range events {
+		ch.push(val, eventSize(val))
+	}
+	ch.unacked += len(events)
+	return nil
+}
+
+// consumer took event at front of buffer, remove it from disk if loaded from there
+func (ch *MessageChan) taken() {
+	if ch.unacked == 0 {
+		return
+	}
+	ch.unacked--
+	ch.acks++
+	ch.ack()
+}
+
+// acknowledge events left disk, kept for next time on failure
+func (ch *MessageChan) ack() {
+	if ch.acks == 0 {
+		return
+	}
+	if err := ch.spillQueue.Ack(ch.acks); err != nil {
+		log.Warnf("Failed to remove %d delivered events from disk: %v", ch.acks, err)
+		return
+	}
+	ch.acks = 0
+}
+
+// spill events not taken by consumer yet, oldest first
+func (ch *MessageChan) spillAll(spill func(*OctopusEvent)) int {
+	if spill == nil {
+		return 0
+	}
+
+	count := 0
+	for {
+		select {
+		case val := <-ch.out:
+			spill(val)
+			ch.consumed.Add(-1)
+			count++
+			continue
+		default:
+		}
+		break
+	}
+	for _, val := range ch.buffer {
+		spill(val)
+		ch.buffered.Add(-1)
+		ch.memory.Add(-eventSize(val))
+		count++
+	}
+	ch.buffer = ch.buffer[:0]
+	ch.unspillable = 0
+	// loaded events are spilled again above, remove them from disk only afterwards
+	ch.acks += ch.unacked
+	ch.unacked = 0
+	ch.ack()
+	for ch.spilled.Load() > 0 {
+		events, err := ch.spillQueue.Peek(spillBatchSize)
+		if err != nil {
+			log.Warnf("Failed to load spilled events, %d left on disk: %v", ch.spilled.Load(), err)
+			break
+		}
+		if len(events) == 0 {
+			ch.spilled.Store(0)
+			break
+		}
+		ch.spilled.Store(max(ch.spilled.Load()-int64(len(events)), 0))
+		for _, val := range events {
+			spill(val)
+			count++
+		}
+		ch.acks += len(events)
+		ch.ack()
+	}
+	for _, val := range ch.pending {
+		spill(val)
+		ch.buffered.Add(-1)
+		count++
+	}
+	ch.pending = nil
+	for _, val := range ch.held {
+		spill(val)
+		count++
+	}
+	ch.held = nil
+	for {
+		select {
+		case val := <-ch.in:
+			spill(val)
+			count++
+			continue
+		default:
+		}
+		break
+	}
+
+	return count
 }
 
 func (ch *MessageChan) In() chan<- *OctopusEvent {
@@ -67,3 +379,84 @@ func (ch *MessageChan) In() chan<- *OctopusEvent {
 func (ch *MessageChan) Out() <-chan *OctopusEvent {
 	return ch.out
 }
+
+// events waiting in channels, buffer and spill queue
+func (ch *MessageChan) Len() int {
+	return len(ch.in) + len(ch.out) + int(ch.buffered.Load()) + int(ch.spilled.Load())
+}
+
+// events handed to consumer so far
+func (ch *MessageChan) Consumed() int64 {
+	return ch.consumed.Load()
+}
+
+// estimated bytes of buffered events
+func (ch *MessageChan) Memory() int64 {
+	return ch.memory.Load()
+}
+
+// events waiting in spill queue
+func (ch *MessageChan) Spilled() int64 {
+	return ch.spilled.Load()
+}
+
+// events spilled to disk so far
+func (ch *MessageChan) SpillTotal() int64 {
+	return ch.spillTotal.Load()
+}
+
+// Seal hold events sent from now on for spill, buffered events still go to consumer
+func (ch *MessageChan) Seal(spill func(*OctopusEvent)) {
+	select {
+	case ch.seal <- spill:
+	case <-ch.exit:
+	}
+}
+
+// Flush spill all events consumer has not taken in send order, must be sealed first, return spilled count
+func (ch *MessageChan) Flush() int {
+	done := make(chan int)
+	select {
+	case ch.flush <- done:
+		return <-done
+	case <-ch.exit:
+		return 0
+	}
+}
+
+// rough memory held by event, dominated by blobs
+func eventSize(event *OctopusEvent) int64 {
+	if event == nil {
+		return 0
+	}
+
+	size := int64(eventOverhead + len(event.Content))
+	switch v := event.Data.(type) {
+	case *BlobData:
+		if v != nil {
+			size += int64(len(v.Binary))
+		}
+	case []*BlobData:
+		for _, blob := range v {
+			if blob != nil {
+				size += int64(len(blob.Binary))
+			}
+		}
+	case *AppData:
+		if v != nil {
+			size += int64(len(v.Content))
+			for _, blob := range v.Blobs {
+				if blob != nil {
+					size += int64(len(blob.Binary))
+				}
+			}
+		}
+	case *ForwardData:
+		if v != nil {
+			for _, message := range v.Messages {
+				size += eventSize(message)
+			}
+		}
+	}
+	return size
+}
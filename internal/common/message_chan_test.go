@@ -0,0 +1,254 @@
+package common
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// one event in memory, the rest over budget
+const testBudget = eventOverhead + eventOverhead/2
+
+// memSpill keeps spilled events in memory, like EventSpill keeps them in database
+type memSpill struct {
+	lock   sync.Mutex
+	events []*OctopusEvent
+	loaded int
+	fail   bool
+}
+
+func (s *memSpill) Push(event *OctopusEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.fail {
+		return errors.New("disk full")
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *memSpill) Peek(limit int) ([]*OctopusEvent, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	end := min(s.loaded+limit, len(s.events))
+	events := slices.Clone(s.events[s.loaded:end])
+	s.loaded = end
+	return events, nil
+}
+
+func (s *memSpill) Ack(count int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	count = min(count, s.loaded)
+	s.events = s.events[count:]
+	s.loaded -= count
+	return nil
+}
+
+func (s *memSpill) Len() (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.events) - s.loaded, nil
+}
+
+func (s *memSpill) stored() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.events)
+}
+
+func testEvent(id int) *OctopusEvent {
+	return &OctopusEvent{ID: strconv.Itoa(id), Type: EventText}
+}
+
+func send(t *testing.T, ch *MessageChan, event *OctopusEvent) {
+	t.Helper()
+
+	select {
+	case ch.In() <- event:
+	case <-time.After(time.Second):
+		t.Fatalf("send of event %s blocked", event.ID)
+	}
+}
+
+func receive(t *testing.T, ch *MessageChan) *OctopusEvent {
+	t.Helper()
+
+	select {
+	case event := <-ch.Out():
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return nil
+	}
+}
+
+// wait until run loop reaches state
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expectOrder(t *testing.T, ch *MessageChan, from, to int) {
+	t.Helper()
+
+	for i := from; i <= to; i++ {
+		if event := receive(t, ch); event.ID != strconv.Itoa(i) {
+			t.Fatalf("received event %s, expect %d", event.ID, i)
+		}
+	}
+}
+
+func TestMessageChanUnbounded(t *testing.T) {
+	ch := NewMessageChan(4)
+
+	for i := 1; i <= 100; i++ {
+		send(t, ch, testEvent(i))
+	}
+	expectOrder(t, ch, 1, 100)
+}
+
+func TestMessageChanSpill(t *testing.T) {
+	spill := &memSpill{}
+	ch := NewBoundedMessageChan(4, testBudget, spill)
+
+	for i := 1; i <= 10; i++ {
+		send(t, ch, testEvent(i))
+	}
+	waitFor(t, func() bool { return ch.Spilled() == 9 })
+	if ch.SpillTotal() != 9 || ch.Len() != 10 {
+		t.Errorf("spill total = %d, len = %d", ch.SpillTotal(), ch.Len())
+	}
+
+	// events leave disk once taken, not when loaded
+	expectOrder(t, ch, 1, 2)
+	if stored := spill.stored(); stored != 8 {
+		t.Errorf("stored after taking one spilled event = %d", stored)
+	}
+
+	expectOrder(t, ch, 3, 10)
+	waitFor(t, func() bool { return spill.stored() == 0 })
+	if ch.Len() != 0 || ch.Memory() != 0 {
+		t.Errorf("len = %d, memory = %d", ch.Len(), ch.Memory())
+	}
+}
+
+func TestMessageChanReplaySpilled(t *testing.T) {
+	// left on disk by last run
+	spill := &memSpill{events: []*OctopusEvent{testEvent(1), testEvent(2)}}
+	ch := NewBoundedMessageChan(4, testBudget, spill)
+
+	send(t, ch, testEvent(3))
+	expectOrder(t, ch, 1, 3)
+}
+
+func TestMessageChanCallbackOrder(t *testing.T) {
+	spill := &memSpill{}
+	ch := NewBoundedMessageChan(4, testBudget, spill)
+
+	send(t, ch, testEvent(1))
+	send(t, ch, testEvent(2))
+	waitFor(t, func() bool { return ch.Spilled() == 1 })
+
+	// callback event never spills, but must not jump the spilled one
+	event := testEvent(3)
+	event.Callback = func(*OctopusEvent, error) {}
+	send(t, ch, event)
+
+	expectOrder(t, ch, 1, 3)
+}
+
+func TestMessageChanBackpressure(t *testing.T) {
+	ch := NewBoundedMessageChan(4, testBudget, nil)
+
+	send(t, ch, testEvent(1))
+	send(t, ch, testEvent(2))
+	send(t, ch, testEvent(3)) // waits in in channel
+
+	select {
+	case ch.In() <- testEvent(4):
+		t.Fatal("send over budget not blocked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	go func() { ch.In() <- testEvent(4) }()
+	expectOrder(t, ch, 1, 4)
+}
+
+func TestMessageChanSpillFailure(t *testing.T) {
+	spill := &memSpill{}
+	ch := NewBoundedMessageChan(4, testBudget, spill)
+
+	send(t, ch, testEvent(1))
+	send(t, ch, testEvent(2))
+	waitFor(t, func() bool { return ch.Spilled() == 1 })
+
+	// kept until disk is back, behind the spilled one
+	spill.lock.Lock()
+	spill.fail = true
+	spill.lock.Unlock()
+	send(t, ch, testEvent(3))
+	waitFor(t, func() bool { return ch.Len() == 3 })
+
+	spill.lock.Lock()
+	spill.fail = false
+	spill.lock.Unlock()
+	expectOrder(t, ch, 1, 3)
+}
+
+func TestMessageChanSealFlush(t *testing.T) {
+	spill := &memSpill{}
+	ch := NewBoundedMessageChan(4, testBudget, spill)
+
+	for i := 1; i <= 4; i++ {
+		send(t, ch, testEvent(i))
+	}
+	waitFor(t, func() bool { return ch.Spilled() == 3 })
+
+	var lock sync.Mutex
+	var flushed []string
+	ch.Seal(func(event *OctopusEvent) {
+		lock.Lock()
+		defer lock.Unlock()
+		flushed = append(flushed, event.ID)
+	})
+
+	// sent after sealed, held behind events already buffered
+	send(t, ch, testEvent(5))
+	expectOrder(t, ch, 1, 2)
+
+	if count := ch.Flush(); count != 3 {
+		t.Errorf("flushed count = %d", count)
+	}
+	// sent after flushed, spilled directly
+	send(t, ch, testEvent(6))
+	waitFor(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(flushed) == 4
+	})
+
+	lock.Lock()
+	defer lock.Unlock()
+	if !slices.Equal(flushed, []string{"3", "4", "5", "6"}) {
+		t.Errorf("flushed = %v", flushed)
+	}
+	if stored := spill.stored(); stored != 0 {
+		t.Errorf("stored after flush = %d", stored)
+	}
+}
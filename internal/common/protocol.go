@@ -11,6 +11,19 @@ import (
 const (
 	VENDOR_SEP    = ";"
 	REMOTE_PREFIX = "remote:"
+
+	MentionAll = "all"
+)
+
+const (
+	NoticeGroupIncrease = "group_increase"
+	NoticeGroupDecrease = "group_decrease"
+	NoticeGroupBan      = "group_ban"
+	NoticeGroupAdmin    = "group_admin"
+	NoticePoke          = "poke"
+	NoticeLuckyKing     = "lucky_king"
+	NoticeHonor         = "honor"
+	NoticeGroupCard     = "group_card"
 )
 
 type OctopusMessage struct {
@@ -48,7 +61,24 @@ type OctopusEvent struct {
 	Reply     *ReplyInfo `json:"reply,omitempty"`
 	Data      any        `json:"data,omitempty"`
 
+	// ids of mentioned users, MentionAll for everyone
+	Mentions []string `json:"mentions,omitempty"`
+
+	// correlation id in logs, assigned when the event enters octopus
+	TraceID  string                     `json:"-"`
 	Callback func(*OctopusEvent, error) `json:"-"`
+
+	// Telegram messages an event of master is sent for, several for merged forward
+	Sources []*SourceMessage `json:"-"`
+}
+
+// SourceMessage Telegram message kept with persisted event, to restore its callback
+type SourceMessage struct {
+	ChatID      int64  `json:"chat_id"`
+	MessageID   int64  `json:"message_id"`
+	ThreadID    int64  `json:"thread_id,omitempty"`
+	MediaType   string `json:"media_type,omitempty"`
+	MediaFileID string `json:"media_file_id,omitempty"`
 }
 
 type Vendor struct {
@@ -92,6 +122,36 @@ type LocationData struct {
 	Latitude  float64 `json:"latitude,omitempty"`
 }
 
+type ForwardData struct {
+	Title    string          `json:"title,omitempty"`
+	Messages []*OctopusEvent `json:"messages,omitempty"`
+}
+
+type NoticeData struct {
+	Type     string `json:"type,omitempty"`     // group_increase, group_decrease, group_ban, group_admin, poke, lucky_king, honor, group_card
+	SubType  string `json:"sub_type,omitempty"` // e.g. approve, invite, leave, kick, ban, lift_ban, set, unset
+	Target   *User  `json:"target,omitempty"`
+	Operator *User  `json:"operator,omitempty"`
+	Duration int64  `json:"duration,omitempty"` // ban duration in seconds
+	Honor    string `json:"honor,omitempty"`
+	Card     string `json:"card,omitempty"` // new group card of target
+}
+
+type RequestData struct {
+	Type      string `json:"type,omitempty"`     // friend, group
+	SubType   string `json:"sub_type,omitempty"` // add, invite
+	Flag      string `json:"flag,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	Nickname  string `json:"nickname,omitempty"`
+	Sex       string `json:"sex,omitempty"`
+	Age       int    `json:"age,omitempty"`
+	GroupID   string `json:"group_id,omitempty"`
+	GroupName string `json:"group_name,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	Decision  string `json:"decision,omitempty"` // approve, reject
+	Reason    string `json:"reason,omitempty"`
+}
+
 type BlobData struct {
 	Name   string `json:"name,omitempty"`
 	Mime   string `json:"mime,omitempty"`
@@ -221,6 +281,28 @@ func (o *OctopusEvent) UnmarshalJSON(data []byte) error {
 			return err
 		}
 		o.Data = chats
+	case EventNotice:
+		if len(rawMsg) == 0 {
+			o.Data = nil
+			return nil
+		}
+		var notice *NoticeData
+		if err := json.Unmarshal(rawMsg, &notice); err != nil {
+			return err
+		}
+		o.Data = notice
+	case EventRequest:
+		var request *RequestData
+		if err := json.Unmarshal(rawMsg, &request); err != nil {
+			return err
+		}
+		o.Data = request
+	case EventForward:
+		var forward *ForwardData
+		if err := json.Unmarshal(rawMsg, &forward); err != nil {
+			return err
+		}
+		o.Data = forward
 	}
 
 	return nil
@@ -258,6 +340,8 @@ const (
 	EventSync
 	EventObserve
 	EventSticker
+	EventRequest
+	EventForward
 )
 
 type MessageType int
@@ -335,6 +419,10 @@ func (t EventType) String() string {
 		return "observe"
 	case EventSticker:
 		return "sticker"
+	case EventRequest:
+		return "request"
+	case EventForward:
+		return "forward"
 	default:
 		return "unknown"
 	}
@@ -372,3 +460,27 @@ func Respond(w http.ResponseWriter, data any) error {
 	_, err = w.Write(dataStr)
 	return err
 }
+
+type storedEvent struct {
+	TraceID string           `json:"trace_id,omitempty"`
+	Sources []*SourceMessage `json:"sources,omitempty"`
+	Event   *OctopusEvent    `json:"event"`
+}
+
+// EncodeEvent serialize event with blobs for persistent queue, callback is lost but can be restored from sources
+func EncodeEvent(event *OctopusEvent) ([]byte, error) {
+	return json.Marshal(&storedEvent{TraceID: event.TraceID, Sources: event.Sources, Event: event})
+}
+
+func DecodeEvent(data []byte) (*OctopusEvent, error) {
+	var stored storedEvent
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	if stored.Event == nil {
+		return nil, errors.New("empty event")
+	}
+	stored.Event.TraceID = stored.TraceID
+	stored.Event.Sources = stored.Sources
+	return stored.Event, nil
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// tables to copy between databases, keep in sync with migrations
+var tables = []string{"chat", "link", "topic", "message", "request", "webhook_delivery", "event_queue", "archive", "archive_seed", "notify_level", "rule"}
+
+// primary key of tables without serial id
+var naturalKeys = map[string]string{"notify_level": "limb", "archive_seed": "vendor, chat_type, master_chat"}
+
+// data tables of schema
+func Tables() []string {
+	return tables
+}
+
+// copy all rows from src to dst, existing rows in dst are kept
+func Copy(src *sql.DB, srcDriver string, dst *sql.DB, dstDriver string) (map[string]int64, error) {
+	counts := map[string]int64{}
+
+	srcVersion, err := SchemaVersion(src)
+	if err != nil {
+		return counts, err
+	}
+	dstVersion, err := SchemaVersion(dst)
+	if err != nil {
+		return counts, err
+	}
+	if srcVersion != dstVersion {
+		return counts, fmt.Errorf("schema version mismatch: %d != %d", srcVersion, dstVersion)
+	}
+
+	for _, table := range tables {
+		count, err := copyTable(src, dst, dstDriver, table)
+		if err != nil {
+			return counts, fmt.Errorf("copy table %s failed: %v", table, err)
+		}
+		counts[table] = count
+	}
+
+	return counts, nil
+}
+
+func copyTable(src *sql.DB, dst *sql.DB, dstDriver string, table string) (int64, error) {
+	key, natural := naturalKeys[table]
+	if !natural {
+		key = "id"
+	}
+
+	rows, err := src.Query(fmt.Sprintf(`SELECT * FROM %s ORDER BY %s;`, table, key))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := dst.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(Rebind(dstDriver, fmt.Sprintf(
+		`INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING;`,
+		table,
+		strings.Join(columns, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "),
+	)))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var count int64
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return count, err
+		}
+		result, err := stmt.Exec(values...)
+		if err != nil {
+			return count, err
+		}
+		affected, _ := result.RowsAffected()
+		count += affected
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+
+	// explicit ids don't advance postgres sequences
+	if dstDriver == DriverPostgres && !natural {
+		if _, err := tx.Exec(fmt.Sprintf(
+			`SELECT setval(pg_get_serial_sequence('%s', 'id'), (SELECT COALESCE(MAX(id), 0) + 1 FROM %s), false);`,
+			table, table,
+		)); err != nil {
+			return count, err
+		}
+	}
+
+	return count, tx.Commit()
+}
@@ -2,17 +2,67 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
 
+	_ "github.com/lib/pq"
 	_ "modernc.org/sqlite"
 )
 
-var DB *sql.DB
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
 
-func init() {
+// open database by driver and apply pending migrations
+func Open(driver, dsn string) (*sql.DB, error) {
+	var conn *sql.DB
 	var err error
-	DB, err = sql.Open("sqlite", "master.db?cache=shared&mode=rwc&_journal_mode=WAL&_busy_timeout=10000")
-	if err != nil {
-		panic(err)
+	switch driver {
+	case DriverSQLite:
+		conn, err = sql.Open(driver, dsn+"?cache=shared&mode=rwc&_journal_mode=WAL&_busy_timeout=10000")
+		if err != nil {
+			return nil, err
+		}
+		conn.SetMaxOpenConns(1)
+	case DriverPostgres:
+		conn, err = sql.Open(driver, dsn)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("database driver %s not support", driver)
+	}
+
+	if err := Migrate(conn, driver); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// rewrite ? placeholders to $n for postgres
+func Rebind(driver, query string) string {
+	if driver != DriverPostgres {
+		return query
+	}
+
+	var sb strings.Builder
+	n := 0
+	quoted := false
+	for _, r := range query {
+		if r == '\'' {
+			quoted = !quoted
+		}
+		if r == '?' && !quoted {
+			n++
+			sb.WriteString("$")
+			sb.WriteString(strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
 	}
-	DB.SetMaxOpenConns(1)
+	return sb.String()
 }
@@ -0,0 +1,459 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Migration struct {
+	Version     int
+	Description string
+	SQLite      func(tx *sql.Tx) error
+	Postgres    func(tx *sql.Tx) error
+}
+
+// ordered up-migrations, never modify a released one, append a new version instead
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "initial schema",
+		SQLite: execSQL(`
+			CREATE TABLE IF NOT EXISTS chat (
+				id INTEGER PRIMARY KEY,
+				limb TEXT NOT NULL,
+				chat_type TEXT NOT NULL,
+				title TEXT NOT NULL,
+				UNIQUE(limb)
+			);
+			CREATE INDEX IF NOT EXISTS idx_title ON chat (title);
+			CREATE TABLE IF NOT EXISTS link (
+				id INTEGER PRIMARY KEY,
+				master_limb TEXT NOT NULL,
+				slave_limb TEXT NOT NULL,
+				UNIQUE(master_limb, slave_limb)
+			);
+			CREATE TABLE IF NOT EXISTS topic (
+				id INTEGER PRIMARY KEY,
+				master_limb TEXT NOT NULL,
+				slave_limb TEXT NOT NULL,
+				topic_id INTEGER NOT NULL,
+				UNIQUE(master_limb, slave_limb)
+			);
+			CREATE TABLE IF NOT EXISTS message (
+				id INTEGER PRIMARY KEY,
+				master_limb TEXT NOT NULL,
+				master_msg_id TEXT NOT NULL,
+				master_msg_thread_id TEXT NOT NULL,
+				slave_limb TEXT NOT NULL,
+				slave_msg_id TEXT NOT NULL,
+				slave_sender TEXT NOT NULL,
+				content TEXT NOT NULL,
+				timestamp INTEGER NOT NULL,
+				created DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(master_limb, master_msg_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_slave_reply ON message (slave_limb, timestamp);
+			CREATE INDEX IF NOT EXISTS idx_master_reply ON message (master_limb, master_msg_id);`),
+		Postgres: execSQL(`
+			CREATE TABLE IF NOT EXISTS chat (
+				id BIGSERIAL PRIMARY KEY,
+				limb TEXT NOT NULL,
+				chat_type TEXT NOT NULL,
+				title TEXT NOT NULL,
+				UNIQUE(limb)
+			);
+			CREATE INDEX IF NOT EXISTS idx_title ON chat (title);
+			CREATE TABLE IF NOT EXISTS link (
+				id BIGSERIAL PRIMARY KEY,
+				master_limb TEXT NOT NULL,
+				slave_limb TEXT NOT NULL,
+				UNIQUE(master_limb, slave_limb)
+			);
+			CREATE TABLE IF NOT EXISTS topic (
+				id BIGSERIAL PRIMARY KEY,
+				master_limb TEXT NOT NULL,
+				slave_limb TEXT NOT NULL,
+				topic_id BIGINT NOT NULL,
+				UNIQUE(master_limb, slave_limb)
+			);
+			CREATE TABLE IF NOT EXISTS message (
+				id BIGSERIAL PRIMARY KEY,
+				master_limb TEXT NOT NULL,
+				master_msg_id TEXT NOT NULL,
+				master_msg_thread_id TEXT NOT NULL,
+				slave_limb TEXT NOT NULL,
+				slave_msg_id TEXT NOT NULL,
+				slave_sender TEXT NOT NULL,
+				content TEXT NOT NULL,
+				timestamp BIGINT NOT NULL,
+				created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(master_limb, master_msg_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_slave_reply ON message (slave_limb, timestamp);
+			CREATE INDEX IF NOT EXISTS idx_master_reply ON message (master_limb, master_msg_id);`),
+	},
+	{
+		Version:     2,
+		Description: "friend and group requests",
+		SQLite: execSQL(`
+			CREATE TABLE IF NOT EXISTS request (
+				id INTEGER PRIMARY KEY,
+				vendor TEXT NOT NULL,
+				request_type TEXT NOT NULL,
+				sub_type TEXT NOT NULL,
+				flag TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				group_id TEXT NOT NULL,
+				comment TEXT NOT NULL,
+				status TEXT NOT NULL,
+				result TEXT NOT NULL DEFAULT '',
+				created DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_request_status ON request (status);`),
+		Postgres: execSQL(`
+			CREATE TABLE IF NOT EXISTS request (
+				id BIGSERIAL PRIMARY KEY,
+				vendor TEXT NOT NULL,
+				request_type TEXT NOT NULL,
+				sub_type TEXT NOT NULL,
+				flag TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				group_id TEXT NOT NULL,
+				comment TEXT NOT NULL,
+				status TEXT NOT NULL,
+				result TEXT NOT NULL DEFAULT '',
+				created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_request_status ON request (status);`),
+	},
+	{
+		Version:     3,
+		Description: "chat active flag",
+		SQLite:      addColumn("chat", "active", "INTEGER NOT NULL DEFAULT 1"),
+		Postgres:    execSQL(`ALTER TABLE chat ADD COLUMN IF NOT EXISTS active INTEGER NOT NULL DEFAULT 1;`),
+	},
+	{
+		Version:     4,
+		Description: "message full-text search",
+		SQLite: execSQL(`
+			CREATE VIRTUAL TABLE IF NOT EXISTS message_fts USING fts5(
+				content,
+				content='message',
+				content_rowid='id',
+				tokenize='trigram'
+			);
+			CREATE TRIGGER IF NOT EXISTS message_fts_insert AFTER INSERT ON message BEGIN
+				INSERT INTO message_fts (rowid, content) VALUES (new.id, new.content);
+			END;
+			CREATE TRIGGER IF NOT EXISTS message_fts_delete AFTER DELETE ON message BEGIN
+				INSERT INTO message_fts (message_fts, rowid, content) VALUES ('delete', old.id, old.content);
+			END;
+			CREATE TRIGGER IF NOT EXISTS message_fts_update AFTER UPDATE OF content ON message BEGIN
+				INSERT INTO message_fts (message_fts, rowid, content) VALUES ('delete', old.id, old.content);
+				INSERT INTO message_fts (rowid, content) VALUES (new.id, new.content);
+			END;
+			INSERT INTO message_fts (message_fts) VALUES ('rebuild');`),
+		Postgres: execSQL(`
+			CREATE INDEX IF NOT EXISTS idx_message_fts ON message USING GIN (to_tsvector('simple', content));`),
+	},
+	{
+		Version:     5,
+		Description: "message media for export",
+		SQLite: func(tx *sql.Tx) error {
+			if err := addColumn("message", "media_type", "TEXT NOT NULL DEFAULT ''")(tx); err != nil {
+				return err
+			}
+			if err := addColumn("message", "media_file_id", "TEXT NOT NULL DEFAULT ''")(tx); err != nil {
+				return err
+			}
+			return execSQL(`CREATE INDEX IF NOT EXISTS idx_message_export ON message (slave_limb, id);`)(tx)
+		},
+		Postgres: execSQL(`
+			ALTER TABLE message ADD COLUMN IF NOT EXISTS media_type TEXT NOT NULL DEFAULT '';
+			ALTER TABLE message ADD COLUMN IF NOT EXISTS media_file_id TEXT NOT NULL DEFAULT '';
+			CREATE INDEX IF NOT EXISTS idx_message_export ON message (slave_limb, id);`),
+	},
+	{
+		Version:     6,
+		Description: "message retention",
+		SQLite:      execSQL(`CREATE INDEX IF NOT EXISTS idx_message_created ON message (created);`),
+		Postgres:    execSQL(`CREATE INDEX IF NOT EXISTS idx_message_created ON message (created);`),
+	},
+	{
+		Version:     7,
+		Description: "webhook delivery log",
+		SQLite: execSQL(`
+			CREATE TABLE IF NOT EXISTS webhook_delivery (
+				id INTEGER PRIMARY KEY,
+				webhook TEXT NOT NULL,
+				direction TEXT NOT NULL,
+				vendor TEXT NOT NULL,
+				chat TEXT NOT NULL,
+				event_type TEXT NOT NULL,
+				event_id TEXT NOT NULL,
+				status TEXT NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				response_code INTEGER NOT NULL DEFAULT 0,
+				error TEXT NOT NULL DEFAULT '',
+				created DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_webhook_delivery_created ON webhook_delivery (created);`),
+		Postgres: execSQL(`
+			CREATE TABLE IF NOT EXISTS webhook_delivery (
+				id BIGSERIAL PRIMARY KEY,
+				webhook TEXT NOT NULL,
+				direction TEXT NOT NULL,
+				vendor TEXT NOT NULL,
+				chat TEXT NOT NULL,
+				event_type TEXT NOT NULL,
+				event_id TEXT NOT NULL,
+				status TEXT NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				response_code INTEGER NOT NULL DEFAULT 0,
+				error TEXT NOT NULL DEFAULT '',
+				created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_webhook_delivery_created ON webhook_delivery (created);`),
+	},
+	{
+		Version:     8,
+		Description: "undelivered event queue",
+		SQLite: execSQL(`
+			CREATE TABLE IF NOT EXISTS event_queue (
+				id INTEGER PRIMARY KEY,
+				queue TEXT NOT NULL,
+				vendor TEXT NOT NULL,
+				payload BLOB NOT NULL,
+				created DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_event_queue ON event_queue (queue, vendor, id);`),
+		Postgres: execSQL(`
+			CREATE TABLE IF NOT EXISTS event_queue (
+				id BIGSERIAL PRIMARY KEY,
+				queue TEXT NOT NULL,
+				vendor TEXT NOT NULL,
+				payload BYTEA NOT NULL,
+				created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_event_queue ON event_queue (queue, vendor, id);`),
+	},
+	{
+		Version:     9,
+		Description: "archive supergroup bindings",
+		SQLite: execSQL(`
+			CREATE TABLE IF NOT EXISTS archive (
+				id INTEGER PRIMARY KEY,
+				vendor TEXT NOT NULL,
+				chat_type TEXT NOT NULL DEFAULT '',
+				master_chat INTEGER NOT NULL,
+				created DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (vendor, chat_type)
+			);`),
+		Postgres: execSQL(`
+			CREATE TABLE IF NOT EXISTS archive (
+				id BIGSERIAL PRIMARY KEY,
+				vendor TEXT NOT NULL,
+				chat_type TEXT NOT NULL DEFAULT '',
+				master_chat BIGINT NOT NULL,
+				created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (vendor, chat_type)
+			);`),
+	},
+	{
+		Version:     10,
+		Description: "chat notification levels",
+		SQLite: execSQL(`
+			CREATE TABLE IF NOT EXISTS notify_level (
+				limb TEXT PRIMARY KEY,
+				level TEXT NOT NULL,
+				updated DATETIME DEFAULT CURRENT_TIMESTAMP
+			);`),
+		Postgres: execSQL(`
+			CREATE TABLE IF NOT EXISTS notify_level (
+				limb TEXT PRIMARY KEY,
+				level TEXT NOT NULL,
+				updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);`),
+	},
+	{
+		Version:     11,
+		Description: "rules of incoming events",
+		SQLite: execSQL(`
+			CREATE TABLE IF NOT EXISTS rule (
+				id INTEGER PRIMARY KEY,
+				priority INTEGER NOT NULL DEFAULT 0,
+				vendor TEXT NOT NULL DEFAULT '',
+				chat TEXT NOT NULL DEFAULT '',
+				sender TEXT NOT NULL DEFAULT '',
+				event_type TEXT NOT NULL DEFAULT '',
+				pattern TEXT NOT NULL DEFAULT '',
+				action TEXT NOT NULL,
+				target TEXT NOT NULL DEFAULT '',
+				enabled INTEGER NOT NULL DEFAULT 1,
+				created DATETIME DEFAULT CURRENT_TIMESTAMP
+			);`),
+		Postgres: execSQL(`
+			CREATE TABLE IF NOT EXISTS rule (
+				id BIGSERIAL PRIMARY KEY,
+				priority INTEGER NOT NULL DEFAULT 0,
+				vendor TEXT NOT NULL DEFAULT '',
+				chat TEXT NOT NULL DEFAULT '',
+				sender TEXT NOT NULL DEFAULT '',
+				event_type TEXT NOT NULL DEFAULT '',
+				pattern TEXT NOT NULL DEFAULT '',
+				action TEXT NOT NULL,
+				target TEXT NOT NULL DEFAULT '',
+				enabled INTEGER NOT NULL DEFAULT 1,
+				created TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);`),
+	},
+	{
+		Version:     12,
+		Description: "message trigram search",
+		SQLite:      noop,
+		Postgres: execSQL(`
+			CREATE EXTENSION IF NOT EXISTS pg_trgm;
+			DROP INDEX IF EXISTS idx_message_fts;
+			CREATE INDEX IF NOT EXISTS idx_message_trgm ON message USING GIN (content gin_trgm_ops);`),
+	},
+	{
+		Version:     13,
+		Description: "archive bindings seeded from config",
+		SQLite: execSQL(`
+			CREATE TABLE IF NOT EXISTS archive_seed (
+				vendor TEXT NOT NULL,
+				chat_type TEXT NOT NULL DEFAULT '',
+				master_chat INTEGER NOT NULL,
+				created DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (vendor, chat_type, master_chat)
+			);`),
+		Postgres: execSQL(`
+			CREATE TABLE IF NOT EXISTS archive_seed (
+				vendor TEXT NOT NULL,
+				chat_type TEXT NOT NULL DEFAULT '',
+				master_chat BIGINT NOT NULL,
+				created TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (vendor, chat_type, master_chat)
+			);`),
+	},
+}
+
+// apply pending migrations in order, refuse database from newer version
+func Migrate(db *sql.DB, driver string) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`); err != nil {
+		return err
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	latest := LatestVersion()
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		log.Infof("Migrate database schema to version %d: %s", m.Version, m.Description)
+		if err := applyMigration(db, driver, m); err != nil {
+			return fmt.Errorf("migrate to version %d failed: %v", m.Version, err)
+		}
+	}
+
+	return nil
+}
+
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func SchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version;`).Scan(&version)
+	return version, err
+}
+
+func applyMigration(db *sql.DB, driver string, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	up := m.SQLite
+	if driver == DriverPostgres {
+		up = m.Postgres
+	}
+	if err := up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		Rebind(driver, `INSERT INTO schema_version (version, description) VALUES (?, ?);`),
+		m.Version, m.Description,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func noop(tx *sql.Tx) error {
+	return nil
+}
+
+func execSQL(query string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// add column if not exists, tables may be created by versions before migration
+func addColumn(table, column, definition string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		rows, err := tx.Query(fmt.Sprintf(`PRAGMA table_info(%s);`, table))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				cid       int
+				name      string
+				ctype     string
+				notNull   int
+				dfltValue sql.NullString
+				pk        int
+			)
+			if err := rows.Scan(&cid, &name, &ctype, &notNull, &dfltValue, &pk); err != nil {
+				return err
+			}
+			if name == column {
+				return nil
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s;`, table, column, definition))
+		return err
+	}
+}
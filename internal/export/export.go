@@ -0,0 +1,355 @@
+package export
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	"github.com/gabriel-vasile/mimetype"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	pageSize = 200
+
+	defaultMaxMediaSize = 20 * 1024 * 1024
+)
+
+// fetch media by Telegram file id
+type Fetcher func(fileID string) (*common.BlobData, error)
+
+type Options struct {
+	SlaveLimb string
+	Title     string
+	From      time.Time
+	To        time.Time
+
+	// media are skipped without fetcher
+	Fetch Fetcher
+	// local blob cache, looked up before fetching and filled after
+	CacheDir     string
+	MaxMediaSize int
+}
+
+type Result struct {
+	Messages int
+	Media    int
+	Missing  int
+}
+
+type jsonMedia struct {
+	Type   string `json:"type"`
+	FileID string `json:"file_id"`
+	Name   string `json:"name,omitempty"`
+	Mime   string `json:"mime,omitempty"`
+	Size   int    `json:"size,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type jsonMessage struct {
+	ID        string     `json:"id"`
+	MessageID string     `json:"message_id"`
+	Sender    string     `json:"sender"`
+	Content   string     `json:"content"`
+	Timestamp int64      `json:"timestamp"`
+	Created   time.Time  `json:"created"`
+	Media     *jsonMedia `json:"media,omitempty"`
+}
+
+// write messages of slave chat to HTML and JSON page by page, media are embedded into HTML one by one
+func Export(opts *Options, htmlOut io.Writer, jsonOut io.Writer) (*Result, error) {
+	limb, err := common.LimbFromString(opts.SlaveLimb)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxMediaSize == 0 {
+		opts.MaxMediaSize = defaultMaxMediaSize
+	}
+	title := cmp.Or(opts.Title, limb.ChatID)
+
+	hw := bufio.NewWriter(htmlOut)
+	jw := bufio.NewWriter(jsonOut)
+
+	if err := writeHTMLHeader(hw, title, opts); err != nil {
+		return nil, err
+	}
+	if err := writeJSONHeader(jw, title, opts); err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	var afterID int64
+	for {
+		messages, err := manager.GetExportMessages(opts.SlaveLimb, opts.From, opts.To, afterID, pageSize)
+		if err != nil {
+			return result, err
+		}
+
+		for _, m := range messages {
+			entry := &jsonMessage{
+				ID:        m.ID,
+				MessageID: m.SlaveMsgID,
+				Sender:    m.SlaveSender,
+				Content:   m.Content,
+				Timestamp: m.Timestamp,
+				Created:   m.Created,
+			}
+			if m.SlaveSender == limb.UID {
+				entry.Sender = "Me"
+			}
+
+			var blob *common.BlobData
+			if m.MediaFileID != "" {
+				entry.Media = &jsonMedia{Type: m.MediaType, FileID: m.MediaFileID}
+				if blob, err = opts.fetch(m.MediaFileID); err != nil {
+					log.Debugf("Export media %s failed: %v", m.MediaFileID, err)
+					entry.Media.Error = err.Error()
+					result.Missing++
+				} else {
+					entry.Media.Name = blob.Name
+					entry.Media.Mime = blob.Mime
+					entry.Media.Size = len(blob.Binary)
+					result.Media++
+				}
+			}
+
+			if err := writeHTMLMessage(hw, entry, blob); err != nil {
+				return result, err
+			}
+			if err := writeJSONMessage(jw, entry, result.Messages == 0); err != nil {
+				return result, err
+			}
+			result.Messages++
+
+			if afterID, err = common.Atoi(m.ID); err != nil {
+				return result, err
+			}
+		}
+
+		if len(messages) < pageSize {
+			break
+		}
+	}
+
+	if _, err := io.WriteString(hw, htmlFooter); err != nil {
+		return result, err
+	}
+	if _, err := io.WriteString(jw, "\n]}\n"); err != nil {
+		return result, err
+	}
+	if err := hw.Flush(); err != nil {
+		return result, err
+	}
+	return result, jw.Flush()
+}
+
+func (opts *Options) fetch(fileID string) (*common.BlobData, error) {
+	var cachePath string
+	if opts.CacheDir != "" {
+		cachePath = filepath.Join(opts.CacheDir, fileID)
+		if data, err := os.ReadFile(cachePath); err == nil {
+			return newBlob(fileID, data, opts.MaxMediaSize)
+		}
+	}
+
+	if opts.Fetch == nil {
+		return nil, errors.New("media not available")
+	}
+
+	blob, err := opts.Fetch(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	if cachePath != "" {
+		if err := os.WriteFile(cachePath, blob.Binary, 0o644); err != nil {
+			log.Warnf("Failed to cache media %s: %v", fileID, err)
+		}
+	}
+
+	if len(blob.Binary) > opts.MaxMediaSize {
+		return nil, fmt.Errorf("media too large (%d bytes)", len(blob.Binary))
+	}
+	return blob, nil
+}
+
+func newBlob(fileID string, data []byte, maxSize int) (*common.BlobData, error) {
+	if len(data) > maxSize {
+		return nil, fmt.Errorf("media too large (%d bytes)", len(data))
+	}
+	mime := mimetype.Detect(data)
+	return &common.BlobData{
+		Name:   fileID + mime.Extension(),
+		Mime:   mime.String(),
+		Binary: data,
+	}, nil
+}
+
+func writeJSONHeader(w io.Writer, title string, opts *Options) error {
+	header, err := json.Marshal(map[string]any{
+		"chat":  opts.SlaveLimb,
+		"title": title,
+		"from":  opts.From,
+		"to":    opts.To,
+	})
+	if err != nil {
+		return err
+	}
+	// keep the header object open to stream messages into it
+	_, err = fmt.Fprintf(w, "%s,\n\"messages\": [", strings.TrimSuffix(string(header), "}"))
+	return err
+}
+
+func writeJSONMessage(w io.Writer, entry *jsonMessage, first bool) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if !first {
+		if _, err := io.WriteString(w, ","); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "\n%s", data)
+	return err
+}
+
+func writeHTMLHeader(w io.Writer, title string, opts *Options) error {
+	_, err := fmt.Fprintf(w, htmlHeader,
+		html.EscapeString(title),
+		html.EscapeString(title),
+		html.EscapeString(opts.SlaveLimb),
+		opts.From.Format(time.DateOnly),
+		opts.To.Add(-time.Nanosecond).Format(time.DateOnly),
+	)
+	return err
+}
+
+func writeHTMLMessage(w io.Writer, entry *jsonMessage, blob *common.BlobData) error {
+	if _, err := fmt.Fprintf(w,
+		"<div class=\"msg\"><div class=\"meta\"><b>%s</b> <span>%s</span></div>",
+		html.EscapeString(entry.Sender),
+		html.EscapeString(formatTimestamp(entry.Timestamp)),
+	); err != nil {
+		return err
+	}
+
+	if entry.Media != nil {
+		if err := writeHTMLMedia(w, entry.Media, blob); err != nil {
+			return err
+		}
+	}
+
+	if entry.Content != "" {
+		if _, err := fmt.Fprintf(w, "<div class=\"text\">%s</div>", html.EscapeString(entry.Content)); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "</div>\n")
+	return err
+}
+
+// embed media as data URI, encoded directly into the output
+func writeHTMLMedia(w io.Writer, media *jsonMedia, blob *common.BlobData) error {
+	if blob == nil {
+		_, err := fmt.Fprintf(w, "<div class=\"missing\">[%s: %s]</div>",
+			html.EscapeString(media.Type), html.EscapeString(media.Error))
+		return err
+	}
+
+	var prefix, suffix string
+	switch {
+	case strings.HasPrefix(blob.Mime, "image/"):
+		prefix, suffix = `<img src="`, `">`
+	case strings.HasPrefix(blob.Mime, "video/"):
+		prefix, suffix = `<video controls src="`, `"></video>`
+	case strings.HasPrefix(blob.Mime, "audio/"):
+		prefix, suffix = `<audio controls src="`, `"></audio>`
+	default:
+		prefix = fmt.Sprintf(`<a download="%s" href="`, html.EscapeString(blob.Name))
+		suffix = fmt.Sprintf(`">📎 %s</a>`, html.EscapeString(blob.Name))
+	}
+
+	if _, err := fmt.Fprintf(w, "<div class=\"media\">%sdata:%s;base64,", prefix, html.EscapeString(blob.Mime)); err != nil {
+		return err
+	}
+	encoder := base64.NewEncoder(base64.StdEncoding, w)
+	if _, err := encoder.Write(blob.Binary); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s</div>", suffix)
+	return err
+}
+
+// timestamps of limbs are in seconds or milliseconds
+func formatTimestamp(ts int64) string {
+	if ts > 1e12 {
+		return time.UnixMilli(ts).Format("2006-01-02 15:04:05")
+	}
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
+
+const htmlHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { font-family: sans-serif; max-width: 800px; margin: 0 auto; padding: 16px; background: #f4f4f5; }
+.msg { background: #fff; border-radius: 8px; padding: 8px 12px; margin: 8px 0; }
+.meta { color: #666; font-size: 0.85em; margin-bottom: 4px; }
+.text { white-space: pre-wrap; word-wrap: break-word; }
+.media img, .media video { max-width: 100%%; max-height: 480px; }
+.missing { color: #999; font-style: italic; }
+</style>
+</head>
+<body>
+<h2>%s</h2>
+<p class="meta">%s | %s ~ %s</p>
+`
+
+const htmlFooter = `</body>
+</html>
+`
+
+// parse optional date range, the end date is inclusive and defaults to now
+func ParseRange(from, to string) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+
+	if from != "" {
+		if start, err = time.ParseInLocation(time.DateOnly, from, time.Local); err != nil {
+			return start, end, fmt.Errorf("invalid from date %q", from)
+		}
+	}
+	if to != "" {
+		if end, err = time.ParseInLocation(time.DateOnly, to, time.Local); err != nil {
+			return start, end, fmt.Errorf("invalid to date %q", to)
+		}
+		end = end.AddDate(0, 0, 1)
+	} else {
+		end = time.Now()
+	}
+
+	if !start.Before(end) {
+		return start, end, errors.New("from date must be before to date")
+	}
+	return start, end, nil
+}
@@ -2,6 +2,7 @@ package filter
 
 import "github.com/duo/octopus/internal/common"
 
+// filter returns nil to drop the event, only slave to master chains expect it
 type EventFilter interface {
 	Apply(event *common.OctopusEvent) *common.OctopusEvent
 }
@@ -10,9 +11,13 @@ type EventFilterChain struct {
 	Filters []EventFilter
 }
 
+// apply filters in order, events entering here get their correlation id
 func (c EventFilterChain) Apply(event *common.OctopusEvent) *common.OctopusEvent {
+	event.Trace()
 	for _, filter := range c.Filters {
-		event = filter.Apply(event)
+		if event = filter.Apply(event); event == nil {
+			return nil
+		}
 	}
 	return event
 }
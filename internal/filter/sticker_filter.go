@@ -4,14 +4,14 @@ import (
 	"bytes"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/metrics"
 
 	"github.com/Benau/tgsconverter/libtgsconverter"
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/tidwall/gjson"
-
-	log "github.com/sirupsen/logrus"
 )
 
 // Telegram -> QQ/WeChat: convert webm and tgs image to gif
@@ -30,7 +30,7 @@ func (f StickerM2SFilter) Apply(event *common.OctopusEvent) *common.OctopusEvent
 			switch blob.Mime {
 			case "video/webm":
 				if data, err := webm2gif(blob.Binary); err != nil {
-					log.Warnf("Failed to convert webm to gif: %v", err)
+					common.EventLog(event).Warnf("Failed to convert webm to gif: %v", err)
 				} else {
 					blob.Mime = "image/gif"
 					blob.Name = blob.Name + ".gif"
@@ -44,7 +44,7 @@ func (f StickerM2SFilter) Apply(event *common.OctopusEvent) *common.OctopusEvent
 				}
 			case "application/gzip": // TGS
 				if data, err := tgs2gif(blob.Binary); err != nil {
-					log.Warnf("Failed to convert tgs to gif: %v", err)
+					common.EventLog(event).Warnf("Failed to convert tgs to gif: %v", err)
 				} else {
 					blob.Mime = "image/gif"
 					blob.Name = blob.Name + ".gif"
@@ -69,7 +69,7 @@ func (f StickerS2MFilter) Apply(event *common.OctopusEvent) *common.OctopusEvent
 			blob.Mime = mime.String()
 			if blob.Mime == "image/jpeg" {
 				if data, err := jpeg2webp(blob.Binary); err != nil {
-					log.Warnf("Failed to convert jpeg to webp: %v", err)
+					common.EventLog(event).Warnf("Failed to convert jpeg to webp: %v", err)
 				} else {
 					blob.Mime = "image/webp"
 					blob.Binary = data
@@ -80,7 +80,7 @@ func (f StickerS2MFilter) Apply(event *common.OctopusEvent) *common.OctopusEvent
 						blob.Mime = "image/png"
 					}
 				} else {
-					log.Warnf("Failed to probe gif: %v", err)
+					common.EventLog(event).Warnf("Failed to probe gif: %v", err)
 				}
 			}
 		}
@@ -111,6 +111,8 @@ func ffprobe(rawData []byte) (string, error) {
 }
 
 func webm2gif(rawData []byte) ([]byte, error) {
+	defer metrics.ObserveTranscode("webm2gif", time.Now())
+
 	webmFile, err := os.CreateTemp("", "webm-")
 	if err != nil {
 		return nil, err
@@ -137,6 +139,8 @@ func webm2gif(rawData []byte) ([]byte, error) {
 }
 
 func tgs2gif(rawData []byte) ([]byte, error) {
+	defer metrics.ObserveTranscode("tgs2gif", time.Now())
+
 	opt := libtgsconverter.NewConverterOptions()
 	opt.SetExtension("gif")
 	opt.SetScale(0.5)
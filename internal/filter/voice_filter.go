@@ -7,12 +7,12 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/metrics"
 
 	"github.com/youthlin/silk"
-
-	log "github.com/sirupsen/logrus"
 )
 
 const sampleRate = 24000
@@ -27,14 +27,14 @@ func (f VoiceM2SFilter) Apply(event *common.OctopusEvent) *common.OctopusEvent {
 		switch event.Vendor.Type {
 		case "qq":
 			if data, err := ogg2silk(blob.Binary); err != nil {
-				log.Warnf("Failed to convert ogg to silk: %v", err)
+				common.EventLog(event).Warnf("Failed to convert ogg to silk: %v", err)
 			} else {
 				blob.Mime = "audio/silk"
 				blob.Binary = data
 			}
 		case "wechat":
 			if data, err := ogg2mp3(blob.Binary); err != nil {
-				log.Warnf("Failed to convert ogg to mp3: %v", err)
+				common.EventLog(event).Warnf("Failed to convert ogg to mp3: %v", err)
 			} else {
 				event.Type = common.EventFile
 				blob.Mime = "audio/mpeg"
@@ -59,7 +59,7 @@ func (f VoiceS2MFilter) Apply(event *common.OctopusEvent) *common.OctopusEvent {
 		blob := event.Data.(*common.BlobData)
 		if event.Vendor.Type == "qq" || event.Vendor.Type == "wechat" {
 			if data, err := silk2ogg(blob.Binary); err != nil {
-				log.Warnf("Failed to convert silk to ogg: %v", err)
+				common.EventLog(event).Warnf("Failed to convert silk to ogg: %v", err)
 			} else {
 				blob.Mime = "audio/ogg"
 				blob.Binary = data
@@ -71,6 +71,8 @@ func (f VoiceS2MFilter) Apply(event *common.OctopusEvent) *common.OctopusEvent {
 }
 
 func silk2ogg(rawData []byte) ([]byte, error) {
+	defer metrics.ObserveTranscode("silk2ogg", time.Now())
+
 	buf := bytes.NewBuffer(rawData)
 	pcmData, err := silk.Decode(buf)
 	if err != nil {
@@ -121,6 +123,8 @@ func silk2ogg(rawData []byte) ([]byte, error) {
 }
 
 func ogg2silk(rawData []byte) ([]byte, error) {
+	defer metrics.ObserveTranscode("ogg2silk", time.Now())
+
 	oggFile, err := os.CreateTemp("", "ogg-")
 	if err != nil {
 		return nil, err
@@ -158,6 +162,8 @@ func ogg2silk(rawData []byte) ([]byte, error) {
 }
 
 func ogg2mp3(rawData []byte) ([]byte, error) {
+	defer metrics.ObserveTranscode("ogg2mp3", time.Now())
+
 	oggFile, err := os.CreateTemp("", "ogg-")
 	if err != nil {
 		return nil, err
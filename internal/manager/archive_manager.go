@@ -0,0 +1,129 @@
+package manager
+
+// Archive binds chats of vendor without link to a forum supergroup, optionally by chat type
+type Archive struct {
+	ID         int64
+	Vendor     string
+	ChatType   string
+	MasterChat int64
+}
+
+type ArchiveRepository interface {
+	GetArchiveList() ([]*Archive, error)
+	GetArchivesByMaster(masterChat int64) ([]*Archive, error)
+	GetArchive(vendor, chatType string) (*Archive, error)
+	SetArchive(a *Archive) error
+	SeedArchive(a *Archive) error
+	DelArchiveById(id int64) error
+}
+
+func GetArchiveList() ([]*Archive, error) {
+	return store.Archives.GetArchiveList()
+}
+
+func GetArchivesByMaster(masterChat int64) ([]*Archive, error) {
+	return store.Archives.GetArchivesByMaster(masterChat)
+}
+
+// get archive of chat, binding of chat type is preferred over the one for all chats
+func GetArchive(vendor, chatType string) (*Archive, error) {
+	return store.Archives.GetArchive(vendor, chatType)
+}
+
+// bind vendor and chat type to supergroup, replace existing binding
+func SetArchive(a *Archive) error {
+	return store.Archives.SetArchive(a)
+}
+
+// add archive once, unless vendor and chat type are already bound.
+// a seeded archive unbound later is not added again
+func SeedArchive(a *Archive) error {
+	return store.Archives.SeedArchive(a)
+}
+
+func DelArchiveById(id int64) error {
+	return store.Archives.DelArchiveById(id)
+}
+
+type sqlArchiveRepository struct {
+	*sqlDB
+}
+
+func (r *sqlArchiveRepository) GetArchiveList() ([]*Archive, error) {
+	return r.getArchives(`SELECT id, vendor, chat_type, master_chat FROM archive ORDER BY vendor, chat_type;`)
+}
+
+func (r *sqlArchiveRepository) GetArchivesByMaster(masterChat int64) ([]*Archive, error) {
+	return r.getArchives(`SELECT id, vendor, chat_type, master_chat FROM archive
+		WHERE master_chat = ? ORDER BY vendor, chat_type;`,
+		masterChat,
+	)
+}
+
+func (r *sqlArchiveRepository) GetArchive(vendor, chatType string) (*Archive, error) {
+	archives, err := r.getArchives(`SELECT id, vendor, chat_type, master_chat FROM archive
+		WHERE vendor = ? AND chat_type IN (?, '')
+		ORDER BY chat_type DESC LIMIT 1;`,
+		vendor, chatType,
+	)
+	if err != nil || len(archives) == 0 {
+		return nil, err
+	}
+	return archives[0], nil
+}
+
+func (r *sqlArchiveRepository) SetArchive(a *Archive) error {
+	_, err := r.exec(`INSERT INTO archive (vendor, chat_type, master_chat) VALUES (?, ?, ?)
+		ON CONFLICT(vendor, chat_type) DO UPDATE SET master_chat = excluded.master_chat;`,
+		a.Vendor, a.ChatType, a.MasterChat,
+	)
+	return err
+}
+
+func (r *sqlArchiveRepository) SeedArchive(a *Archive) error {
+	res, err := r.exec(`INSERT INTO archive_seed (vendor, chat_type, master_chat) VALUES (?, ?, ?)
+		ON CONFLICT(vendor, chat_type, master_chat) DO NOTHING;`,
+		a.Vendor, a.ChatType, a.MasterChat,
+	)
+	if err != nil {
+		return err
+	}
+	if seeded, err := res.RowsAffected(); err != nil || seeded == 0 {
+		return err
+	}
+
+	_, err = r.exec(`INSERT INTO archive (vendor, chat_type, master_chat) VALUES (?, ?, ?)
+		ON CONFLICT(vendor, chat_type) DO NOTHING;`,
+		a.Vendor, a.ChatType, a.MasterChat,
+	)
+	return err
+}
+
+func (r *sqlArchiveRepository) DelArchiveById(id int64) error {
+	_, err := r.exec(`DELETE FROM archive WHERE id = ?;`, id)
+	return err
+}
+
+func (r *sqlArchiveRepository) getArchives(query string, args ...any) ([]*Archive, error) {
+	archives := []*Archive{}
+
+	rows, err := r.query(query, args...)
+	if err != nil {
+		return archives, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		a := &Archive{}
+		if err := rows.Scan(&a.ID, &a.Vendor, &a.ChatType, &a.MasterChat); err != nil {
+			return archives, err
+		}
+		archives = append(archives, a)
+	}
+	if err = rows.Err(); err != nil {
+		return archives, err
+	}
+
+	return archives, nil
+}
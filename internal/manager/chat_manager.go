@@ -1,56 +1,160 @@
 package manager
 
 import (
-	"database/sql"
+	"fmt"
+	"time"
 
-	"github.com/duo/octopus/internal/db"
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/metrics"
 )
 
-func init() {
-	if _, err := db.DB.Exec(`BEGIN;
-		CREATE TABLE IF NOT EXISTS chat (
-			id INTEGER PRIMARY KEY,
-			limb TEXT NOT NULL,
-			chat_type TEXT NOT NULL,
-			title TEXT NOT NULL,
-			UNIQUE(limb)
-		);
-		CREATE INDEX IF NOT EXISTS idx_title ON chat (title);
-		COMMIT;`); err != nil {
-		panic(err)
-	}
-}
-
 type Chat struct {
 	ID       int64
 	Limb     string
 	ChatType string
 	Title    string
+	Active   bool
+}
+
+type UpsertResult struct {
+	Inserted  int
+	Updated   int
+	Unchanged int
+}
+
+type ChatRepository interface {
+	UpsertChats(chats []*Chat) (*UpsertResult, error)
+	DeactivateChats(limbs []string) error
+	GetChat(limb string) (*Chat, error)
+	GetChatCount(query string) (int, error)
+	GetChatList(pageNum, pageSize int, query string) ([]*Chat, error)
+	GetChatsByVendor(vendor string) ([]*Chat, error)
+	GetChatVendors() ([]string, error)
 }
 
 func AddOrUpdateChat(c *Chat) error {
-	rows, err := db.DB.Query(`SELECT * FROM chat WHERE limb = ?;`, c.Limb)
+	_, err := store.Chats.UpsertChats([]*Chat{c})
+	return err
+}
+
+// insert or update chats in one transaction, reactivate removed chats
+func UpsertChats(chats []*Chat) (*UpsertResult, error) {
+	return store.Chats.UpsertChats(chats)
+}
+
+// mark chats as inactive in one transaction
+func DeactivateChats(limbs []string) error {
+	return store.Chats.DeactivateChats(limbs)
+}
+
+func GetChat(limb string) (*Chat, error) {
+	return store.Chats.GetChat(limb)
+}
+
+func GetChatCount(query string) (int, error) {
+	return store.Chats.GetChatCount(query)
+}
+
+func GetChatList(pageNum, pageSize int, query string) ([]*Chat, error) {
+	return store.Chats.GetChatList(pageNum, pageSize, query)
+}
+
+// get all chats (including inactive) of vendor
+func GetChatsByVendor(vendor string) ([]*Chat, error) {
+	return store.Chats.GetChatsByVendor(vendor)
+}
+
+// get vendors which have synced chats
+func GetChatVendors() ([]string, error) {
+	return store.Chats.GetChatVendors()
+}
+
+type sqlChatRepository struct {
+	*sqlDB
+}
+
+func (r *sqlChatRepository) UpsertChats(chats []*Chat) (*UpsertResult, error) {
+	defer metrics.ObserveDBQuery("transaction", time.Now())
+
+	result := &UpsertResult{}
+
+	tx, err := r.conn.Begin()
 	if err != nil {
-		return err
+		return result, err
 	}
+	defer tx.Rollback()
 
-	hasNext := rows.Next()
-	rows.Close()
-	if hasNext {
-		if _, err := db.DB.Exec(`UPDATE chat SET title = ? WHERE limb = ?;`, c.Title, c.Limb); err != nil {
-			return err
+	existStmt, err := tx.Prepare(r.rebind(`SELECT count(*) FROM chat WHERE limb = ?;`))
+	if err != nil {
+		return result, err
+	}
+	defer existStmt.Close()
+
+	upsertStmt, err := tx.Prepare(r.rebind(`INSERT INTO chat (limb, chat_type, title, active)
+		VALUES (?, ?, ?, 1)
+		ON CONFLICT(limb) DO UPDATE SET
+			chat_type = excluded.chat_type,
+			title = excluded.title,
+			active = 1
+		WHERE chat.chat_type != excluded.chat_type OR chat.title != excluded.title OR chat.active != 1;`))
+	if err != nil {
+		return result, err
+	}
+	defer upsertStmt.Close()
+
+	for _, c := range chats {
+		var exists int
+		if err := existStmt.QueryRow(c.Limb).Scan(&exists); err != nil {
+			return result, err
 		}
-	} else {
-		if _, err := db.DB.Exec(`INSERT INTO chat (limb, chat_type, title) VALUES (?, ?, ?);`, c.Limb, c.ChatType, c.Title); err != nil {
+
+		res, err := upsertStmt.Exec(c.Limb, c.ChatType, c.Title)
+		if err != nil {
+			return result, err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return result, err
+		}
+
+		if exists == 0 {
+			result.Inserted++
+		} else if affected > 0 {
+			result.Updated++
+		} else {
+			result.Unchanged++
+		}
+	}
+
+	return result, tx.Commit()
+}
+
+func (r *sqlChatRepository) DeactivateChats(limbs []string) error {
+	defer metrics.ObserveDBQuery("transaction", time.Now())
+
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(r.rebind(`UPDATE chat SET active = 0 WHERE limb = ?;`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, limb := range limbs {
+		if _, err := stmt.Exec(limb); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func GetChat(limb string) (*Chat, error) {
-	rows, err := db.DB.Query(`SELECT * FROM chat WHERE limb = ?;`, limb)
+func (r *sqlChatRepository) GetChat(limb string) (*Chat, error) {
+	rows, err := r.query(`SELECT id, limb, chat_type, title, active FROM chat WHERE limb = ?;`, limb)
 
 	if err != nil {
 		return nil, err
@@ -61,7 +165,7 @@ func GetChat(limb string) (*Chat, error) {
 	hasNext := rows.Next()
 	if hasNext {
 		c := &Chat{}
-		err = rows.Scan(&c.ID, &c.Limb, &c.ChatType, &c.Title)
+		err = rows.Scan(&c.ID, &c.Limb, &c.ChatType, &c.Title, &c.Active)
 		if err != nil {
 			return nil, err
 		}
@@ -72,48 +176,81 @@ func GetChat(limb string) (*Chat, error) {
 	return nil, nil
 }
 
-func GetChatCount(query string) (int, error) {
-	var rows *sql.Rows
+func (r *sqlChatRepository) GetChatCount(query string) (int, error) {
+	var count int
 	var err error
 	if len(query) > 0 {
-		rows, err = db.DB.Query(`SELECT count(*) FROM chat WHERE title LIKE ?;`, "%"+query+"%")
+		err = r.queryRow(
+			fmt.Sprintf(`SELECT count(*) FROM chat WHERE active = 1 AND title %s ?;`, r.like()),
+			"%"+query+"%",
+		).Scan(&count)
 	} else {
-		rows, err = db.DB.Query(`SELECT count(*) FROM chat;`)
+		err = r.queryRow(`SELECT count(*) FROM chat WHERE active = 1;`).Scan(&count)
+	}
+
+	return count, err
+}
+
+func (r *sqlChatRepository) GetChatList(pageNum, pageSize int, query string) ([]*Chat, error) {
+	offset := pageSize * (pageNum - 1)
+	if len(query) > 0 {
+		return r.getChats(
+			fmt.Sprintf(`SELECT id, limb, chat_type, title, active FROM chat
+				WHERE active = 1 AND title %s ?
+				ORDER BY id
+				LIMIT ? OFFSET ?;`, r.like()),
+			"%"+query+"%", pageSize, offset,
+		)
 	}
+	return r.getChats(`SELECT id, limb, chat_type, title, active FROM chat
+		WHERE active = 1
+		ORDER BY id
+		LIMIT ? OFFSET ?;`,
+		pageSize, offset,
+	)
+}
+
+func (r *sqlChatRepository) GetChatsByVendor(vendor string) ([]*Chat, error) {
+	return r.getChats(`SELECT id, limb, chat_type, title, active FROM chat WHERE limb LIKE ?;`, vendor+";%")
+}
+
+func (r *sqlChatRepository) GetChatVendors() ([]string, error) {
+	vendors := []string{}
+
+	rows, err := r.query(`SELECT limb FROM chat WHERE active = 1;`)
 	if err != nil {
-		return 0, err
+		return vendors, err
 	}
 
 	defer rows.Close()
 
-	hasNext := rows.Next()
-	if hasNext {
-		var count int
-		err = rows.Scan(&count)
+	seen := map[string]bool{}
+	for rows.Next() {
+		var limb string
+		if err := rows.Scan(&limb); err != nil {
+			return vendors, err
+		}
+		l, err := common.LimbFromString(limb)
 		if err != nil {
-			return 0, err
+			continue
+		}
+		vendor := common.Vendor{Type: l.Type, UID: l.UID}.String()
+		if !seen[vendor] {
+			seen[vendor] = true
+			vendors = append(vendors, vendor)
 		}
-
-		return count, err
+	}
+	if err = rows.Err(); err != nil {
+		return vendors, err
 	}
 
-	return 0, nil
+	return vendors, nil
 }
 
-func GetChatList(pageNum, pageSize int, query string) ([]*Chat, error) {
+func (r *sqlChatRepository) getChats(query string, args ...any) ([]*Chat, error) {
 	chats := []*Chat{}
 
-	offset := pageSize * (pageNum - 1)
-	var rows *sql.Rows
-	var err error
-	if len(query) > 0 {
-		rows, err = db.DB.Query(`SELECT * FROM chat
-			WHERE title LIKE ?
-			LIMIT ?,?;`,
-			"%"+query+"%", offset, pageSize)
-	} else {
-		rows, err = db.DB.Query(`SELECT * FROM chat LIMIT ?,?;`, offset, pageSize)
-	}
+	rows, err := r.query(query, args...)
 	if err != nil {
 		return chats, err
 	}
@@ -122,7 +259,7 @@ func GetChatList(pageNum, pageSize int, query string) ([]*Chat, error) {
 
 	for rows.Next() {
 		c := &Chat{}
-		if err := rows.Scan(&c.ID, &c.Limb, &c.ChatType, &c.Title); err != nil {
+		if err := rows.Scan(&c.ID, &c.Limb, &c.ChatType, &c.Title, &c.Active); err != nil {
 			return chats, err
 		}
 		chats = append(chats, c)
@@ -0,0 +1,182 @@
+package manager
+
+import (
+	"github.com/duo/octopus/internal/common"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// events left in channels or arriving during shutdown, replayed on next start
+	QueueShutdownIn  = "shutdown:slave_to_master"
+	QueueShutdownOut = "shutdown:master_to_slave"
+
+	// events over memory budget of a message channel
+	queueSpillPrefix = "spill:"
+)
+
+type QueuedEvent struct {
+	ID      int64
+	Queue   string
+	Vendor  string
+	Payload []byte
+}
+
+type EventQueueRepository interface {
+	PushEvent(queue, vendor string, payload []byte) error
+	GetQueuedEvents(queue, vendor string, limit int) ([]*QueuedEvent, error)
+	GetQueuedEventsAfter(queue string, after int64, limit int) ([]*QueuedEvent, error)
+	DelQueuedEvent(id int64) error
+	DelQueuedEventsUpTo(queue string, id int64) error
+	GetQueuedCount(queue string) (int, error)
+}
+
+func PushEvent(queue, vendor string, payload []byte) error {
+	return store.EventQueue.PushEvent(queue, vendor, payload)
+}
+
+// get oldest events of queue, all vendors if vendor is empty
+func GetQueuedEvents(queue, vendor string, limit int) ([]*QueuedEvent, error) {
+	return store.EventQueue.GetQueuedEvents(queue, vendor, limit)
+}
+
+func DelQueuedEvent(id int64) error {
+	return store.EventQueue.DelQueuedEvent(id)
+}
+
+func GetQueuedCount(queue string) (int, error) {
+	return store.EventQueue.GetQueuedCount(queue)
+}
+
+// EventSpill spill queue of message channel kept in database, used by run loop of the channel
+type EventSpill struct {
+	queue  string
+	cursor int64   // last row returned by Peek
+	loaded []int64 // rows of events returned by Peek, not acknowledged yet
+}
+
+func NewEventSpill(name string) *EventSpill {
+	return &EventSpill{queue: queueSpillPrefix + name}
+}
+
+func (s *EventSpill) Push(event *common.OctopusEvent) error {
+	payload, err := common.EncodeEvent(event)
+	if err != nil {
+		return err
+	}
+	return store.EventQueue.PushEvent(s.queue, event.Vendor.String(), payload)
+}
+
+// Peek return oldest events not returned yet, they stay in database until acknowledged
+func (s *EventSpill) Peek(limit int) ([]*common.OctopusEvent, error) {
+	for {
+		queued, err := store.EventQueue.GetQueuedEventsAfter(s.queue, s.cursor, limit)
+		if err != nil || len(queued) == 0 {
+			return nil, err
+		}
+		s.cursor = queued[len(queued)-1].ID
+
+		events := make([]*common.OctopusEvent, 0, len(queued))
+		for _, q := range queued {
+			event, err := common.DecodeEvent(q.Payload)
+			if err != nil {
+				// removed along with events after it
+				log.Warnf("Failed to decode spilled event %d: %v", q.ID, err)
+				continue
+			}
+			events = append(events, event)
+			s.loaded = append(s.loaded, q.ID)
+		}
+		if len(events) > 0 {
+			return events, nil
+		}
+	}
+}
+
+// Ack remove oldest count events returned by Peek
+func (s *EventSpill) Ack(count int) error {
+	count = min(count, len(s.loaded))
+	if count == 0 {
+		return nil
+	}
+	if err := store.EventQueue.DelQueuedEventsUpTo(s.queue, s.loaded[count-1]); err != nil {
+		return err
+	}
+	s.loaded = s.loaded[count:]
+	return nil
+}
+
+func (s *EventSpill) Len() (int, error) {
+	return store.EventQueue.GetQueuedCount(s.queue)
+}
+
+type sqlEventQueueRepository struct {
+	*sqlDB
+}
+
+func (r *sqlEventQueueRepository) PushEvent(queue, vendor string, payload []byte) error {
+	_, err := r.exec(`INSERT INTO event_queue (queue, vendor, payload) VALUES (?, ?, ?);`,
+		queue, vendor, payload,
+	)
+	return err
+}
+
+func (r *sqlEventQueueRepository) GetQueuedEvents(queue, vendor string, limit int) ([]*QueuedEvent, error) {
+	query := `SELECT id, queue, vendor, payload FROM event_queue WHERE queue = ?`
+	args := []any{queue}
+	if vendor != "" {
+		query += ` AND vendor = ?`
+		args = append(args, vendor)
+	}
+	query += ` ORDER BY id LIMIT ?;`
+	args = append(args, limit)
+
+	return r.getQueuedEvents(query, args...)
+}
+
+func (r *sqlEventQueueRepository) GetQueuedEventsAfter(queue string, after int64, limit int) ([]*QueuedEvent, error) {
+	return r.getQueuedEvents(`SELECT id, queue, vendor, payload FROM event_queue
+		WHERE queue = ? AND id > ? ORDER BY id LIMIT ?;`,
+		queue, after, limit,
+	)
+}
+
+func (r *sqlEventQueueRepository) getQueuedEvents(query string, args ...any) ([]*QueuedEvent, error) {
+	events := []*QueuedEvent{}
+
+	rows, err := r.query(query, args...)
+	if err != nil {
+		return events, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		e := &QueuedEvent{}
+		if err := rows.Scan(&e.ID, &e.Queue, &e.Vendor, &e.Payload); err != nil {
+			return events, err
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return events, err
+	}
+
+	return events, nil
+}
+
+func (r *sqlEventQueueRepository) DelQueuedEvent(id int64) error {
+	_, err := r.exec(`DELETE FROM event_queue WHERE id = ?;`, id)
+	return err
+}
+
+func (r *sqlEventQueueRepository) DelQueuedEventsUpTo(queue string, id int64) error {
+	_, err := r.exec(`DELETE FROM event_queue WHERE queue = ? AND id <= ?;`, queue, id)
+	return err
+}
+
+func (r *sqlEventQueueRepository) GetQueuedCount(queue string) (int, error) {
+	var count int
+	err := r.queryRow(`SELECT count(*) FROM event_queue WHERE queue = ?;`, queue).Scan(&count)
+	return count, err
+}
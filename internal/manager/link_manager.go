@@ -1,22 +1,5 @@
 package manager
 
-import (
-	"github.com/duo/octopus/internal/db"
-)
-
-func init() {
-	if _, err := db.DB.Exec(`BEGIN;
-		CREATE TABLE IF NOT EXISTS link (
-			id INTEGER PRIMARY KEY,
-			master_limb TEXT NOT NULL,
-			slave_limb TEXT NOT NULL,
-			UNIQUE(master_limb, slave_limb)
-		);
-		COMMIT;`); err != nil {
-		panic(err)
-	}
-}
-
 type Link struct {
 	ID         int64
 	MasterLimb string
@@ -24,73 +7,79 @@ type Link struct {
 	Title      string
 }
 
+type LinkRepository interface {
+	GetLinkList() ([]*Link, error)
+	GetLinksByMaster(masterLimb string) ([]*Link, error)
+	GetLinksBySlave(slaveLimb string) ([]*Link, error)
+	AddLink(l *Link) error
+	DelLinkById(id int64) error
+}
+
 func GetLinkList() ([]*Link, error) {
-	links := []*Link{}
+	return store.Links.GetLinkList()
+}
 
-	rows, err := db.DB.Query(`SELECT
-		l.id, l.master_limb, l.slave_limb, c.title 
-		FROM link AS l LEFT JOIN chat AS c
-		ON l.slave_limb = c.limb;`)
-	if err != nil {
-		return links, err
-	}
+func GetLinksByMaster(masterLimb string) ([]*Link, error) {
+	return store.Links.GetLinksByMaster(masterLimb)
+}
 
-	defer rows.Close()
+func GetLinksBySlave(slaveLimb string) ([]*Link, error) {
+	return store.Links.GetLinksBySlave(slaveLimb)
+}
 
-	for rows.Next() {
-		l := &Link{}
-		if err := rows.Scan(&l.ID, &l.MasterLimb, &l.SlaveLimb, &l.Title); err != nil {
-			return links, err
-		}
-		links = append(links, l)
-	}
-	if err = rows.Err(); err != nil {
-		return links, err
-	}
+func AddLink(l *Link) error {
+	return store.Links.AddLink(l)
+}
 
-	return links, nil
+func DelLinkById(id int64) error {
+	return store.Links.DelLinkById(id)
 }
 
-func GetLinksByMaster(masterLimb string) ([]*Link, error) {
-	links := []*Link{}
+type sqlLinkRepository struct {
+	*sqlDB
+}
 
-	rows, err := db.DB.Query(`SELECT
-		l.id, l.master_limb, l.slave_limb, c.title 
+func (r *sqlLinkRepository) GetLinkList() ([]*Link, error) {
+	return r.getLinks(`SELECT
+		l.id, l.master_limb, l.slave_limb, COALESCE(c.title, '')
+		FROM link AS l LEFT JOIN chat AS c
+		ON l.slave_limb = c.limb;`)
+}
+
+func (r *sqlLinkRepository) GetLinksByMaster(masterLimb string) ([]*Link, error) {
+	return r.getLinks(`SELECT
+		l.id, l.master_limb, l.slave_limb, COALESCE(c.title, '')
 		FROM link AS l LEFT JOIN chat AS c
 		ON l.slave_limb = c.limb
 		WHERE l.master_limb = ?;`,
 		masterLimb,
 	)
-	if err != nil {
-		return links, err
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		l := &Link{}
-		if err := rows.Scan(&l.ID, &l.MasterLimb, &l.SlaveLimb, &l.Title); err != nil {
-			return links, err
-		}
-		links = append(links, l)
-	}
-	if err = rows.Err(); err != nil {
-		return links, err
-	}
-
-	return links, nil
 }
 
-func GetLinksBySlave(slaveLimb string) ([]*Link, error) {
-	links := []*Link{}
-
-	rows, err := db.DB.Query(`SELECT
-		l.id, l.master_limb, l.slave_limb, c.title 
+func (r *sqlLinkRepository) GetLinksBySlave(slaveLimb string) ([]*Link, error) {
+	return r.getLinks(`SELECT
+		l.id, l.master_limb, l.slave_limb, COALESCE(c.title, '')
 		FROM link AS l LEFT JOIN chat AS c
 		ON l.slave_limb = c.limb
 		WHERE l.slave_limb = ?;`,
 		slaveLimb,
 	)
+}
+
+func (r *sqlLinkRepository) AddLink(l *Link) error {
+	_, err := r.exec(`INSERT INTO link (master_limb, slave_limb) VALUES (?, ?);`, l.MasterLimb, l.SlaveLimb)
+	return err
+}
+
+func (r *sqlLinkRepository) DelLinkById(id int64) error {
+	_, err := r.exec(`DELETE FROM link WHERE id = ?;`, id)
+	return err
+}
+
+func (r *sqlLinkRepository) getLinks(query string, args ...any) ([]*Link, error) {
+	links := []*Link{}
+
+	rows, err := r.query(query, args...)
 	if err != nil {
 		return links, err
 	}
@@ -110,13 +99,3 @@ func GetLinksBySlave(slaveLimb string) ([]*Link, error) {
 
 	return links, nil
 }
-
-func AddLink(l *Link) error {
-	_, err := db.DB.Exec(`INSERT INTO link (master_limb, slave_limb) VALUES (?, ?);`, l.MasterLimb, l.SlaveLimb)
-	return err
-}
-
-func DelLinkById(id int64) error {
-	_, err := db.DB.Exec(`DELETE FROM link WHERE id = ?;`, id)
-	return err
-}
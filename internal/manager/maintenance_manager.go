@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/duo/octopus/internal/db"
+)
+
+type TableStats struct {
+	Name string
+	Rows int64
+	// size of table and its indexes in bytes
+	Size int64
+}
+
+type DatabaseStats struct {
+	Driver string
+	Size   int64
+	Tables []*TableStats
+}
+
+type MaintenanceRepository interface {
+	GetStats() (*DatabaseStats, error)
+	Vacuum() error
+	CheckWritable() error
+}
+
+func GetStats() (*DatabaseStats, error) {
+	return store.Maintenance.GetStats()
+}
+
+// reclaim space of deleted rows
+func Vacuum() error {
+	return store.Maintenance.Vacuum()
+}
+
+// check database accepts writes without changing anything
+func CheckWritable() error {
+	return store.Maintenance.CheckWritable()
+}
+
+type sqlMaintenanceRepository struct {
+	*sqlDB
+}
+
+func (r *sqlMaintenanceRepository) GetStats() (*DatabaseStats, error) {
+	stats := &DatabaseStats{Driver: r.driver}
+
+	sizeQuery := `SELECT COALESCE(SUM(pgsize), 0) FROM dbstat
+		WHERE name IN (SELECT name FROM sqlite_master WHERE tbl_name = ?);`
+	totalQuery := `SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size();`
+	if r.driver == db.DriverPostgres {
+		sizeQuery = `SELECT pg_total_relation_size(?::regclass);`
+		totalQuery = `SELECT pg_database_size(current_database());`
+	}
+
+	if err := r.queryRow(totalQuery).Scan(&stats.Size); err != nil {
+		return stats, err
+	}
+
+	for _, table := range db.Tables() {
+		t := &TableStats{Name: table}
+		if err := r.queryRow(fmt.Sprintf(`SELECT count(*) FROM %s;`, table)).Scan(&t.Rows); err != nil {
+			return stats, err
+		}
+		if err := r.queryRow(sizeQuery, table).Scan(&t.Size); err != nil {
+			return stats, err
+		}
+		stats.Tables = append(stats.Tables, t)
+	}
+
+	return stats, nil
+}
+
+func (r *sqlMaintenanceRepository) Vacuum() error {
+	if r.driver == db.DriverPostgres {
+		_, err := r.exec(`VACUUM ANALYZE;`)
+		return err
+	}
+
+	for _, query := range []string{
+		`PRAGMA wal_checkpoint(TRUNCATE);`,
+		`VACUUM;`,
+		`PRAGMA optimize;`,
+	} {
+		if _, err := r.exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqlMaintenanceRepository) CheckWritable() error {
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// a write statement takes the write lock even if no row matches
+	_, err = tx.Exec(`UPDATE schema_version SET version = version WHERE version < 0;`)
+	return err
+}
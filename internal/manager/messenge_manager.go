@@ -1,34 +1,15 @@
 package manager
 
 import (
-	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/duo/octopus/internal/common"
 	"github.com/duo/octopus/internal/db"
 )
 
-func init() {
-	if _, err := db.DB.Exec(`BEGIN;
-		CREATE TABLE IF NOT EXISTS message (
-			id INTEGER PRIMARY KEY,
-			master_limb TEXT NOT NULL,
-			master_msg_id TEXT NOT NULL,
-			master_msg_thread_id TEXT NOT NULL,
-			slave_limb TEXT NOT NULL,
-			slave_msg_id TEXT NOT NULL,
-			slave_sender TEXT NOT NULL,
-			content TEXT NOT NULL,
-			timestamp INTEGER NOT NULL,
-			created DATETIME DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(master_limb, master_msg_id)
-		);
-		CREATE INDEX IF NOT EXISTS idx_slave_reply ON message (slave_limb, timestamp);
-		CREATE INDEX IF NOT EXISTS idx_master_reply ON message (master_limb, master_msg_id);
-		COMMIT;`); err != nil {
-		panic(err)
-	}
-}
-
 type Message struct {
 	ID                string
 	MasterLimb        string
@@ -39,19 +20,88 @@ type Message struct {
 	SlaveSender       string
 	Content           string
 	Timestamp         int64
+	MediaType         string
+	MediaFileID       string
+	Created           time.Time
+	ChatTitle         string
+}
+
+// search terms, optionally scoped to master and/or slave chat
+type SearchQuery struct {
+	Terms      []string
+	MasterLimb string
+	SlaveLimb  string
+}
+
+// old messages of one slave chat, or all except excluded chats
+type PurgeQuery struct {
+	Before    time.Time
+	SlaveLimb string
+	Exclude   []string
+	Anonymize bool
+}
+
+type MessageRepository interface {
+	AddMessage(m *Message) error
+	GetMessageByMasterMsgId(masterLimb, masterMsgId string) (*Message, error)
+	GetMessagesBySlave(slaveLimb, slaveMsgId string) ([]*Message, error)
+	GetMessagesBySlaveReply(slaveLimb string, reply *common.ReplyInfo) ([]*Message, error)
+	GetSearchCount(q *SearchQuery) (int, error)
+	SearchMessages(q *SearchQuery, pageNum, pageSize int) ([]*Message, error)
+	GetExportMessages(slaveLimb string, from, to time.Time, afterID int64, limit int) ([]*Message, error)
+	PurgeMessages(q *PurgeQuery, limit int) (int64, error)
 }
 
 func AddMessage(m *Message) error {
-	_, err := db.DB.Exec(`INSERT INTO message
-		(master_limb, master_msg_id, master_msg_thread_id, slave_limb, slave_msg_id, slave_sender, content, timestamp)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?);`,
-		m.MasterLimb, m.MasterMsgID, m.MasterMsgThreadID, m.SlaveLimb, m.SlaveMsgID, m.SlaveSender, m.Content, m.Timestamp,
+	return store.Messages.AddMessage(m)
+}
+
+func GetMessageByMasterMsgId(masterLimb, masterMsgId string) (*Message, error) {
+	return store.Messages.GetMessageByMasterMsgId(masterLimb, masterMsgId)
+}
+
+func GetMessagesBySlave(slaveLimb, slaveMsgId string) ([]*Message, error) {
+	return store.Messages.GetMessagesBySlave(slaveLimb, slaveMsgId)
+}
+
+func GetMessagesBySlaveReply(slaveLimb string, reply *common.ReplyInfo) ([]*Message, error) {
+	return store.Messages.GetMessagesBySlaveReply(slaveLimb, reply)
+}
+
+func GetSearchCount(q *SearchQuery) (int, error) {
+	return store.Messages.GetSearchCount(q)
+}
+
+// search messages by content, newest first
+func SearchMessages(q *SearchQuery, pageNum, pageSize int) ([]*Message, error) {
+	return store.Messages.SearchMessages(q, pageNum, pageSize)
+}
+
+// get messages of slave chat created in [from, to) after id, oldest first
+func GetExportMessages(slaveLimb string, from, to time.Time, afterID int64, limit int) ([]*Message, error) {
+	return store.Messages.GetExportMessages(slaveLimb, from, to, afterID, limit)
+}
+
+// delete or anonymise a batch of old messages, return affected rows
+func PurgeMessages(q *PurgeQuery, limit int) (int64, error) {
+	return store.Messages.PurgeMessages(q, limit)
+}
+
+type sqlMessageRepository struct {
+	*sqlDB
+}
+
+func (r *sqlMessageRepository) AddMessage(m *Message) error {
+	_, err := r.exec(`INSERT INTO message
+		(master_limb, master_msg_id, master_msg_thread_id, slave_limb, slave_msg_id, slave_sender, content, timestamp, media_type, media_file_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		m.MasterLimb, m.MasterMsgID, m.MasterMsgThreadID, m.SlaveLimb, m.SlaveMsgID, m.SlaveSender, m.Content, m.Timestamp, m.MediaType, m.MediaFileID,
 	)
 	return err
 }
 
-func GetMessageByMasterMsgId(masterLimb, masterMsgId string) (*Message, error) {
-	rows, err := db.DB.Query(`SELECT id, master_limb, master_msg_id, master_msg_thread_id, slave_limb, slave_msg_id, slave_sender, content, timestamp
+func (r *sqlMessageRepository) GetMessageByMasterMsgId(masterLimb, masterMsgId string) (*Message, error) {
+	rows, err := r.query(`SELECT id, master_limb, master_msg_id, master_msg_thread_id, slave_limb, slave_msg_id, slave_sender, content, timestamp
 		FROM message
 		WHERE master_limb = ? AND master_msg_id = ?;`,
 		masterLimb, masterMsgId)
@@ -76,13 +126,32 @@ func GetMessageByMasterMsgId(masterLimb, masterMsgId string) (*Message, error) {
 	return nil, nil
 }
 
-func GetMessagesBySlave(slaveLimb, slaveMsgId string) ([]*Message, error) {
-	messages := []*Message{}
-
-	rows, err := db.DB.Query(`SELECT id, master_limb, master_msg_id, master_msg_thread_id, slave_limb, slave_msg_id, content
+func (r *sqlMessageRepository) GetMessagesBySlave(slaveLimb, slaveMsgId string) ([]*Message, error) {
+	return r.getMessages(`SELECT id, master_limb, master_msg_id, master_msg_thread_id, slave_limb, slave_msg_id, slave_sender, content
 		FROM message
 		WHERE slave_limb = ? AND slave_msg_id = ?;`,
 		slaveLimb, slaveMsgId)
+}
+
+func (r *sqlMessageRepository) GetMessagesBySlaveReply(slaveLimb string, reply *common.ReplyInfo) ([]*Message, error) {
+	if reply.Timestamp == 0 {
+		return r.getMessages(`SELECT id, master_limb, master_msg_id, master_msg_thread_id, slave_limb, slave_msg_id, slave_sender, content
+		FROM message
+		WHERE slave_limb = ? AND slave_msg_id = ?;`,
+			slaveLimb, reply.ID)
+	}
+
+	// TODO: back search?
+	return r.getMessages(`SELECT id, master_limb, master_msg_id, master_msg_thread_id, slave_limb, slave_msg_id, slave_sender, content
+		FROM message
+		WHERE slave_limb = ? AND timestamp = ? AND slave_msg_id LIKE ?;`,
+		slaveLimb, reply.Timestamp, reply.ID+"%")
+}
+
+func (r *sqlMessageRepository) getMessages(query string, args ...any) ([]*Message, error) {
+	messages := []*Message{}
+
+	rows, err := r.query(query, args...)
 	if err != nil {
 		return messages, err
 	}
@@ -91,7 +160,7 @@ func GetMessagesBySlave(slaveLimb, slaveMsgId string) ([]*Message, error) {
 
 	for rows.Next() {
 		m := &Message{}
-		err := rows.Scan(&m.ID, &m.MasterLimb, &m.MasterMsgID, &m.MasterMsgThreadID, &m.SlaveLimb, &m.SlaveMsgID, &m.Content)
+		err := rows.Scan(&m.ID, &m.MasterLimb, &m.MasterMsgID, &m.MasterMsgThreadID, &m.SlaveLimb, &m.SlaveMsgID, &m.SlaveSender, &m.Content)
 		if err != nil {
 			return messages, err
 		}
@@ -104,23 +173,61 @@ func GetMessagesBySlave(slaveLimb, slaveMsgId string) ([]*Message, error) {
 	return messages, nil
 }
 
-func GetMessagesBySlaveReply(slaveLimb string, reply *common.ReplyInfo) ([]*Message, error) {
+func (r *sqlMessageRepository) GetSearchCount(q *SearchQuery) (int, error) {
+	where, args := r.searchCondition(q)
+
+	var count int
+	err := r.queryRow(`SELECT count(*) FROM message AS m WHERE `+where+`;`, args...).Scan(&count)
+	return count, err
+}
+
+func (r *sqlMessageRepository) SearchMessages(q *SearchQuery, pageNum, pageSize int) ([]*Message, error) {
 	messages := []*Message{}
 
-	var rows *sql.Rows
-	var err error
-	if reply.Timestamp == 0 {
-		rows, err = db.DB.Query(`SELECT id, master_limb, master_msg_id, master_msg_thread_id, slave_limb, slave_msg_id, content
-		FROM message
-		WHERE slave_limb = ? AND slave_msg_id = ?;`,
-			slaveLimb, reply.ID)
-	} else {
-		// TODO: back search?
-		rows, err = db.DB.Query(`SELECT id, master_limb, master_msg_id, master_msg_thread_id, slave_limb, slave_msg_id, content
-		FROM message
-		WHERE slave_limb = ? AND timestamp = ? AND slave_msg_id LIKE ?;`,
-			slaveLimb, reply.Timestamp, reply.ID+"%")
+	where, args := r.searchCondition(q)
+	args = append(args, pageSize, pageSize*(pageNum-1))
+
+	rows, err := r.query(`SELECT
+		m.id, m.master_limb, m.master_msg_id, m.master_msg_thread_id, m.slave_limb, m.slave_msg_id, m.slave_sender, m.content, m.timestamp, COALESCE(c.title, '')
+		FROM message AS m LEFT JOIN chat AS c
+		ON m.slave_limb = c.limb
+		WHERE `+where+`
+		ORDER BY m.id DESC
+		LIMIT ? OFFSET ?;`,
+		args...,
+	)
+	if err != nil {
+		return messages, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		m := &Message{}
+		err := rows.Scan(&m.ID, &m.MasterLimb, &m.MasterMsgID, &m.MasterMsgThreadID, &m.SlaveLimb, &m.SlaveMsgID, &m.SlaveSender, &m.Content, &m.Timestamp, &m.ChatTitle)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, m)
 	}
+	if err = rows.Err(); err != nil {
+		return messages, err
+	}
+
+	return messages, nil
+}
+
+func (r *sqlMessageRepository) GetExportMessages(slaveLimb string, from, to time.Time, afterID int64, limit int) ([]*Message, error) {
+	messages := []*Message{}
+
+	rows, err := r.query(`SELECT
+		id, master_limb, master_msg_id, master_msg_thread_id, slave_limb, slave_msg_id, slave_sender, content, timestamp, media_type, media_file_id, created
+		FROM message
+		WHERE slave_limb = ? AND id > ? AND created >= ? AND created < ?
+		ORDER BY id
+		LIMIT ?;`,
+		slaveLimb, afterID, formatCreated(from), formatCreated(to), limit,
+	)
 	if err != nil {
 		return messages, err
 	}
@@ -129,7 +236,7 @@ func GetMessagesBySlaveReply(slaveLimb string, reply *common.ReplyInfo) ([]*Mess
 
 	for rows.Next() {
 		m := &Message{}
-		err := rows.Scan(&m.ID, &m.MasterLimb, &m.MasterMsgID, &m.MasterMsgThreadID, &m.SlaveLimb, &m.SlaveMsgID, &m.Content)
+		err := rows.Scan(&m.ID, &m.MasterLimb, &m.MasterMsgID, &m.MasterMsgThreadID, &m.SlaveLimb, &m.SlaveMsgID, &m.SlaveSender, &m.Content, &m.Timestamp, &m.MediaType, &m.MediaFileID, &m.Created)
 		if err != nil {
 			return messages, err
 		}
@@ -141,3 +248,86 @@ func GetMessagesBySlaveReply(slaveLimb string, reply *common.ReplyInfo) ([]*Mess
 
 	return messages, nil
 }
+
+func (r *sqlMessageRepository) PurgeMessages(q *PurgeQuery, limit int) (int64, error) {
+	conditions := []string{`created < ?`}
+	args := []any{formatCreated(q.Before)}
+
+	if q.SlaveLimb != "" {
+		conditions = append(conditions, `slave_limb = ?`)
+		args = append(args, q.SlaveLimb)
+	}
+	if len(q.Exclude) > 0 {
+		conditions = append(conditions,
+			`slave_limb NOT IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(q.Exclude)), ", ")+`)`)
+		for _, limb := range q.Exclude {
+			args = append(args, limb)
+		}
+	}
+	args = append(args, limit)
+
+	// anonymised rows keep the id mapping for replies
+	query := `DELETE FROM message`
+	if q.Anonymize {
+		query = `UPDATE message SET slave_sender = '', content = '', media_type = '', media_file_id = ''`
+		conditions = append(conditions, `(slave_sender != '' OR content != '' OR media_file_id != '')`)
+	}
+
+	res, err := r.exec(query+` WHERE id IN (
+		SELECT id FROM message
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY id
+		LIMIT ?);`,
+		args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// created is filled by CURRENT_TIMESTAMP in UTC
+func formatCreated(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// full-text condition of backend, trigram index can't match terms shorter than 3 characters
+func (r *sqlMessageRepository) searchCondition(q *SearchQuery) (string, []any) {
+	conditions := []string{}
+	args := []any{}
+
+	// postgres matches substrings by ILIKE, accelerated by pg_trgm index
+	if r.driver != db.DriverPostgres && isTrigramSearchable(q.Terms) {
+		phrases := make([]string, 0, len(q.Terms))
+		for _, term := range q.Terms {
+			phrases = append(phrases, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+		}
+		conditions = append(conditions, `m.id IN (SELECT rowid FROM message_fts WHERE message_fts MATCH ?)`)
+		args = append(args, strings.Join(phrases, " AND "))
+	} else {
+		for _, term := range q.Terms {
+			conditions = append(conditions, fmt.Sprintf(`m.content %s ?`, r.like()))
+			args = append(args, "%"+term+"%")
+		}
+	}
+
+	if q.MasterLimb != "" {
+		conditions = append(conditions, `m.master_limb = ?`)
+		args = append(args, q.MasterLimb)
+	}
+	if q.SlaveLimb != "" {
+		conditions = append(conditions, `m.slave_limb = ?`)
+		args = append(args, q.SlaveLimb)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+func isTrigramSearchable(terms []string) bool {
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < 3 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package manager
+
+// notification levels of slave chat
+const (
+	NotifyAll      = "all"
+	NotifyMentions = "mentions" // notify only when mentioned or replied
+	NotifySilent   = "silent"
+	NotifyMuted    = "muted" // logged but not sent to Telegram
+)
+
+var NotifyLevels = []string{NotifyAll, NotifyMentions, NotifySilent, NotifyMuted}
+
+type NotifyRepository interface {
+	GetNotifyLevel(limb string) (string, error)
+	GetNotifyLevels() (map[string]string, error)
+	SetNotifyLevel(limb, level string) error
+}
+
+// get notification level of slave chat, NotifyAll if not set
+func GetNotifyLevel(limb string) (string, error) {
+	return store.Notify.GetNotifyLevel(limb)
+}
+
+// get levels of chats not notified by default
+func GetNotifyLevels() (map[string]string, error) {
+	return store.Notify.GetNotifyLevels()
+}
+
+func SetNotifyLevel(limb, level string) error {
+	return store.Notify.SetNotifyLevel(limb, level)
+}
+
+type sqlNotifyRepository struct {
+	*sqlDB
+}
+
+func (r *sqlNotifyRepository) GetNotifyLevel(limb string) (string, error) {
+	rows, err := r.query(`SELECT level FROM notify_level WHERE limb = ?;`, limb)
+	if err != nil {
+		return NotifyAll, err
+	}
+
+	defer rows.Close()
+
+	level := NotifyAll
+	if rows.Next() {
+		if err := rows.Scan(&level); err != nil {
+			return NotifyAll, err
+		}
+	}
+
+	return level, rows.Err()
+}
+
+func (r *sqlNotifyRepository) GetNotifyLevels() (map[string]string, error) {
+	levels := map[string]string{}
+
+	rows, err := r.query(`SELECT limb, level FROM notify_level;`)
+	if err != nil {
+		return levels, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var limb, level string
+		if err := rows.Scan(&limb, &level); err != nil {
+			return levels, err
+		}
+		levels[limb] = level
+	}
+	if err = rows.Err(); err != nil {
+		return levels, err
+	}
+
+	return levels, nil
+}
+
+// default level is not stored
+func (r *sqlNotifyRepository) SetNotifyLevel(limb, level string) error {
+	if level == NotifyAll {
+		_, err := r.exec(`DELETE FROM notify_level WHERE limb = ?;`, limb)
+		return err
+	}
+
+	_, err := r.exec(`INSERT INTO notify_level (limb, level) VALUES (?, ?)
+		ON CONFLICT(limb) DO UPDATE SET level = excluded.level, updated = CURRENT_TIMESTAMP;`,
+		limb, level,
+	)
+	return err
+}
@@ -0,0 +1,82 @@
+package manager
+
+const (
+	RequestPending  = "pending"
+	RequestApproved = "approved"
+	RequestRejected = "rejected"
+	RequestIgnored  = "ignored"
+	RequestFailed   = "failed"
+)
+
+type Request struct {
+	ID          int64
+	Vendor      string
+	RequestType string
+	SubType     string
+	Flag        string
+	UserID      string
+	GroupID     string
+	Comment     string
+	Status      string
+	Result      string
+}
+
+type RequestRepository interface {
+	AddRequest(r *Request) error
+	GetRequest(id int64) (*Request, error)
+	UpdateRequestStatus(id int64, status, result string) error
+}
+
+func AddRequest(r *Request) error {
+	return store.Requests.AddRequest(r)
+}
+
+func GetRequest(id int64) (*Request, error) {
+	return store.Requests.GetRequest(id)
+}
+
+func UpdateRequestStatus(id int64, status, result string) error {
+	return store.Requests.UpdateRequestStatus(id, status, result)
+}
+
+type sqlRequestRepository struct {
+	*sqlDB
+}
+
+func (s *sqlRequestRepository) AddRequest(r *Request) error {
+	return s.queryRow(`INSERT INTO request
+		(vendor, request_type, sub_type, flag, user_id, group_id, comment, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id;`,
+		r.Vendor, r.RequestType, r.SubType, r.Flag, r.UserID, r.GroupID, r.Comment, r.Status,
+	).Scan(&r.ID)
+}
+
+func (s *sqlRequestRepository) GetRequest(id int64) (*Request, error) {
+	rows, err := s.query(`SELECT id, vendor, request_type, sub_type, flag, user_id, group_id, comment, status, result
+		FROM request
+		WHERE id = ?;`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	hasNext := rows.Next()
+	if hasNext {
+		r := &Request{}
+		err = rows.Scan(&r.ID, &r.Vendor, &r.RequestType, &r.SubType, &r.Flag, &r.UserID, &r.GroupID, &r.Comment, &r.Status, &r.Result)
+		if err != nil {
+			return nil, err
+		}
+
+		return r, err
+	}
+
+	return nil, nil
+}
+
+func (s *sqlRequestRepository) UpdateRequestStatus(id int64, status, result string) error {
+	_, err := s.exec(`UPDATE request SET status = ?, result = ?, updated = CURRENT_TIMESTAMP WHERE id = ?;`, status, result, id)
+	return err
+}
@@ -0,0 +1,123 @@
+package manager
+
+// actions of rule
+const (
+	RuleDrop  = "drop"  // discard event
+	RuleMute  = "mute"  // logged but not sent to Telegram
+	RuleTag   = "tag"   // prefix title with hashtag of target
+	RuleRoute = "route" // send to Telegram chat of target instead
+)
+
+var RuleActions = []string{RuleDrop, RuleMute, RuleTag, RuleRoute}
+
+// Rule matches incoming events of slave, empty condition matches any
+type Rule struct {
+	ID        int64
+	Priority  int
+	Vendor    string // vendor type or type;uid
+	Chat      string // chat id or limb
+	Sender    string
+	EventType string
+	Pattern   string // regexp of content
+	Action    string
+	Target    string
+	Enabled   bool
+}
+
+type RuleRepository interface {
+	GetRuleList() ([]*Rule, error)
+	GetRuleById(id int64) (*Rule, error)
+	AddRule(rule *Rule) error
+	SetRuleEnabled(id int64, enabled bool) error
+	DelRuleById(id int64) error
+}
+
+// get all rules in order of evaluation
+func GetRuleList() ([]*Rule, error) {
+	return store.Rules.GetRuleList()
+}
+
+func GetRuleById(id int64) (*Rule, error) {
+	return store.Rules.GetRuleById(id)
+}
+
+func AddRule(rule *Rule) error {
+	return store.Rules.AddRule(rule)
+}
+
+func SetRuleEnabled(id int64, enabled bool) error {
+	return store.Rules.SetRuleEnabled(id, enabled)
+}
+
+func DelRuleById(id int64) error {
+	return store.Rules.DelRuleById(id)
+}
+
+type sqlRuleRepository struct {
+	*sqlDB
+}
+
+func (r *sqlRuleRepository) GetRuleList() ([]*Rule, error) {
+	return r.getRules(`SELECT id, priority, vendor, chat, sender, event_type, pattern, action, target, enabled
+		FROM rule ORDER BY priority DESC, id;`)
+}
+
+func (r *sqlRuleRepository) GetRuleById(id int64) (*Rule, error) {
+	rules, err := r.getRules(`SELECT id, priority, vendor, chat, sender, event_type, pattern, action, target, enabled
+		FROM rule WHERE id = ?;`,
+		id,
+	)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+	return rules[0], nil
+}
+
+func (r *sqlRuleRepository) AddRule(rule *Rule) error {
+	_, err := r.exec(`INSERT INTO rule (priority, vendor, chat, sender, event_type, pattern, action, target, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1);`,
+		rule.Priority, rule.Vendor, rule.Chat, rule.Sender, rule.EventType, rule.Pattern, rule.Action, rule.Target,
+	)
+	return err
+}
+
+func (r *sqlRuleRepository) SetRuleEnabled(id int64, enabled bool) error {
+	value := 0
+	if enabled {
+		value = 1
+	}
+	_, err := r.exec(`UPDATE rule SET enabled = ? WHERE id = ?;`, value, id)
+	return err
+}
+
+func (r *sqlRuleRepository) DelRuleById(id int64) error {
+	_, err := r.exec(`DELETE FROM rule WHERE id = ?;`, id)
+	return err
+}
+
+func (r *sqlRuleRepository) getRules(query string, args ...any) ([]*Rule, error) {
+	rules := []*Rule{}
+
+	rows, err := r.query(query, args...)
+	if err != nil {
+		return rules, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		rule := &Rule{}
+		if err := rows.Scan(
+			&rule.ID, &rule.Priority, &rule.Vendor, &rule.Chat, &rule.Sender,
+			&rule.EventType, &rule.Pattern, &rule.Action, &rule.Target, &rule.Enabled,
+		); err != nil {
+			return rules, err
+		}
+		rules = append(rules, rule)
+	}
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
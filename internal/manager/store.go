@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/duo/octopus/internal/db"
+	"github.com/duo/octopus/internal/metrics"
+)
+
+// Store groups repositories of a storage backend
+type Store struct {
+	Chats    ChatRepository
+	Links    LinkRepository
+	Topics   TopicRepository
+	Messages MessageRepository
+	Requests RequestRepository
+	Archives ArchiveRepository
+	Notify   NotifyRepository
+	Rules    RuleRepository
+
+	Deliveries DeliveryRepository
+
+	EventQueue EventQueueRepository
+
+	Maintenance MaintenanceRepository
+}
+
+var store *Store
+
+// Init set the store used by package level functions
+func Init(s *Store) {
+	store = s
+}
+
+func NewSQLiteStore(conn *sql.DB) *Store {
+	return newSQLStore(&sqlDB{conn: conn, driver: db.DriverSQLite})
+}
+
+func NewPostgresStore(conn *sql.DB) *Store {
+	return newSQLStore(&sqlDB{conn: conn, driver: db.DriverPostgres})
+}
+
+func NewStore(driver string, conn *sql.DB) *Store {
+	if driver == db.DriverPostgres {
+		return NewPostgresStore(conn)
+	}
+	return NewSQLiteStore(conn)
+}
+
+func newSQLStore(s *sqlDB) *Store {
+	return &Store{
+		Chats:    &sqlChatRepository{s},
+		Links:    &sqlLinkRepository{s},
+		Topics:   &sqlTopicRepository{s},
+		Messages: &sqlMessageRepository{s},
+		Requests: &sqlRequestRepository{s},
+		Archives: &sqlArchiveRepository{s},
+		Notify:   &sqlNotifyRepository{s},
+		Rules:    &sqlRuleRepository{s},
+
+		Deliveries: &sqlDeliveryRepository{s},
+
+		EventQueue: &sqlEventQueueRepository{s},
+
+		Maintenance: &sqlMaintenanceRepository{s},
+	}
+}
+
+// sqlDB rewrites queries for the dialect of driver
+type sqlDB struct {
+	conn   *sql.DB
+	driver string
+}
+
+func (s *sqlDB) rebind(query string) string {
+	return db.Rebind(s.driver, query)
+}
+
+func (s *sqlDB) query(query string, args ...any) (*sql.Rows, error) {
+	defer metrics.ObserveDBQuery("query", time.Now())
+	return s.conn.Query(s.rebind(query), args...)
+}
+
+func (s *sqlDB) queryRow(query string, args ...any) *sql.Row {
+	defer metrics.ObserveDBQuery("query_row", time.Now())
+	return s.conn.QueryRow(s.rebind(query), args...)
+}
+
+func (s *sqlDB) exec(query string, args ...any) (sql.Result, error) {
+	defer metrics.ObserveDBQuery("exec", time.Now())
+	return s.conn.Exec(s.rebind(query), args...)
+}
+
+// case insensitive LIKE operator
+func (s *sqlDB) like() string {
+	if s.driver == db.DriverPostgres {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
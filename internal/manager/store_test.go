@@ -0,0 +1,467 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/db"
+)
+
+// DSN of an empty PostgreSQL database, its tables are truncated by the suite
+const postgresDSNEnv = "OCTOPUS_TEST_POSTGRES_DSN"
+
+var storeCases = []struct {
+	name string
+	run  func(t *testing.T, s *Store)
+}{
+	{"chats", testChats},
+	{"links", testLinks},
+	{"topics", testTopics},
+	{"messages", testMessages},
+	{"search", testSearch},
+	{"purge", testPurge},
+	{"requests", testRequests},
+	{"archives", testArchives},
+	{"notify", testNotify},
+	{"rules", testRules},
+	{"deliveries", testDeliveries},
+	{"event queue", testEventQueue},
+	{"maintenance", testMaintenance},
+}
+
+func TestSQLiteStore(t *testing.T) {
+	conn, err := db.Open(db.DriverSQLite, filepath.Join(t.TempDir(), "octopus.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	runStoreCases(t, NewSQLiteStore(conn))
+}
+
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", postgresDSNEnv)
+	}
+
+	conn, err := db.Open(db.DriverPostgres, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Exec(`TRUNCATE ` + strings.Join(db.Tables(), ", ") + ` RESTART IDENTITY;`); err != nil {
+		t.Fatal(err)
+	}
+
+	runStoreCases(t, NewPostgresStore(conn))
+}
+
+func runStoreCases(t *testing.T, s *Store) {
+	for _, c := range storeCases {
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, s)
+		})
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testChats(t *testing.T, s *Store) {
+	chats := []*Chat{
+		{Limb: "qq;1;100", ChatType: "group", Title: "Octopus Group"},
+		{Limb: "qq;1;200", ChatType: "private", Title: "Alice"},
+	}
+	result, err := s.Chats.UpsertChats(chats)
+	must(t, err)
+	if result.Inserted != 2 {
+		t.Errorf("inserted = %+v", result)
+	}
+
+	chats[0].Title = "Octopus"
+	result, err = s.Chats.UpsertChats(chats)
+	must(t, err)
+	if result.Updated != 1 || result.Unchanged != 1 {
+		t.Errorf("upsert again = %+v", result)
+	}
+
+	must(t, s.Chats.DeactivateChats([]string{"qq;1;200"}))
+	chat, err := s.Chats.GetChat("qq;1;200")
+	must(t, err)
+	if chat == nil || chat.Active {
+		t.Errorf("deactivated chat = %+v", chat)
+	}
+
+	count, err := s.Chats.GetChatCount("octo")
+	must(t, err)
+	if count != 1 {
+		t.Errorf("count of query = %d", count)
+	}
+	list, err := s.Chats.GetChatList(1, 10, "")
+	must(t, err)
+	if len(list) != 1 || list[0].Title != "Octopus" {
+		t.Errorf("active chats = %+v", list)
+	}
+	byVendor, err := s.Chats.GetChatsByVendor("qq;1")
+	must(t, err)
+	if len(byVendor) != 2 {
+		t.Errorf("chats of vendor = %d", len(byVendor))
+	}
+	vendors, err := s.Chats.GetChatVendors()
+	must(t, err)
+	if !slices.Equal(vendors, []string{"qq;1"}) {
+		t.Errorf("vendors = %v", vendors)
+	}
+
+	// removed chat comes back on sync
+	result, err = s.Chats.UpsertChats(chats[1:])
+	must(t, err)
+	if result.Updated != 1 {
+		t.Errorf("reactivate = %+v", result)
+	}
+}
+
+func testLinks(t *testing.T, s *Store) {
+	link := &Link{MasterLimb: "telegram;1;-100", SlaveLimb: "qq;1;300", Title: "Linked"}
+	must(t, s.Links.AddLink(link))
+
+	byMaster, err := s.Links.GetLinksByMaster(link.MasterLimb)
+	must(t, err)
+	bySlave, err := s.Links.GetLinksBySlave(link.SlaveLimb)
+	must(t, err)
+	if len(byMaster) != 1 || len(bySlave) != 1 || byMaster[0].ID != bySlave[0].ID {
+		t.Fatalf("links by master %+v, by slave %+v", byMaster, bySlave)
+	}
+
+	must(t, s.Links.DelLinkById(byMaster[0].ID))
+	list, err := s.Links.GetLinkList()
+	must(t, err)
+	if len(list) != 0 {
+		t.Errorf("links after delete = %+v", list)
+	}
+}
+
+func testTopics(t *testing.T, s *Store) {
+	topic := &Topic{MasterLimb: "telegram;1;-200", SlaveLimb: "qq;1;400", TopicID: "42"}
+	must(t, s.Topics.AddTopic(topic))
+
+	got, err := s.Topics.GetTopic(topic.MasterLimb, topic.SlaveLimb)
+	must(t, err)
+	if got == nil || got.TopicID != "42" {
+		t.Fatalf("topic = %+v", got)
+	}
+	byMaster, err := s.Topics.GetTopicByMaster(topic.MasterLimb, 42)
+	must(t, err)
+	if byMaster == nil || byMaster.ID != got.ID {
+		t.Errorf("topic by master = %+v", byMaster)
+	}
+	bySlave, err := s.Topics.GetTopicsBySlave(topic.SlaveLimb)
+	must(t, err)
+	if len(bySlave) != 1 {
+		t.Errorf("topics by slave = %+v", bySlave)
+	}
+
+	must(t, s.Topics.DelTopic(topic.MasterLimb, topic.SlaveLimb))
+	got, err = s.Topics.GetTopic(topic.MasterLimb, topic.SlaveLimb)
+	must(t, err)
+	if got != nil {
+		t.Errorf("topic after delete = %+v", got)
+	}
+
+	must(t, s.Topics.AddTopic(topic))
+	list, err := s.Topics.GetTopicList()
+	must(t, err)
+	if len(list) != 1 {
+		t.Fatalf("topics = %+v", list)
+	}
+	must(t, s.Topics.DelTopicById(list[0].ID))
+}
+
+func testMessages(t *testing.T, s *Store) {
+	m := &Message{
+		MasterLimb:  "telegram;1;1",
+		MasterMsgID: "10",
+		SlaveLimb:   "qq;1;500",
+		SlaveMsgID:  "abc123",
+		SlaveSender: "600",
+		Content:     "hello",
+		Timestamp:   1700000000,
+	}
+	must(t, s.Messages.AddMessage(m))
+
+	got, err := s.Messages.GetMessageByMasterMsgId(m.MasterLimb, m.MasterMsgID)
+	must(t, err)
+	if got == nil || got.SlaveMsgID != m.SlaveMsgID || got.Content != m.Content {
+		t.Fatalf("message by master = %+v", got)
+	}
+	bySlave, err := s.Messages.GetMessagesBySlave(m.SlaveLimb, m.SlaveMsgID)
+	must(t, err)
+	if len(bySlave) != 1 {
+		t.Errorf("messages by slave = %+v", bySlave)
+	}
+
+	byReply, err := s.Messages.GetMessagesBySlaveReply(m.SlaveLimb, &common.ReplyInfo{ID: m.SlaveMsgID})
+	must(t, err)
+	byPrefix, err := s.Messages.GetMessagesBySlaveReply(m.SlaveLimb, &common.ReplyInfo{ID: "abc", Timestamp: m.Timestamp})
+	must(t, err)
+	if len(byReply) != 1 || len(byPrefix) != 1 {
+		t.Errorf("messages by reply %+v, by timestamp and prefix %+v", byReply, byPrefix)
+	}
+
+	now := time.Now()
+	exported, err := s.Messages.GetExportMessages(m.SlaveLimb, now.Add(-time.Hour), now.Add(time.Hour), 0, 10)
+	must(t, err)
+	if len(exported) != 1 || exported[0].SlaveSender != m.SlaveSender {
+		t.Errorf("exported = %+v", exported)
+	}
+}
+
+func testSearch(t *testing.T, s *Store) {
+	slaveLimb := "qq;1;700"
+	_, err := s.Chats.UpsertChats([]*Chat{{Limb: slaveLimb, ChatType: "group", Title: "Search"}})
+	must(t, err)
+	for i, content := range []string{"hello octopus world", "今天天气不错啊", "nothing here"} {
+		must(t, s.Messages.AddMessage(&Message{
+			MasterLimb:  "telegram;1;1",
+			MasterMsgID: fmt.Sprint(100 + i),
+			SlaveLimb:   slaveLimb,
+			SlaveMsgID:  fmt.Sprint(i),
+			Content:     content,
+		}))
+	}
+
+	for _, c := range []struct {
+		terms []string
+		want  string
+	}{
+		{[]string{"octopus"}, "hello octopus world"},
+		{[]string{"hello", "world"}, "hello octopus world"},
+		{[]string{"天气不错"}, "今天天气不错啊"},
+		{[]string{"天气"}, "今天天气不错啊"},
+	} {
+		q := &SearchQuery{Terms: c.terms, SlaveLimb: slaveLimb}
+		count, err := s.Messages.GetSearchCount(q)
+		must(t, err)
+		messages, err := s.Messages.SearchMessages(q, 1, 10)
+		must(t, err)
+		if count != 1 || len(messages) != 1 || messages[0].Content != c.want {
+			t.Errorf("search %v = %d %+v", c.terms, count, messages)
+			continue
+		}
+		if messages[0].ChatTitle != "Search" {
+			t.Errorf("chat title = %q", messages[0].ChatTitle)
+		}
+	}
+}
+
+func testPurge(t *testing.T, s *Store) {
+	for i, slaveLimb := range []string{"qq;1;800", "qq;1;800", "qq;1;900"} {
+		must(t, s.Messages.AddMessage(&Message{
+			MasterLimb:  "telegram;1;1",
+			MasterMsgID: fmt.Sprint(200 + i),
+			SlaveLimb:   slaveLimb,
+			SlaveMsgID:  fmt.Sprint(i),
+			SlaveSender: "600",
+			Content:     "to purge",
+		}))
+	}
+	future := time.Now().Add(time.Hour)
+
+	anonymized, err := s.Messages.PurgeMessages(&PurgeQuery{Before: future, SlaveLimb: "qq;1;800", Anonymize: true}, 10)
+	must(t, err)
+	if anonymized != 2 {
+		t.Errorf("anonymized = %d", anonymized)
+	}
+	kept, err := s.Messages.GetMessagesBySlave("qq;1;800", "0")
+	must(t, err)
+	if len(kept) != 1 || kept[0].Content != "" {
+		t.Errorf("anonymized message = %+v", kept)
+	}
+
+	deleted, err := s.Messages.PurgeMessages(&PurgeQuery{Before: future, SlaveLimb: "qq;1;900"}, 10)
+	must(t, err)
+	if deleted != 1 {
+		t.Errorf("deleted = %d", deleted)
+	}
+}
+
+func testRequests(t *testing.T, s *Store) {
+	r := &Request{Vendor: "qq;1", RequestType: "friend", Flag: "flag", UserID: "700", Status: "pending"}
+	must(t, s.Requests.AddRequest(r))
+	if r.ID == 0 {
+		t.Fatal("request id not returned")
+	}
+
+	must(t, s.Requests.UpdateRequestStatus(r.ID, "accepted", "ok"))
+	got, err := s.Requests.GetRequest(r.ID)
+	must(t, err)
+	if got == nil || got.Status != "accepted" || got.Result != "ok" || got.Flag != "flag" {
+		t.Errorf("request = %+v", got)
+	}
+}
+
+func testArchives(t *testing.T, s *Store) {
+	must(t, s.Archives.SetArchive(&Archive{Vendor: "qq;1", MasterChat: -1001}))
+	must(t, s.Archives.SetArchive(&Archive{Vendor: "qq;1", ChatType: common.ArchiveGroup, MasterChat: -1002}))
+	// seed never replaces a binding
+	must(t, s.Archives.SeedArchive(&Archive{Vendor: "qq;1", MasterChat: -1003}))
+
+	for chatType, want := range map[string]int64{common.ArchiveGroup: -1002, common.ArchivePrivate: -1001} {
+		archive, err := s.Archives.GetArchive("qq;1", chatType)
+		must(t, err)
+		if archive == nil || archive.MasterChat != want {
+			t.Errorf("archive of %s = %+v", chatType, archive)
+		}
+	}
+
+	byMaster, err := s.Archives.GetArchivesByMaster(-1002)
+	must(t, err)
+	if len(byMaster) != 1 {
+		t.Fatalf("archives by master = %+v", byMaster)
+	}
+	must(t, s.Archives.DelArchiveById(byMaster[0].ID))
+	list, err := s.Archives.GetArchiveList()
+	must(t, err)
+	if len(list) != 1 {
+		t.Errorf("archives after delete = %+v", list)
+	}
+
+	// unbound seed is not added again
+	seed := &Archive{Vendor: "wechat;2", MasterChat: -1004}
+	must(t, s.Archives.SeedArchive(seed))
+	archive, err := s.Archives.GetArchive("wechat;2", common.ArchiveGroup)
+	must(t, err)
+	if archive == nil {
+		t.Fatal("seeded archive not added")
+	}
+	must(t, s.Archives.DelArchiveById(archive.ID))
+	must(t, s.Archives.SeedArchive(seed))
+	if archive, err := s.Archives.GetArchive("wechat;2", common.ArchiveGroup); err != nil || archive != nil {
+		t.Errorf("archive after reseed = %+v, %v", archive, err)
+	}
+}
+
+func testNotify(t *testing.T, s *Store) {
+	level, err := s.Notify.GetNotifyLevel("qq;1;1000")
+	must(t, err)
+	if level != NotifyAll {
+		t.Errorf("default level = %s", level)
+	}
+
+	must(t, s.Notify.SetNotifyLevel("qq;1;1000", NotifyMuted))
+	must(t, s.Notify.SetNotifyLevel("qq;1;1000", NotifySilent))
+	levels, err := s.Notify.GetNotifyLevels()
+	must(t, err)
+	if levels["qq;1;1000"] != NotifySilent {
+		t.Errorf("levels = %v", levels)
+	}
+
+	must(t, s.Notify.SetNotifyLevel("qq;1;1000", NotifyAll))
+	levels, err = s.Notify.GetNotifyLevels()
+	must(t, err)
+	if _, ok := levels["qq;1;1000"]; ok {
+		t.Errorf("level all kept = %v", levels)
+	}
+}
+
+func testRules(t *testing.T, s *Store) {
+	must(t, s.Rules.AddRule(&Rule{Vendor: "qq", Action: RuleDrop}))
+	must(t, s.Rules.AddRule(&Rule{Pattern: "(?i)sale", Action: RuleTag, Target: "ads", Priority: 5}))
+
+	list, err := s.Rules.GetRuleList()
+	must(t, err)
+	if len(list) != 2 || list[0].Action != RuleTag || !list[0].Enabled {
+		t.Fatalf("rules = %+v", list)
+	}
+
+	must(t, s.Rules.SetRuleEnabled(list[0].ID, false))
+	rule, err := s.Rules.GetRuleById(list[0].ID)
+	must(t, err)
+	if rule == nil || rule.Enabled || rule.Pattern != "(?i)sale" {
+		t.Errorf("disabled rule = %+v", rule)
+	}
+
+	must(t, s.Rules.DelRuleById(list[1].ID))
+	rule, err = s.Rules.GetRuleById(list[1].ID)
+	must(t, err)
+	if rule != nil {
+		t.Errorf("rule after delete = %+v", rule)
+	}
+}
+
+func testDeliveries(t *testing.T, s *Store) {
+	d := &Delivery{Webhook: "hook", Direction: "in", Vendor: "qq;1", Chat: "1", EventType: "text", EventID: "1", Status: "pending"}
+	must(t, s.Deliveries.AddDelivery(d))
+	if d.ID == 0 {
+		t.Fatal("delivery id not returned")
+	}
+
+	d.Status, d.Attempts, d.ResponseCode = "failed", 3, 500
+	must(t, s.Deliveries.UpdateDelivery(d))
+	count, err := s.Deliveries.GetDeliveryCount()
+	must(t, err)
+	list, err := s.Deliveries.GetDeliveryList(1, 10)
+	must(t, err)
+	if count != 1 || len(list) != 1 || list[0].Status != "failed" || list[0].Attempts != 3 {
+		t.Errorf("deliveries = %d %+v", count, list)
+	}
+
+	purged, err := s.Deliveries.PurgeDeliveries(time.Now().Add(time.Hour))
+	must(t, err)
+	if purged != 1 {
+		t.Errorf("purged = %d", purged)
+	}
+}
+
+func testEventQueue(t *testing.T, s *Store) {
+	for i, vendor := range []string{"qq;1", "wechat;2", "qq;1"} {
+		must(t, s.EventQueue.PushEvent("test", vendor, []byte{byte(i)}))
+	}
+
+	qq, err := s.EventQueue.GetQueuedEvents("test", "qq;1", 10)
+	must(t, err)
+	if len(qq) != 2 || qq[0].Payload[0] != 0 || qq[1].Payload[0] != 2 {
+		t.Fatalf("events of vendor = %+v", qq)
+	}
+	must(t, s.EventQueue.DelQueuedEvent(qq[0].ID))
+
+	all, err := s.EventQueue.GetQueuedEvents("test", "", 1)
+	must(t, err)
+	if len(all) != 1 || all[0].Vendor != "wechat;2" {
+		t.Fatalf("oldest event = %+v", all)
+	}
+	after, err := s.EventQueue.GetQueuedEventsAfter("test", all[0].ID, 10)
+	must(t, err)
+	if len(after) != 1 || after[0].Payload[0] != 2 {
+		t.Fatalf("events after oldest = %+v", after)
+	}
+	must(t, s.EventQueue.DelQueuedEventsUpTo("test", all[0].ID))
+
+	count, err := s.EventQueue.GetQueuedCount("test")
+	must(t, err)
+	if count != 1 {
+		t.Errorf("queued = %d", count)
+	}
+}
+
+func testMaintenance(t *testing.T, s *Store) {
+	must(t, s.Maintenance.CheckWritable())
+
+	stats, err := s.Maintenance.GetStats()
+	must(t, err)
+	if len(stats.Tables) == 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -1,23 +1,5 @@
 package manager
 
-import (
-	"github.com/duo/octopus/internal/db"
-)
-
-func init() {
-	if _, err := db.DB.Exec(`BEGIN;
-		CREATE TABLE IF NOT EXISTS topic (
-			id INTEGER PRIMARY KEY,
-			master_limb TEXT NOT NULL,
-			slave_limb TEXT NOT NULL,
-			topic_id INTEGER NOT NULL,
-			UNIQUE(master_limb, slave_limb)
-		);
-		COMMIT;`); err != nil {
-		panic(err)
-	}
-}
-
 type Topic struct {
 	ID         int64
 	MasterLimb string
@@ -25,31 +7,112 @@ type Topic struct {
 	TopicID    string
 }
 
+type TopicRepository interface {
+	GetTopic(masterLimb, slaveLimb string) (*Topic, error)
+	GetTopicByMaster(masterLimb string, topicID int64) (*Topic, error)
+	GetTopicsBySlave(slaveLimb string) ([]*Topic, error)
+	AddTopic(t *Topic) error
+	DelTopic(masterLimb, slaveLimb string) error
+	GetTopicList() ([]*Topic, error)
+	DelTopicById(id int64) error
+}
+
 func GetTopic(master_limb, slave_limb string) (*Topic, error) {
-	rows, err := db.DB.Query(`SELECT * FROM topic WHERE master_limb = ? AND slave_limb = ?;`, master_limb, slave_limb)
+	return store.Topics.GetTopic(master_limb, slave_limb)
+}
+
+func GetTopicByMaster(master_limb string, topic_id int64) (*Topic, error) {
+	return store.Topics.GetTopicByMaster(master_limb, topic_id)
+}
+
+// get topics of slave chat in all supergroups
+func GetTopicsBySlave(slave_limb string) ([]*Topic, error) {
+	return store.Topics.GetTopicsBySlave(slave_limb)
+}
+
+func AddTopic(t *Topic) error {
+	return store.Topics.AddTopic(t)
+}
+
+func DelTopic(master_limb, slave_limb string) error {
+	return store.Topics.DelTopic(master_limb, slave_limb)
+}
+
+func GetTopicList() ([]*Topic, error) {
+	return store.Topics.GetTopicList()
+}
+
+func DelTopicById(id int64) error {
+	return store.Topics.DelTopicById(id)
+}
+
+type sqlTopicRepository struct {
+	*sqlDB
+}
+
+func (r *sqlTopicRepository) GetTopic(masterLimb, slaveLimb string) (*Topic, error) {
+	return r.getTopic(`SELECT id, master_limb, slave_limb, topic_id FROM topic WHERE master_limb = ? AND slave_limb = ?;`, masterLimb, slaveLimb)
+}
+
+func (r *sqlTopicRepository) GetTopicByMaster(masterLimb string, topicID int64) (*Topic, error) {
+	return r.getTopic(`SELECT id, master_limb, slave_limb, topic_id FROM topic WHERE master_limb = ? AND topic_id = ?;`, masterLimb, topicID)
+}
+
+func (r *sqlTopicRepository) AddTopic(t *Topic) error {
+	_, err := r.exec(
+		`INSERT INTO topic (master_limb, slave_limb, topic_id) VALUES (?, ?, ?);`,
+		t.MasterLimb, t.SlaveLimb, t.TopicID,
+	)
+	return err
+}
+
+func (r *sqlTopicRepository) DelTopic(masterLimb, slaveLimb string) error {
+	_, err := r.exec(
+		`DELETE FROM topic WHERE master_limb = ? AND slave_limb = ?;`,
+		masterLimb, slaveLimb,
+	)
+	return err
+}
+
+func (r *sqlTopicRepository) GetTopicsBySlave(slaveLimb string) ([]*Topic, error) {
+	return r.getTopics(`SELECT id, master_limb, slave_limb, topic_id FROM topic WHERE slave_limb = ? ORDER BY id;`, slaveLimb)
+}
 
+func (r *sqlTopicRepository) GetTopicList() ([]*Topic, error) {
+	return r.getTopics(`SELECT id, master_limb, slave_limb, topic_id FROM topic ORDER BY id;`)
+}
+
+func (r *sqlTopicRepository) getTopics(query string, args ...any) ([]*Topic, error) {
+	topics := []*Topic{}
+
+	rows, err := r.query(query, args...)
 	if err != nil {
-		return nil, err
+		return topics, err
 	}
 
 	defer rows.Close()
 
-	hasNext := rows.Next()
-	if hasNext {
+	for rows.Next() {
 		t := &Topic{}
-		err = rows.Scan(&t.ID, &t.MasterLimb, &t.SlaveLimb, &t.TopicID)
-		if err != nil {
-			return nil, err
+		if err := rows.Scan(&t.ID, &t.MasterLimb, &t.SlaveLimb, &t.TopicID); err != nil {
+			return topics, err
 		}
-
-		return t, err
+		topics = append(topics, t)
+	}
+	if err = rows.Err(); err != nil {
+		return topics, err
 	}
 
-	return nil, nil
+	return topics, nil
 }
 
-func GetTopicByMaster(master_limb string, topic_id int64) (*Topic, error) {
-	rows, err := db.DB.Query(`SELECT * FROM topic WHERE master_limb = ? AND topic_id = ?;`, master_limb, topic_id)
+func (r *sqlTopicRepository) DelTopicById(id int64) error {
+	_, err := r.exec(`DELETE FROM topic WHERE id = ?;`, id)
+	return err
+}
+
+func (r *sqlTopicRepository) getTopic(query string, args ...any) (*Topic, error) {
+	rows, err := r.query(query, args...)
 
 	if err != nil {
 		return nil, err
@@ -70,19 +133,3 @@ func GetTopicByMaster(master_limb string, topic_id int64) (*Topic, error) {
 
 	return nil, nil
 }
-
-func AddTopic(t *Topic) error {
-	_, err := db.DB.Exec(
-		`INSERT INTO topic (master_limb, slave_limb, topic_id) VALUES (?, ?, ?);`,
-		t.MasterLimb, t.SlaveLimb, t.TopicID,
-	)
-	return err
-}
-
-func DelTopic(master_limb, slave_limb string) error {
-	_, err := db.DB.Exec(
-		`DELETE FROM link WHERE master_limb = ? AND slave_limb = ?;`,
-		master_limb, slave_limb,
-	)
-	return err
-}
@@ -0,0 +1,122 @@
+package manager
+
+import "time"
+
+const (
+	DeliveryPending = "pending"
+	DeliverySuccess = "success"
+	DeliveryFailed  = "failed"
+	DeliveryDropped = "dropped"
+)
+
+type Delivery struct {
+	ID           int64
+	Webhook      string
+	Direction    string
+	Vendor       string
+	Chat         string
+	EventType    string
+	EventID      string
+	Status       string
+	Attempts     int
+	ResponseCode int
+	Error        string
+	Updated      time.Time
+}
+
+type DeliveryRepository interface {
+	AddDelivery(d *Delivery) error
+	UpdateDelivery(d *Delivery) error
+	GetDeliveryCount() (int, error)
+	GetDeliveryList(pageNum, pageSize int) ([]*Delivery, error)
+	PurgeDeliveries(before time.Time) (int64, error)
+}
+
+func AddDelivery(d *Delivery) error {
+	return store.Deliveries.AddDelivery(d)
+}
+
+// update status, attempts, response code and error of delivery
+func UpdateDelivery(d *Delivery) error {
+	return store.Deliveries.UpdateDelivery(d)
+}
+
+func GetDeliveryCount() (int, error) {
+	return store.Deliveries.GetDeliveryCount()
+}
+
+// get deliveries, newest first
+func GetDeliveryList(pageNum, pageSize int) ([]*Delivery, error) {
+	return store.Deliveries.GetDeliveryList(pageNum, pageSize)
+}
+
+func PurgeDeliveries(before time.Time) (int64, error) {
+	return store.Deliveries.PurgeDeliveries(before)
+}
+
+type sqlDeliveryRepository struct {
+	*sqlDB
+}
+
+func (r *sqlDeliveryRepository) AddDelivery(d *Delivery) error {
+	return r.queryRow(`INSERT INTO webhook_delivery
+		(webhook, direction, vendor, chat, event_type, event_id, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id;`,
+		d.Webhook, d.Direction, d.Vendor, d.Chat, d.EventType, d.EventID, d.Status,
+	).Scan(&d.ID)
+}
+
+func (r *sqlDeliveryRepository) UpdateDelivery(d *Delivery) error {
+	_, err := r.exec(`UPDATE webhook_delivery
+		SET status = ?, attempts = ?, response_code = ?, error = ?, updated = CURRENT_TIMESTAMP
+		WHERE id = ?;`,
+		d.Status, d.Attempts, d.ResponseCode, d.Error, d.ID,
+	)
+	return err
+}
+
+func (r *sqlDeliveryRepository) GetDeliveryCount() (int, error) {
+	var count int
+	err := r.queryRow(`SELECT count(*) FROM webhook_delivery;`).Scan(&count)
+	return count, err
+}
+
+func (r *sqlDeliveryRepository) GetDeliveryList(pageNum, pageSize int) ([]*Delivery, error) {
+	deliveries := []*Delivery{}
+
+	rows, err := r.query(`SELECT
+		id, webhook, direction, vendor, chat, event_type, event_id, status, attempts, response_code, error, updated
+		FROM webhook_delivery
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?;`,
+		pageSize, pageSize*(pageNum-1),
+	)
+	if err != nil {
+		return deliveries, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		d := &Delivery{}
+		if err := rows.Scan(&d.ID, &d.Webhook, &d.Direction, &d.Vendor, &d.Chat, &d.EventType, &d.EventID,
+			&d.Status, &d.Attempts, &d.ResponseCode, &d.Error, &d.Updated); err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *sqlDeliveryRepository) PurgeDeliveries(before time.Time) (int64, error) {
+	res, err := r.exec(`DELETE FROM webhook_delivery WHERE created < ?;`, formatCreated(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,373 @@
+package master
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	"github.com/gabriel-vasile/mimetype"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const maxAPIUploadSize = 50 * 1024 * 1024
+
+var (
+	errAPIMissingToken = common.ErrorResponse{
+		HTTPStatus: http.StatusUnauthorized,
+		Code:       "M_MISSING_TOKEN",
+		Message:    "Missing authorization header",
+	}
+	errAPIUnknownToken = common.ErrorResponse{
+		HTTPStatus: http.StatusUnauthorized,
+		Code:       "M_UNKNOWN_TOKEN",
+		Message:    "Unknown authorization token",
+	}
+	errAPIDisabled = common.ErrorResponse{
+		HTTPStatus: http.StatusNotFound,
+		Code:       "M_UNRECOGNIZED",
+		Message:    "API disabled",
+	}
+)
+
+type apiChat struct {
+	ID     int64  `json:"id"`
+	Limb   string `json:"limb"`
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Active bool   `json:"active"`
+}
+
+type apiLink struct {
+	ID         int64  `json:"id"`
+	MasterLimb string `json:"master_limb"`
+	SlaveLimb  string `json:"slave_limb"`
+	Title      string `json:"title,omitempty"`
+}
+
+type apiTopic struct {
+	ID         int64  `json:"id"`
+	MasterLimb string `json:"master_limb"`
+	SlaveLimb  string `json:"slave_limb"`
+	TopicID    string `json:"topic_id"`
+}
+
+type apiSendResult struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// APIHandler serve admin REST API under /api/v1, authorized by api token
+func (ms *MasterService) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/chats", ms.apiListChats)
+	mux.HandleFunc("GET /api/v1/links", ms.apiListLinks)
+	mux.HandleFunc("POST /api/v1/links", ms.apiAddLink)
+	mux.HandleFunc("DELETE /api/v1/links/{id}", ms.apiDelLink)
+	mux.HandleFunc("GET /api/v1/topics", ms.apiListTopics)
+	mux.HandleFunc("DELETE /api/v1/topics/{id}", ms.apiDelTopic)
+	mux.HandleFunc("POST /api/v1/messages", ms.apiSendMessage)
+	mux.HandleFunc("GET /api/v1/blobs/{hash}", ms.apiGetBlob)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ms.config().Service.APIToken
+		if token == "" {
+			errAPIDisabled.Write(w)
+			return
+		}
+
+		authHeader := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			errAPIMissingToken.Write(w)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(authHeader[len("Bearer "):]), []byte(token)) != 1 {
+			errAPIUnknownToken.Write(w)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func apiError(w http.ResponseWriter, status int, code string, err error) {
+	common.ErrorResponse{
+		HTTPStatus: status,
+		Code:       code,
+		Message:    err.Error(),
+	}.Write(w)
+}
+
+// list chats, e.g. GET /api/v1/chats?query=foo&page=1&page_size=20
+func (ms *MasterService) apiListChats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("query")
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize <= 0 {
+		pageSize = ms.config().Master.PageSize
+	}
+
+	count, err := manager.GetChatCount(query)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	pager := manager.CalcPager(page, pageSize, count)
+
+	chats, err := manager.GetChatList(pager.CurrentPage, pageSize, query)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	result := make([]*apiChat, 0, len(chats))
+	for _, c := range chats {
+		result = append(result, &apiChat{ID: c.ID, Limb: c.Limb, Type: c.ChatType, Title: c.Title, Active: c.Active})
+	}
+
+	common.Respond(w, map[string]any{
+		"total":     pager.NumItems,
+		"page":      pager.CurrentPage,
+		"num_pages": pager.NumPages,
+		"chats":     result,
+	})
+}
+
+func (ms *MasterService) apiListLinks(w http.ResponseWriter, r *http.Request) {
+	links, err := manager.GetLinkList()
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	result := make([]*apiLink, 0, len(links))
+	for _, l := range links {
+		result = append(result, &apiLink{ID: l.ID, MasterLimb: l.MasterLimb, SlaveLimb: l.SlaveLimb, Title: l.Title})
+	}
+	common.Respond(w, map[string]any{"links": result})
+}
+
+// link slave chat to master chat, e.g. POST /api/v1/links {"master_limb": "...", "slave_limb": "..."}
+func (ms *MasterService) apiAddLink(w http.ResponseWriter, r *http.Request) {
+	var req apiLink
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, "M_BAD_JSON", err)
+		return
+	}
+	for _, limb := range []string{req.MasterLimb, req.SlaveLimb} {
+		if _, err := common.LimbFromString(limb); err != nil {
+			apiError(w, http.StatusBadRequest, "M_INVALID_PARAM", fmt.Errorf("invalid limb %q", limb))
+			return
+		}
+	}
+
+	if err := manager.AddLink(&manager.Link{MasterLimb: req.MasterLimb, SlaveLimb: req.SlaveLimb}); err != nil {
+		apiError(w, http.StatusConflict, "M_UNKNOWN", err)
+		return
+	}
+
+	links, err := manager.GetLinksByMaster(req.MasterLimb)
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	for _, l := range links {
+		if l.SlaveLimb == req.SlaveLimb {
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(&apiLink{ID: l.ID, MasterLimb: l.MasterLimb, SlaveLimb: l.SlaveLimb, Title: l.Title})
+			return
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (ms *MasterService) apiDelLink(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "M_INVALID_PARAM", err)
+		return
+	}
+	if err := manager.DelLinkById(id); err != nil {
+		apiError(w, http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ms *MasterService) apiListTopics(w http.ResponseWriter, r *http.Request) {
+	topics, err := manager.GetTopicList()
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+
+	result := make([]*apiTopic, 0, len(topics))
+	for _, t := range topics {
+		result = append(result, &apiTopic{ID: t.ID, MasterLimb: t.MasterLimb, SlaveLimb: t.SlaveLimb, TopicID: t.TopicID})
+	}
+	common.Respond(w, map[string]any{"topics": result})
+}
+
+func (ms *MasterService) apiDelTopic(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "M_INVALID_PARAM", err)
+		return
+	}
+	if err := manager.DelTopicById(id); err != nil {
+		apiError(w, http.StatusInternalServerError, "M_UNKNOWN", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// send text (JSON) or file (multipart, with optional text as caption) to slave chat,
+// and wait for the limb to respond
+func (ms *MasterService) apiSendMessage(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAPIUploadSize)
+
+	var slaveLimb, text string
+	var blob *common.BlobData
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxAPIUploadSize); err != nil {
+			apiError(w, http.StatusBadRequest, "M_INVALID_PARAM", err)
+			return
+		}
+		slaveLimb = r.FormValue("slave_limb")
+		text = r.FormValue("text")
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			apiError(w, http.StatusBadRequest, "M_INVALID_PARAM", err)
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, "M_INVALID_PARAM", err)
+			return
+		}
+		blob = &common.BlobData{
+			Name:   header.Filename,
+			Mime:   mimetype.Detect(data).String(),
+			Binary: data,
+		}
+	} else {
+		var req struct {
+			SlaveLimb string `json:"slave_limb"`
+			Text      string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apiError(w, http.StatusBadRequest, "M_BAD_JSON", err)
+			return
+		}
+		slaveLimb, text = req.SlaveLimb, req.Text
+		if text == "" {
+			apiError(w, http.StatusBadRequest, "M_INVALID_PARAM", errors.New("text is empty"))
+			return
+		}
+	}
+
+	event, err := ms.newAPIEvent(slaveLimb, text, blob)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "M_INVALID_PARAM", err)
+		return
+	}
+
+	type sendResult struct {
+		event *common.OctopusEvent
+		err   error
+	}
+	done := make(chan sendResult, 1)
+	event.Callback = func(event *common.OctopusEvent, err error) {
+		done <- sendResult{event, err}
+	}
+
+	ms.out <- event
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			apiError(w, http.StatusBadGateway, "M_SEND_FAILED", res.err)
+			return
+		}
+		common.Respond(w, &apiSendResult{ID: res.event.ID, Timestamp: res.event.Timestamp})
+	case <-time.After(ms.config().Service.SendTiemout):
+		apiError(w, http.StatusGatewayTimeout, "M_SEND_FAILED", errors.New("timeout waiting for limb response"))
+	case <-r.Context().Done():
+		log.Warnf("API request canceled before %s responded", slaveLimb)
+	}
+}
+
+// build event sent as self of the limb, like messages from Telegram
+func (ms *MasterService) newAPIEvent(slaveLimb, text string, blob *common.BlobData) (*common.OctopusEvent, error) {
+	limb, err := common.LimbFromString(slaveLimb)
+	if err != nil {
+		return nil, fmt.Errorf("invalid limb %q", slaveLimb)
+	}
+
+	chat, err := manager.GetChat(slaveLimb)
+	if err != nil {
+		return nil, err
+	}
+	if chat == nil {
+		return nil, errors.New(slaveLimb + " not found")
+	}
+
+	meLimb := common.Limb{
+		Type:   limb.Type,
+		UID:    limb.UID,
+		ChatID: limb.UID,
+	}.String()
+	me, err := manager.GetChat(meLimb)
+	if err != nil {
+		return nil, err
+	}
+	if me == nil {
+		return nil, errors.New(meLimb + " not found")
+	}
+
+	event := &common.OctopusEvent{
+		Vendor: common.Vendor{
+			Type: limb.Type,
+			UID:  limb.UID,
+		},
+		ID:        common.NextRandom(),
+		Timestamp: time.Now().Unix(),
+		TraceID:   common.NewTraceID(),
+		From: common.User{
+			ID:       limb.UID,
+			Username: me.Title,
+			Remark:   me.Title,
+		},
+		Chat: common.Chat{
+			Type:  chat.ChatType,
+			ID:    limb.ChatID,
+			Title: chat.Title,
+		},
+		Type:    common.EventText,
+		Content: text,
+	}
+
+	if blob != nil {
+		if strings.HasPrefix(blob.Mime, "image/") {
+			event.Type = common.EventPhoto
+			event.Data = []*common.BlobData{blob}
+		} else {
+			event.Type = common.EventFile
+			event.Data = blob
+		}
+	}
+
+	return event, nil
+}
@@ -0,0 +1,246 @@
+package master
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// archive supergroup of chat without link, from bindings in database
+func (ms *MasterService) archiveChat(event *common.OctopusEvent) (int64, bool) {
+	archive, err := manager.GetArchive(event.Vendor.String(), event.Chat.Type)
+	if err != nil {
+		log.Warnf("Failed to get archive of %s: %v", event.Vendor, err)
+		return 0, false
+	}
+	if archive == nil {
+		return 0, false
+	}
+	return archive.MasterChat, true
+}
+
+// add new archives of config once, unless bound by command
+func (ms *MasterService) seedArchives() {
+	for _, archive := range ms.config().Master.Archive {
+		err := manager.SeedArchive(&manager.Archive{
+			Vendor:     common.Vendor{Type: archive.Vendor, UID: archive.UID}.String(),
+			ChatType:   archive.ChatType,
+			MasterChat: archive.ChatID,
+		})
+		if err != nil {
+			log.Warnf("Failed to seed archive of %s;%s: %v", archive.Vendor, archive.UID, err)
+		}
+	}
+}
+
+// manage archive bindings, of current group if it is a forum supergroup
+func (ms *MasterService) onArchive(bot *gotgbot.Bot, ctx *ext.Context) error {
+	return ms.showArchives(bot, ctx)
+}
+
+func (ms *MasterService) handleArchive(bot *gotgbot.Bot, ctx *ext.Context, cb Callback) error {
+	if ctx.Update.CallbackQuery.From.Id != ms.config().Master.AdminID {
+		return errors.New("archive from stranger")
+	}
+
+	switch cb.Acction {
+	case "close":
+		_, _, err := ctx.EffectiveMessage.EditText(
+			bot,
+			"_Canceled by user._",
+			&gotgbot.EditMessageTextOpts{ParseMode: "Markdown"},
+		)
+		return err
+	case "vendors":
+		return ms.showArchiveVendors(bot, ctx)
+	case "type":
+		return ms.showArchiveTypes(bot, ctx, cb.Data)
+	case "bind":
+		if !ctx.EffectiveChat.IsForum {
+			return errors.New("archive must be a forum supergroup")
+		}
+		err := manager.SetArchive(&manager.Archive{
+			Vendor:     cb.Data,
+			ChatType:   cb.Query,
+			MasterChat: ctx.EffectiveChat.Id,
+		})
+		if err != nil {
+			log.Warnf("Failed to bind archive %s: %v", cb.Data, err)
+			return err
+		}
+	case "unbind":
+		id, err := common.Atoi(cb.Data)
+		if err != nil {
+			return err
+		}
+		if err := manager.DelArchiveById(id); err != nil {
+			log.Warnf("Failed to unbind archive %d: %v", id, err)
+			return err
+		}
+	}
+
+	return ms.showArchives(bot, ctx)
+}
+
+// bindings of current forum supergroup, or all bindings elsewhere
+func (ms *MasterService) showArchives(bot *gotgbot.Bot, ctx *ext.Context) error {
+	isForum := ctx.EffectiveChat.IsForum
+
+	var archives []*manager.Archive
+	var err error
+	if isForum {
+		archives, err = manager.GetArchivesByMaster(ctx.EffectiveChat.Id)
+	} else {
+		archives, err = manager.GetArchiveList()
+	}
+	if err != nil {
+		log.Warnf("Get archive list failed: %v", err)
+		return err
+	}
+
+	var sb strings.Builder
+	if isForum {
+		sb.WriteString("<b>Archives of this group</b>")
+	} else {
+		sb.WriteString("<b>Archives</b>")
+	}
+	if len(archives) == 0 {
+		sb.WriteString("\n\nNo archive bound.")
+	}
+	for _, archive := range archives {
+		sb.WriteString(fmt.Sprintf("\n%s %s", html.EscapeString(archive.Vendor), archiveTypeName(archive.ChatType)))
+		if !isForum {
+			sb.WriteString(fmt.Sprintf(" → <code>%d</code>", archive.MasterChat))
+		}
+	}
+	if !isForum {
+		sb.WriteString("\n\n<i>Run /archive in a forum supergroup to bind it.</i>")
+	}
+
+	keyboard := [][]gotgbot.InlineKeyboardButton{}
+	for _, archive := range archives {
+		cb := Callback{
+			Category: "archive",
+			Acction:  "unbind",
+			Data:     common.Itoa(archive.ID),
+		}
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("Unbind %s %s", archive.Vendor, archiveTypeName(archive.ChatType)),
+			CallbackData: putCallback(cb),
+		}})
+	}
+	var bottom []gotgbot.InlineKeyboardButton
+	if isForum {
+		cb := Callback{
+			Category: "archive",
+			Acction:  "vendors",
+		}
+		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: "Bind", CallbackData: putCallback(cb)})
+	}
+	bottom = append(bottom, archiveCloseButton())
+	keyboard = append(keyboard, bottom)
+
+	return ms.replyArchive(bot, ctx, sb.String(), keyboard)
+}
+
+// vendors which have synced chats to bind
+func (ms *MasterService) showArchiveVendors(bot *gotgbot.Bot, ctx *ext.Context) error {
+	vendors, err := manager.GetChatVendors()
+	if err != nil {
+		log.Warnf("Get chat vendors failed: %v", err)
+		return err
+	}
+
+	text := "Choose vendor to archive in this group:"
+	if len(vendors) == 0 {
+		text = "No vendor found, sync remote chats first."
+	}
+
+	keyboard := [][]gotgbot.InlineKeyboardButton{}
+	for _, vendor := range vendors {
+		cb := Callback{
+			Category: "archive",
+			Acction:  "type",
+			Data:     vendor,
+		}
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{{Text: vendor, CallbackData: putCallback(cb)}})
+	}
+	keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{archiveCloseButton()})
+
+	return ms.replyArchive(bot, ctx, text, keyboard)
+}
+
+// chat types of vendor to bind, chats without matched type fall back to all chats binding
+func (ms *MasterService) showArchiveTypes(bot *gotgbot.Bot, ctx *ext.Context, vendor string) error {
+	var row []gotgbot.InlineKeyboardButton
+	for _, chatType := range []string{common.ArchiveAll, common.ArchivePrivate, common.ArchiveGroup} {
+		cb := Callback{
+			Category: "archive",
+			Acction:  "bind",
+			Query:    chatType,
+			Data:     vendor,
+		}
+		row = append(row, gotgbot.InlineKeyboardButton{Text: archiveTypeName(chatType), CallbackData: putCallback(cb)})
+	}
+	keyboard := [][]gotgbot.InlineKeyboardButton{row, {archiveCloseButton()}}
+
+	text := fmt.Sprintf("Choose chats of <b>%s</b> to archive in this group:", html.EscapeString(vendor))
+	return ms.replyArchive(bot, ctx, text, keyboard)
+}
+
+func (ms *MasterService) replyArchive(bot *gotgbot.Bot, ctx *ext.Context, text string, keyboard [][]gotgbot.InlineKeyboardButton) error {
+	if ctx.EffectiveMessage.From.Id == bot.User.Id {
+		_, _, err := ctx.EffectiveMessage.EditText(
+			bot,
+			text,
+			&gotgbot.EditMessageTextOpts{
+				ParseMode: "HTML",
+				ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+					InlineKeyboard: keyboard,
+				},
+			},
+		)
+		return err
+	} else {
+		_, err := bot.SendMessage(
+			ctx.EffectiveChat.Id,
+			text,
+			&gotgbot.SendMessageOpts{
+				ParseMode:       "HTML",
+				MessageThreadId: ctx.EffectiveMessage.MessageThreadId,
+				ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+					InlineKeyboard: keyboard,
+				},
+			},
+		)
+		return err
+	}
+}
+
+func archiveCloseButton() gotgbot.InlineKeyboardButton {
+	cb := Callback{
+		Category: "archive",
+		Acction:  "close",
+	}
+	return gotgbot.InlineKeyboardButton{Text: "Cancel", CallbackData: putCallback(cb)}
+}
+
+func archiveTypeName(chatType string) string {
+	switch chatType {
+	case common.ArchivePrivate:
+		return "(private)"
+	case common.ArchiveGroup:
+		return "(group)"
+	default:
+		return "(all)"
+	}
+}
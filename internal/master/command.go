@@ -19,15 +19,38 @@ const (
 	maxShowBindedLinks = 7
 )
 
-func onCommand(bot *gotgbot.Bot, ctx *ext.Context, config *common.Configure) error {
+func (ms *MasterService) onCommand(bot *gotgbot.Bot, ctx *ext.Context) error {
+	config := ms.config()
 	text := ctx.EffectiveMessage.Text
 	if strings.HasPrefix(text, "/help") {
 		_, err := bot.SendMessage(
 			ctx.EffectiveChat.Id,
-			"help - Show command list.\nlink - Manage remote chat link.\nchat - Generate a remote chat head.",
+			"help - Show command list.\nlink - Manage remote chat link.\nchat - Generate a remote chat head.\nsync - Resync remote chats.\nsearch - Search bridged messages.\nexport - Export messages of remote chat.\nstats - Show database statistics.\nwebhooks - Show webhook deliveries.\narchive - Manage archive supergroups.\ntopic - Manage linked chat of topic.\nrules - Manage rules of incoming events.",
 			nil,
 		)
 		return err
+	} else if strings.HasPrefix(text, "/search") {
+		return ms.onSearch(bot, ctx, strings.TrimSpace(strings.TrimPrefix(text, "/search")))
+	} else if strings.HasPrefix(text, "/webhooks") {
+		return ms.onWebhooks(bot, ctx)
+	} else if strings.HasPrefix(text, "/topic") {
+		return ms.onTopic(bot, ctx, strings.Fields(text)[1:])
+	} else if strings.HasPrefix(text, "/rules") {
+		return ms.onRules(bot, ctx, strings.TrimSpace(strings.TrimPrefix(text, "/rules")))
+	} else if strings.HasPrefix(text, "/archive") {
+		return ms.onArchive(bot, ctx)
+	} else if strings.HasPrefix(text, "/stats") {
+		return ms.onStats(bot, ctx)
+	} else if strings.HasPrefix(text, "/export") {
+		return ms.onExport(bot, ctx, strings.Fields(text)[1:])
+	} else if strings.HasPrefix(text, "/sync") {
+		var query string
+		parts := strings.Split(text, " ")
+		if len(parts) == 2 {
+			query = parts[1]
+		}
+
+		return ms.handleSync(ctx, query)
 	} else if strings.HasPrefix(text, "/link") {
 		if ctx.EffectiveChat.IsForum && ctx.EffectiveMessage.MessageThreadId != 0 {
 			_, err := bot.SendMessage(
@@ -210,6 +233,16 @@ func showLinks(bot *gotgbot.Bot, ctx *ext.Context, config *common.Configure, use
 		text += fmt.Sprintf("\n\nand %d more...", len(bindLinks)-maxShowBindedLinks)
 	}
 
+	notifyMode := cb.Acction == "list" && cb.Data == notifyListMode
+	listData := ""
+	if notifyMode {
+		listData = notifyListMode
+	}
+	levels, err := manager.GetNotifyLevels()
+	if err != nil {
+		log.Warnf("Get notify levels failed: %v", err)
+	}
+
 	keyboard := [][]gotgbot.InlineKeyboardButton{}
 	for _, chat := range chats {
 		limb, _ := common.LimbFromString(chat.Limb)
@@ -219,6 +252,9 @@ func showLinks(bot *gotgbot.Bot, ctx *ext.Context, config *common.Configure, use
 		} else {
 			info = "👥" + info
 		}
+		if level, ok := levels[chat.Limb]; ok {
+			info = notifyIcon(level) + info
+		}
 
 		cb := Callback{
 			Category: "link",
@@ -241,6 +277,14 @@ func showLinks(bot *gotgbot.Bot, ctx *ext.Context, config *common.Configure, use
 			cb.Data = common.Itoa(links[idx].ID)
 		}
 
+		if notifyMode {
+			cb = Callback{
+				Category: "notify",
+				Acction:  "menu",
+				Data:     chat.Limb,
+			}
+		}
+
 		btn := gotgbot.InlineKeyboardButton{Text: info, CallbackData: putCallback(cb)}
 		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{btn})
 	}
@@ -252,6 +296,7 @@ func showLinks(bot *gotgbot.Bot, ctx *ext.Context, config *common.Configure, use
 			Acction:  "list",
 			Query:    cb.Query,
 			Page:     pager.PrevPage,
+			Data:     listData,
 		}
 		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: "< Prev", CallbackData: putCallback(cb)})
 	} else {
@@ -272,11 +317,13 @@ func showLinks(bot *gotgbot.Bot, ctx *ext.Context, config *common.Configure, use
 			Acction:  "list",
 			Query:    cb.Query,
 			Page:     pager.NextPage,
+			Data:     listData,
 		}
 		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: "Next >", CallbackData: putCallback(cb)})
 	} else {
 		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: " ", CallbackData: "0"})
 	}
+	keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{notifyModeButton("link", cb.Query, pager.CurrentPage, notifyMode)})
 	keyboard = append(keyboard, bottom)
 
 	if ctx.EffectiveMessage.From.Id == bot.User.Id {
@@ -331,6 +378,16 @@ func showChats(bot *gotgbot.Bot, ctx *ext.Context, config *common.Configure, cb
 		return err
 	}
 
+	notifyMode := cb.Acction == "list" && cb.Data == notifyListMode
+	listData := ""
+	if notifyMode {
+		listData = notifyListMode
+	}
+	levels, err := manager.GetNotifyLevels()
+	if err != nil {
+		log.Warnf("Get notify levels failed: %v", err)
+	}
+
 	keyboard := [][]gotgbot.InlineKeyboardButton{}
 	for _, chat := range chats {
 		limb, _ := common.LimbFromString(chat.Limb)
@@ -340,6 +397,9 @@ func showChats(bot *gotgbot.Bot, ctx *ext.Context, config *common.Configure, cb
 		} else {
 			info = "👥" + info
 		}
+		if level, ok := levels[chat.Limb]; ok {
+			info = notifyIcon(level) + info
+		}
 
 		cb := Callback{
 			Category: "chat",
@@ -349,6 +409,14 @@ func showChats(bot *gotgbot.Bot, ctx *ext.Context, config *common.Configure, cb
 			Page:     pager.CurrentPage,
 		}
 
+		if notifyMode {
+			cb = Callback{
+				Category: "notify",
+				Acction:  "menu",
+				Data:     chat.Limb,
+			}
+		}
+
 		btn := gotgbot.InlineKeyboardButton{Text: info, CallbackData: putCallback(cb)}
 		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{btn})
 	}
@@ -360,6 +428,7 @@ func showChats(bot *gotgbot.Bot, ctx *ext.Context, config *common.Configure, cb
 			Acction:  "list",
 			Query:    cb.Query,
 			Page:     pager.PrevPage,
+			Data:     listData,
 		}
 		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: "< Prev", CallbackData: putCallback(cb)})
 	} else {
@@ -380,11 +449,13 @@ func showChats(bot *gotgbot.Bot, ctx *ext.Context, config *common.Configure, cb
 			Acction:  "list",
 			Query:    cb.Query,
 			Page:     pager.NextPage,
+			Data:     listData,
 		}
 		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: "Next >", CallbackData: putCallback(cb)})
 	} else {
 		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: " ", CallbackData: "0"})
 	}
+	keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{notifyModeButton("chat", cb.Query, pager.CurrentPage, notifyMode)})
 	keyboard = append(keyboard, bottom)
 
 	if ctx.EffectiveMessage.From.Id == bot.User.Id {
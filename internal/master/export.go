@@ -0,0 +1,246 @@
+package master
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/export"
+	"github.com/duo/octopus/internal/manager"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// limit of sendDocument on official Bot API server
+const maxExportDocumentSize = 50 * 1024 * 1024
+
+// NewFetcher create media fetcher of Telegram without starting the service
+func NewFetcher(config *common.Configure) (export.Fetcher, error) {
+	ms := &MasterService{}
+	ms.conf.Store(config)
+	if err := ms.initBot(); err != nil {
+		return nil, err
+	}
+	return ms.download, nil
+}
+
+// export messages of slave chat, e.g. /export [vendor;uid;chatid] [from] [to]
+func (ms *MasterService) onExport(bot *gotgbot.Bot, ctx *ext.Context, args []string) error {
+	threadID := ctx.EffectiveMessage.MessageThreadId
+	usage := func() error {
+		_, err := ctx.EffectiveMessage.Reply(
+			bot,
+			"Usage: /export [vendor;uid;chatid] [from YYYY-MM-DD] [to YYYY-MM-DD]",
+			&gotgbot.SendMessageOpts{MessageThreadId: threadID},
+		)
+		return err
+	}
+
+	var slaveLimb string
+	if len(args) > 0 && strings.Contains(args[0], ";") {
+		if _, err := common.LimbFromString(args[0]); err != nil {
+			return usage()
+		}
+		slaveLimb = args[0]
+		args = args[1:]
+	} else {
+		var err error
+		if slaveLimb, err = ms.currentSlaveLimb(ctx); err != nil {
+			return err
+		}
+	}
+	if slaveLimb == "" || len(args) > 2 {
+		return usage()
+	}
+
+	var from, to string
+	if len(args) > 0 {
+		from = args[0]
+	}
+	if len(args) > 1 {
+		to = args[1]
+	}
+	start, end, err := export.ParseRange(from, to)
+	if err != nil {
+		_, err := ctx.EffectiveMessage.Reply(
+			bot,
+			fmt.Sprintf("*[FAIL]: %s*", common.EscapeText("Markdown", err.Error())),
+			&gotgbot.SendMessageOpts{ParseMode: "Markdown", MessageThreadId: threadID},
+		)
+		return err
+	}
+
+	opts := &export.Options{
+		SlaveLimb: slaveLimb,
+		From:      start,
+		To:        end,
+		Fetch:     ms.download,
+	}
+	if chat, err := manager.GetChat(slaveLimb); err == nil && chat != nil {
+		opts.Title = chat.Title
+	}
+
+	go ms.exportChat(ctx.EffectiveMessage, opts)
+
+	return nil
+}
+
+// slave chat of current topic, or the only chat linked to current group
+func (ms *MasterService) currentSlaveLimb(ctx *ext.Context) (string, error) {
+	masterLimb := common.Limb{
+		Type:   "telegram",
+		UID:    common.Itoa(ms.config().Master.AdminID),
+		ChatID: common.Itoa(ctx.EffectiveChat.Id),
+	}.String()
+
+	if ctx.EffectiveChat.IsForum && ctx.EffectiveMessage.MessageThreadId != 0 {
+		topic, err := manager.GetTopicByMaster(masterLimb, ctx.EffectiveMessage.MessageThreadId)
+		if err != nil {
+			log.Warnf("Get topic by master failed: %v", err)
+			return "", err
+		}
+		if topic != nil {
+			return topic.SlaveLimb, nil
+		}
+		return "", nil
+	}
+
+	links, err := manager.GetLinksByMaster(masterLimb)
+	if err != nil {
+		log.Warnf("Get links by master failed: %v", err)
+		return "", err
+	}
+	if len(links) == 1 {
+		return links[0].SlaveLimb, nil
+	}
+	return "", nil
+}
+
+func (ms *MasterService) exportChat(rawMsg *gotgbot.Message, opts *export.Options) {
+	defer func() {
+		panicErr := recover()
+		if panicErr != nil {
+			log.Errorf("Panic in export chat: %+v %v\n%s", opts, panicErr, debug.Stack())
+		}
+	}()
+
+	status, err := rawMsg.Reply(
+		ms.bot,
+		fmt.Sprintf("*[EXPORTING]: %s*", common.EscapeText("Markdown", opts.SlaveLimb)),
+		&gotgbot.SendMessageOpts{
+			ParseMode:           "Markdown",
+			MessageThreadId:     rawMsg.MessageThreadId,
+			DisableNotification: true,
+		},
+	)
+	if err != nil {
+		log.Warnf("Failed to send export status: %v", err)
+		return
+	}
+
+	fail := func(err error) {
+		log.Warnf("Failed to export %s: %v", opts.SlaveLimb, err)
+		if _, _, err := status.EditText(
+			ms.bot,
+			fmt.Sprintf("*[FAIL]: %s*", common.EscapeText("Markdown", err.Error())),
+			&gotgbot.EditMessageTextOpts{ParseMode: "Markdown"},
+		); err != nil {
+			log.Warnf("Failed to update export status: %v", err)
+		}
+	}
+
+	htmlFile, err := os.CreateTemp("", "octopus-export-*.html")
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer os.Remove(htmlFile.Name())
+	defer htmlFile.Close()
+
+	jsonFile, err := os.CreateTemp("", "octopus-export-*.json")
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer os.Remove(jsonFile.Name())
+	defer jsonFile.Close()
+
+	result, err := export.Export(opts, htmlFile, jsonFile)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	name := exportName(opts)
+	for _, doc := range []struct {
+		file *os.File
+		ext  string
+	}{
+		{htmlFile, ".html"},
+		{jsonFile, ".json"},
+	} {
+		if info, err := doc.file.Stat(); err != nil {
+			fail(err)
+			return
+		} else if !ms.config().Master.LocalMode && info.Size() > maxExportDocumentSize {
+			fail(fmt.Errorf("export size %s exceeds limit, use a shorter range or the export command line", formatSize(int(info.Size()))))
+			return
+		}
+		if _, err := doc.file.Seek(0, 0); err != nil {
+			fail(err)
+			return
+		}
+
+		if _, err := ms.bot.SendDocument(
+			rawMsg.Chat.Id,
+			gotgbot.InputFileByReader(name+doc.ext, doc.file),
+			&gotgbot.SendDocumentOpts{
+				MessageThreadId: rawMsg.MessageThreadId,
+				RequestOpts:     ms.opts,
+			},
+		); err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	if _, _, err := status.EditText(
+		ms.bot,
+		fmt.Sprintf("*[EXPORTED]: %d messages, %d media, %d missing*", result.Messages, result.Media, result.Missing),
+		&gotgbot.EditMessageTextOpts{ParseMode: "Markdown"},
+	); err != nil {
+		log.Warnf("Failed to update export status: %v", err)
+	}
+}
+
+func exportName(opts *export.Options) string {
+	name := strings.NewReplacer(";", "_", "/", "_").Replace(opts.SlaveLimb)
+	return fmt.Sprintf("%s_%s", name, time.Now().Format("20060102150405"))
+}
+
+// media type and file id of Telegram message
+func mediaOf(msg *gotgbot.Message) (string, string) {
+	switch {
+	case len(msg.Photo) > 0:
+		return "photo", msg.Photo[len(msg.Photo)-1].FileId
+	case msg.Sticker != nil:
+		return "sticker", msg.Sticker.FileId
+	case msg.Animation != nil:
+		return "animation", msg.Animation.FileId
+	case msg.Video != nil:
+		return "video", msg.Video.FileId
+	case msg.Voice != nil:
+		return "voice", msg.Voice.FileId
+	case msg.Audio != nil:
+		return "audio", msg.Audio.FileId
+	case msg.Document != nil:
+		return "document", msg.Document.FileId
+	}
+	return "", ""
+}
@@ -0,0 +1,134 @@
+package master
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+const forwardBatchDelay = 2 * time.Second
+
+type forwardBatch struct {
+	event    *common.OctopusEvent
+	rawMsgs  []*gotgbot.Message
+	messages []*common.OctopusEvent
+	timer    *time.Timer
+}
+
+// collect consecutive forwarded messages, and push them as one forward event
+func (ms *MasterService) batchForward(rawMsg *gotgbot.Message, event *common.OctopusEvent) {
+	origin := rawMsg.ForwardOrigin.MergeMessageOrigin()
+
+	message := *event
+	message.From = forwardSender(&origin)
+	message.Timestamp = origin.Date
+	message.Reply = nil
+	message.Callback = nil
+
+	key := fmt.Sprintf("%d%s%d%s%s", rawMsg.Chat.Id, common.VENDOR_SEP, rawMsg.MessageThreadId, common.VENDOR_SEP, event.Chat.ID)
+
+	ms.forwardsLock.Lock()
+	defer ms.forwardsLock.Unlock()
+
+	// timer already fired means the batch is being flushed
+	if batch, ok := ms.forwards[key]; ok && batch.timer.Stop() {
+		batch.rawMsgs = append(batch.rawMsgs, rawMsg)
+		batch.messages = append(batch.messages, &message)
+		batch.timer.Reset(forwardBatchDelay)
+		return
+	}
+
+	batch := &forwardBatch{
+		event:    event,
+		rawMsgs:  []*gotgbot.Message{rawMsg},
+		messages: []*common.OctopusEvent{&message},
+	}
+	batch.timer = time.AfterFunc(forwardBatchDelay, func() {
+		ms.forwardsLock.Lock()
+		if ms.forwards[key] == batch {
+			delete(ms.forwards, key)
+		}
+		ms.forwardsLock.Unlock()
+
+		ms.flushForward(batch)
+	})
+	ms.forwards[key] = batch
+}
+
+func (ms *MasterService) flushForward(batch *forwardBatch) {
+	// nothing to merge, send as it is
+	if len(batch.rawMsgs) == 1 {
+		if batch.event.Type == common.EventFile {
+			ms.trackUpload(batch.rawMsgs[0], batch.event)
+		}
+		ms.out <- batch.event
+		return
+	}
+
+	// handlers run concurrently, restore the original order
+	sort.Sort((*byMessageID)(batch))
+
+	event := *batch.event
+	event.Type = common.EventForward
+	event.Content = ""
+	event.Reply = nil
+	event.Data = &common.ForwardData{
+		Title:    "Forwarded messages",
+		Messages: batch.messages,
+	}
+	event.Sources = make([]*common.SourceMessage, 0, len(batch.rawMsgs))
+	for _, rawMsg := range batch.rawMsgs {
+		event.Sources = append(event.Sources, sourceOf(rawMsg))
+	}
+	event.Callback = ms.transferCallback(event.Sources)
+
+	ms.out <- &event
+}
+
+type byMessageID forwardBatch
+
+func (b *byMessageID) Len() int {
+	return len(b.rawMsgs)
+}
+
+func (b *byMessageID) Less(i, j int) bool {
+	return b.rawMsgs[i].MessageId < b.rawMsgs[j].MessageId
+}
+
+func (b *byMessageID) Swap(i, j int) {
+	b.rawMsgs[i], b.rawMsgs[j] = b.rawMsgs[j], b.rawMsgs[i]
+	b.messages[i], b.messages[j] = b.messages[j], b.messages[i]
+}
+
+func forwardSender(origin *gotgbot.MergedMessageOrigin) common.User {
+	switch origin.Type {
+	case "user":
+		name := strings.TrimSpace(origin.SenderUser.FirstName + " " + origin.SenderUser.LastName)
+		return common.User{
+			ID:       common.Itoa(origin.SenderUser.Id),
+			Username: cmp.Or(name, origin.SenderUser.Username),
+		}
+	case "hidden_user":
+		return common.User{
+			Username: origin.SenderUserName,
+		}
+	case "chat":
+		return common.User{
+			ID:       common.Itoa(origin.SenderChat.Id),
+			Username: cmp.Or(origin.AuthorSignature, origin.SenderChat.Title),
+		}
+	case "channel":
+		return common.User{
+			ID:       common.Itoa(origin.Chat.Id),
+			Username: cmp.Or(origin.AuthorSignature, origin.Chat.Title),
+		}
+	}
+
+	return common.User{}
+}
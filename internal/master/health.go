@@ -0,0 +1,86 @@
+package master
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+const (
+	// getUpdates returns at least every updateTimeout, unless hung until requestTimeout
+	updaterStaleAfter = requestTimeout
+	healthTimeout     = 5 * time.Second
+)
+
+// updatesTracker records the last successful getUpdates of updater
+type updatesTracker struct {
+	gotgbot.BotClient
+	last *atomic.Int64
+}
+
+func (c updatesTracker) RequestWithContext(ctx context.Context, token string, method string, params map[string]string, data map[string]gotgbot.FileReader, opts *gotgbot.RequestOpts) (json.RawMessage, error) {
+	resp, err := c.BotClient.RequestWithContext(ctx, token, method, params, data, opts)
+	if err == nil && method == "getUpdates" {
+		c.last.Store(time.Now().Unix())
+	}
+	return resp, err
+}
+
+// health checks of Telegram bot, updater, slave loop and database
+func (ms *MasterService) HealthChecks() []common.HealthCheck {
+	return []common.HealthCheck{
+		{
+			Name:     "updater",
+			Liveness: true,
+			Check: func(_ context.Context) (string, error) {
+				last := time.Unix(ms.lastUpdates.Load(), 0)
+				if time.Since(last) > updaterStaleAfter {
+					return "", fmt.Errorf("no updates polled since %s", last.Format(time.DateTime))
+				}
+				return fmt.Sprintf("last polled at %s", last.Format(time.DateTime)), nil
+			},
+		},
+		{
+			Name:     "slave_loop",
+			Liveness: true,
+			Check: func(_ context.Context) (string, error) {
+				if !ms.slaveLoopRunning.Load() {
+					return "", errors.New("slave event loop exited")
+				}
+				return "running", nil
+			},
+		},
+		{
+			Name: "telegram",
+			Check: func(_ context.Context) (string, error) {
+				user, err := ms.bot.GetMe(&gotgbot.GetMeOpts{
+					RequestOpts: &gotgbot.RequestOpts{
+						Timeout: healthTimeout,
+						APIURL:  ms.config().Master.APIURL,
+					},
+				})
+				if err != nil {
+					return "", err
+				}
+				return "@" + user.Username, nil
+			},
+		},
+		{
+			Name: "database",
+			Check: func(_ context.Context) (string, error) {
+				if err := manager.CheckWritable(); err != nil {
+					return "", err
+				}
+				return "writable", nil
+			},
+		},
+	}
+}
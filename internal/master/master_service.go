@@ -2,11 +2,15 @@ package master
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/metrics"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
@@ -23,50 +27,46 @@ const (
 )
 
 type MasterService struct {
-	config *common.Configure
+	// swapped on config reload
+	conf atomic.Pointer[common.Configure]
 
 	in  <-chan *common.OctopusEvent
 	out chan<- *common.OctopusEvent
 
-	client  http.Client
-	opts    *gotgbot.RequestOpts
-	bot     *gotgbot.Bot
-	updater *ext.Updater
+	client      http.Client
+	opts        *gotgbot.RequestOpts
+	bot         *gotgbot.Bot
+	updater     *ext.Updater
+	stopUpdates sync.Once
 
-	archiveChats map[string]int64
+	forwards     map[string]*forwardBatch
+	forwardsLock sync.Mutex
+
+	syncRequests     map[string]struct{}
+	syncRequestsLock sync.Mutex
 
 	mutex common.KeyMutex
-}
 
-func (ms *MasterService) Start() {
-	ms.client = http.Client{}
-	ms.opts = &gotgbot.RequestOpts{
-		Timeout: requestTimeout,
-		APIURL:  ms.config.Master.APIURL,
-	}
+	lastUpdates      atomic.Int64
+	slaveLoopRunning atomic.Bool
 
-	if ms.config.Master.Proxy != "" {
-		proxyUrl, err := url.Parse(ms.config.Master.Proxy)
-		if err != nil {
-			log.Panic(err)
-		}
-		ms.client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyUrl)}
-	}
+	// slave events being processed
+	inflight atomic.Int64
 
-	bot, err := gotgbot.NewBot(ms.config.Master.Token, &gotgbot.BotOpts{
-		BotClient: &gotgbot.BaseBotClient{
-			Client:             ms.client,
-			DefaultRequestOpts: ms.opts,
-		},
-		RequestOpts: &gotgbot.RequestOpts{
-			Timeout: requestTimeout,
-			APIURL:  ms.config.Master.APIURL,
-		},
-	})
-	if err != nil {
-		log.Panic("failed to create new bot: " + err.Error())
+	// whether limb of vendor accepts merged forward
+	forwardSupport func(vendor string) bool
+
+	// enabled rules compiled, reset on change
+	rules atomic.Pointer[[]*ruleMatcher]
+
+	done chan struct{}
+}
+
+func (ms *MasterService) Start() {
+	if err := ms.initBot(); err != nil {
+		log.Panic(err)
 	}
-	ms.bot = bot
+	bot := ms.bot
 
 	dispatcher := ext.NewDispatcher(&ext.DispatcherOpts{
 		Error: func(b *gotgbot.Bot, ctx *ext.Context, err error) ext.DispatcherAction {
@@ -81,8 +81,9 @@ func (ms *MasterService) Start() {
 	dispatcher.AddHandler(handlers.NewMessage(message.All, ms.onMessage))
 
 	log.Infof("MasterService starting for %s", bot.User.Username)
-	err = ms.updater.StartPolling(bot, &ext.PollingOpts{
-		DropPendingUpdates: true,
+	ms.lastUpdates.Store(time.Now().Unix())
+	err := ms.updater.StartPolling(bot, &ext.PollingOpts{
+		DropPendingUpdates: false, // updates arrived while stopped are handled on start
 		GetUpdatesOpts: &gotgbot.GetUpdatesOpts{
 			Timeout:     updateTimeout,
 			RequestOpts: ms.opts,
@@ -92,32 +93,105 @@ func (ms *MasterService) Start() {
 		log.Panic("failed to start polling: " + err.Error())
 	}
 
+	ms.seedArchives()
+
 	go ms.updater.Idle()
 	go ms.handleSlaveLoop()
+
+	retention := ms.config().Database.Retention
+	go ms.runPeriodically(retention.PurgeInterval, ms.purgeMessages)
+	go ms.runPeriodically(retention.VacuumInterval, ms.vacuum)
+}
+
+func (ms *MasterService) initBot() error {
+	ms.client = http.Client{}
+	ms.opts = &gotgbot.RequestOpts{
+		Timeout: requestTimeout,
+		APIURL:  ms.config().Master.APIURL,
+	}
+
+	if ms.config().Master.Proxy != "" {
+		proxyUrl, err := url.Parse(ms.config().Master.Proxy)
+		if err != nil {
+			return err
+		}
+		ms.client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyUrl)}
+	}
+
+	bot, err := gotgbot.NewBot(ms.config().Master.Token, &gotgbot.BotOpts{
+		BotClient: updatesTracker{
+			BotClient: metrics.BotClient{
+				BotClient: &gotgbot.BaseBotClient{
+					Client:             ms.client,
+					DefaultRequestOpts: ms.opts,
+				},
+			},
+			last: &ms.lastUpdates,
+		},
+		RequestOpts: &gotgbot.RequestOpts{
+			Timeout: requestTimeout,
+			APIURL:  ms.config().Master.APIURL,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create new bot: %v", err)
+	}
+	ms.bot = bot
+
+	return nil
 }
 
 func (ms *MasterService) Stop() {
 	log.Infoln("MasterService stopping")
-	ms.updater.Stop()
+	close(ms.done)
+	ms.StopUpdates()
 }
 
-func NewMasterService(config *common.Configure, in <-chan *common.OctopusEvent, out chan<- *common.OctopusEvent) *MasterService {
-	archiveChats := make(map[string]int64)
-	for _, archive := range config.Master.Archive {
-		vendor := &common.Vendor{
-			Type: archive.Vendor,
-			UID:  archive.UID,
+// StopUpdates stop polling Telegram, and wait for running update handlers
+func (ms *MasterService) StopUpdates() {
+	ms.stopUpdates.Do(func() {
+		if err := ms.updater.Stop(); err != nil {
+			log.Warnf("Failed to stop updater: %v", err)
 		}
-		archiveChats[vendor.String()] = archive.ChatID
-	}
+	})
+}
 
-	return &MasterService{
-		config:       config,
+// Pending slave events being processed and forward batches not sent yet
+func (ms *MasterService) Pending() int {
+	ms.forwardsLock.Lock()
+	forwards := len(ms.forwards)
+	ms.forwardsLock.Unlock()
+
+	return int(ms.inflight.Load()) + forwards
+}
+
+func NewMasterService(config *common.Configure, in <-chan *common.OctopusEvent, out chan<- *common.OctopusEvent) *MasterService {
+	ms := &MasterService{
 		in:           in,
 		out:          out,
-		archiveChats: archiveChats,
+		forwards:     make(map[string]*forwardBatch),
+		syncRequests: make(map[string]struct{}),
 		mutex:        common.NewHashed(47),
+		done:         make(chan struct{}),
 	}
+	ms.conf.Store(config)
+
+	return ms
+}
+
+func (ms *MasterService) config() *common.Configure {
+	return ms.conf.Load()
+}
+
+// SetForwardSupport tell vendors accepting merged forward, must be called before Start
+func (ms *MasterService) SetForwardSupport(support func(vendor string) bool) {
+	ms.forwardSupport = support
+}
+
+// SetConfig apply reloaded config, bot and polling settings need restart
+func (ms *MasterService) SetConfig(config *common.Configure) {
+	ms.conf.Store(config)
+	ms.seedArchives()
 }
 
 func (ms *MasterService) onMessage(bot *gotgbot.Bot, ctx *ext.Context) error {
@@ -127,13 +201,13 @@ func (ms *MasterService) onMessage(bot *gotgbot.Bot, ctx *ext.Context) error {
 	}
 
 	// Ignore strenger's message
-	if ctx.EffectiveMessage.From.Id != ms.config.Master.AdminID {
+	if ctx.EffectiveMessage.From.Id != ms.config().Master.AdminID {
 		return nil
 	}
 
 	// Handle command
 	if isCommand(ctx.EffectiveMessage) {
-		return onCommand(bot, ctx, ms.config)
+		return ms.onCommand(bot, ctx)
 	}
 
 	return ms.processMasterMessage(ctx)
@@ -147,9 +221,23 @@ func (ms *MasterService) onCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 	switch cb.Category {
 	case "link":
-		return handleLink(bot, ctx, ms.config, ctx.Update.CallbackQuery.From.Id, cb)
+		return handleLink(bot, ctx, ms.config(), ctx.Update.CallbackQuery.From.Id, cb)
 	case "chat":
-		return handleChat(bot, ctx, ms.config, ctx.Update.CallbackQuery.From.Id, cb)
+		return handleChat(bot, ctx, ms.config(), ctx.Update.CallbackQuery.From.Id, cb)
+	case "request":
+		return ms.handleRequest(bot, ctx, cb)
+	case "search":
+		return ms.handleSearch(bot, ctx, cb)
+	case "webhook":
+		return ms.handleWebhook(bot, ctx, cb)
+	case "archive":
+		return ms.handleArchive(bot, ctx, cb)
+	case "topic":
+		return ms.handleTopic(bot, ctx, cb)
+	case "notify":
+		return ms.handleNotify(bot, ctx, cb)
+	case "rule":
+		return ms.handleRule(bot, ctx, cb)
 	default:
 		return errors.New("invalid callback data")
 	}
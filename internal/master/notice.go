@@ -0,0 +1,94 @@
+package master
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+)
+
+var honorNames = map[string]string{
+	"talkative": "Talkative",
+	"performer": "Performer",
+	"legend":    "Legend",
+	"strong":    "Strong Newbie",
+	"emotion":   "Emotion",
+}
+
+// check notice visibility by config, shown by default
+func (ms *MasterService) isNoticeVisible(event *common.OctopusEvent) bool {
+	notice, ok := event.Data.(*common.NoticeData)
+	if !ok || notice == nil {
+		return true
+	}
+
+	return ms.config().Master.Notice[notice.Type] != common.VisibilityHide
+}
+
+// generate compact notice text
+func noticeText(event *common.OctopusEvent) string {
+	notice, ok := event.Data.(*common.NoticeData)
+	if !ok || notice == nil {
+		return event.Content
+	}
+
+	target := "Someone"
+	if notice.Target != nil {
+		target = displayName(notice.Target)
+	}
+	operator := "someone"
+	if notice.Operator != nil {
+		operator = displayName(notice.Operator)
+	}
+
+	switch notice.Type {
+	case common.NoticeGroupIncrease:
+		if notice.SubType == "invite" && notice.Operator != nil {
+			return fmt.Sprintf("%s was invited by %s", target, operator)
+		} else if notice.Operator != nil && notice.Target != nil && notice.Operator.ID != notice.Target.ID {
+			return fmt.Sprintf("%s joined the group, approved by %s", target, operator)
+		}
+		return fmt.Sprintf("%s joined the group", target)
+	case common.NoticeGroupDecrease:
+		switch notice.SubType {
+		case "kick":
+			return fmt.Sprintf("%s was removed by %s", target, operator)
+		case "kick_me":
+			return fmt.Sprintf("You were removed from the group by %s", operator)
+		}
+		return fmt.Sprintf("%s left the group", target)
+	case common.NoticeGroupBan:
+		if notice.SubType == "lift_ban" {
+			if notice.Target == nil {
+				return fmt.Sprintf("%s unmuted all members", operator)
+			}
+			return fmt.Sprintf("%s was unmuted by %s", target, operator)
+		}
+		if notice.Target == nil {
+			return fmt.Sprintf("%s muted all members", operator)
+		}
+		return fmt.Sprintf("%s was muted by %s for %s", target, operator, time.Duration(notice.Duration)*time.Second)
+	case common.NoticeGroupAdmin:
+		if notice.SubType == "unset" {
+			return fmt.Sprintf("%s is no longer an admin", target)
+		}
+		return fmt.Sprintf("%s became an admin", target)
+	case common.NoticePoke:
+		return fmt.Sprintf("%s poked %s", operator, target)
+	case common.NoticeLuckyKing:
+		return fmt.Sprintf("%s is the lucky king of %s's red packet", target, operator)
+	case common.NoticeHonor:
+		honor, ok := honorNames[notice.Honor]
+		if !ok {
+			honor = notice.Honor
+		}
+		return fmt.Sprintf("%s earned the %s honor", target, honor)
+	case common.NoticeGroupCard:
+		if notice.Card == "" {
+			return fmt.Sprintf("%s cleared the group card", target)
+		}
+		return fmt.Sprintf("%s changed the group card to %s", target, notice.Card)
+	}
+
+	return event.Content
+}
@@ -0,0 +1,227 @@
+package master
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// send without notification by level of chat, quiet hours silence all chats except exceptions
+func (ms *MasterService) isSilent(event *common.OctopusEvent, slaveLimb, level string, replied []*manager.Message) bool {
+	quiet := ms.config().Master.QuietHours
+	if inQuietHours(quiet, time.Now()) &&
+		!slices.Contains(quiet.Exceptions, slaveLimb) && !slices.Contains(quiet.Exceptions, event.Chat.ID) {
+		return true
+	}
+
+	switch level {
+	case manager.NotifySilent:
+		return true
+	case manager.NotifyMentions:
+		return !mentionsMe(event, replied)
+	default:
+		return false
+	}
+}
+
+// private message, mention or reply to the limb account, replied are logged messages quoted by event
+func mentionsMe(event *common.OctopusEvent, replied []*manager.Message) bool {
+	if event.Chat.Type == "private" {
+		return true
+	}
+	if event.Reply != nil {
+		// clients fill only id of quoted message, sender comes from message log
+		if event.Reply.Sender == event.Vendor.UID {
+			return true
+		}
+		for _, m := range replied {
+			if m.SlaveSender == event.Vendor.UID {
+				return true
+			}
+		}
+	}
+	return slices.Contains(event.Mentions, event.Vendor.UID) || slices.Contains(event.Mentions, common.MentionAll)
+}
+
+// daily range in time zone, may cross midnight
+func inQuietHours(quiet common.QuietHours, now time.Time) bool {
+	if quiet.Start == "" || quiet.End == "" {
+		return false
+	}
+	start, err := time.Parse("15:04", quiet.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", quiet.End)
+	if err != nil {
+		return false
+	}
+	loc, err := time.LoadLocation(quiet.TimeZone)
+	if err != nil {
+		loc = time.Local
+	}
+
+	now = now.In(loc)
+	minute := now.Hour()*60 + now.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+// keep message of muted chat searchable and exportable, it has no Telegram counterpart
+func (ms *MasterService) logMuted(event *common.OctopusEvent, slaveLimb string) {
+	elog := common.EventLog(event)
+	msg := &manager.Message{
+		MasterMsgID: "muted:" + event.Trace(),
+		SlaveLimb:   slaveLimb,
+		SlaveMsgID:  event.ID,
+		SlaveSender: event.From.ID,
+		Content:     event.Content,
+		Timestamp:   event.Timestamp,
+	}
+	if err := manager.AddMessage(msg); err != nil {
+		elog.Warnf("Failed to add muted message (%s, %s): %v", slaveLimb, event.ID, err)
+	} else {
+		elog.Debugf("Add muted message: %s, %s", slaveLimb, event.ID)
+	}
+}
+
+func (ms *MasterService) handleNotify(bot *gotgbot.Bot, ctx *ext.Context, cb Callback) error {
+	if ctx.Update.CallbackQuery.From.Id != ms.config().Master.AdminID {
+		return errors.New("notify from stranger")
+	}
+
+	switch cb.Acction {
+	case "close":
+		_, _, err := ctx.EffectiveMessage.EditText(
+			bot,
+			"_Done._",
+			&gotgbot.EditMessageTextOpts{ParseMode: "Markdown"},
+		)
+		return err
+	case "set":
+		if !slices.Contains(manager.NotifyLevels, cb.Query) {
+			return fmt.Errorf("invalid notify level %s", cb.Query)
+		}
+		if err := manager.SetNotifyLevel(cb.Data, cb.Query); err != nil {
+			log.Warnf("Set notify level of %s failed: %v", cb.Data, err)
+			return err
+		}
+	}
+
+	return ms.showNotify(bot, ctx, cb.Data)
+}
+
+// levels of slave chat to choose
+func (ms *MasterService) showNotify(bot *gotgbot.Bot, ctx *ext.Context, limb string) error {
+	level, err := manager.GetNotifyLevel(limb)
+	if err != nil {
+		log.Warnf("Get notify level of %s failed: %v", limb, err)
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<b>Notifications</b>\n\n")
+	if chat, err := manager.GetChat(limb); err == nil && chat != nil {
+		sb.WriteString(html.EscapeString(chat.Title) + "\n")
+	}
+	sb.WriteString(fmt.Sprintf("<code>%s</code>\n", html.EscapeString(limb)))
+	sb.WriteString("\n🔔 all: notify every message")
+	sb.WriteString("\n💬 mentions: notify only when mentioned or replied")
+	sb.WriteString("\n🔕 silent: never notify")
+	sb.WriteString("\n🔇 muted: keep in message log only")
+
+	row := []gotgbot.InlineKeyboardButton{}
+	for _, l := range manager.NotifyLevels {
+		text := notifyIcon(l) + " " + l
+		if l == level {
+			text = "✓ " + text
+		}
+		cb := Callback{
+			Category: "notify",
+			Acction:  "set",
+			Query:    l,
+			Data:     limb,
+		}
+		row = append(row, gotgbot.InlineKeyboardButton{Text: text, CallbackData: putCallback(cb)})
+	}
+	done := Callback{
+		Category: "notify",
+		Acction:  "close",
+	}
+	keyboard := [][]gotgbot.InlineKeyboardButton{
+		row[:2],
+		row[2:],
+		{{Text: "Done", CallbackData: putCallback(done)}},
+	}
+
+	_, _, err = ctx.EffectiveMessage.EditText(
+		bot,
+		sb.String(),
+		&gotgbot.EditMessageTextOpts{
+			ParseMode: "HTML",
+			ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+				InlineKeyboard: keyboard,
+			},
+		},
+	)
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	return err
+}
+
+// button to notification levels of slave chat
+func notifyButton(limb string) gotgbot.InlineKeyboardButton {
+	cb := Callback{
+		Category: "notify",
+		Acction:  "menu",
+		Data:     limb,
+	}
+	return gotgbot.InlineKeyboardButton{Text: "🔔 Notifications", CallbackData: putCallback(cb)}
+}
+
+// data of chat and link list callback showing notification levels
+const notifyListMode = "notify"
+
+// switch chat or link list between its own action and notification levels
+func notifyModeButton(category, query string, page int, notifyMode bool) gotgbot.InlineKeyboardButton {
+	cb := Callback{
+		Category: category,
+		Acction:  "list",
+		Query:    query,
+		Page:     page,
+	}
+	if notifyMode {
+		return gotgbot.InlineKeyboardButton{Text: "Back", CallbackData: putCallback(cb)}
+	}
+	cb.Data = notifyListMode
+	return gotgbot.InlineKeyboardButton{Text: "🔔 Notifications", CallbackData: putCallback(cb)}
+}
+
+func notifyIcon(level string) string {
+	switch level {
+	case manager.NotifyMentions:
+		return "💬"
+	case manager.NotifySilent:
+		return "🔕"
+	case manager.NotifyMuted:
+		return "🔇"
+	default:
+		return "🔔"
+	}
+}
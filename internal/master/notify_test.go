@@ -0,0 +1,60 @@
+package master
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/db"
+	"github.com/duo/octopus/internal/manager"
+)
+
+func TestMentionsMeByReply(t *testing.T) {
+	conn, err := db.Open(db.DriverSQLite, filepath.Join(t.TempDir(), "octopus.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	manager.Init(manager.NewSQLiteStore(conn))
+
+	vendor := common.Vendor{Type: "qq", UID: "10001"}
+	masterLimb := common.Limb{Type: "telegram", UID: "1", ChatID: "-100"}.String()
+	slaveLimb := common.Limb{Type: vendor.Type, UID: vendor.UID, ChatID: "30003"}.String()
+	for _, m := range []*manager.Message{
+		{MasterLimb: masterLimb, MasterMsgID: "1", SlaveLimb: slaveLimb, SlaveMsgID: "mine", SlaveSender: vendor.UID, Content: "hello", Timestamp: 1700000000},
+		{MasterLimb: masterLimb, MasterMsgID: "2", SlaveLimb: slaveLimb, SlaveMsgID: "theirs", SlaveSender: "20002", Content: "hi", Timestamp: 1700000001},
+	} {
+		if err := manager.AddMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// clients fill only id and timestamp of quoted message, never sender
+	cases := []struct {
+		name  string
+		reply *common.ReplyInfo
+		want  bool
+	}{
+		{"reply to me", &common.ReplyInfo{ID: "mine"}, true},
+		{"reply to me with timestamp", &common.ReplyInfo{ID: "mine", Timestamp: 1700000000}, true},
+		{"reply to other", &common.ReplyInfo{ID: "theirs"}, false},
+		{"reply to unknown", &common.ReplyInfo{ID: "missing"}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			event := &common.OctopusEvent{
+				Vendor: vendor,
+				Chat:   common.Chat{ID: "30003", Type: "group"},
+				Type:   common.EventText,
+				Reply:  c.reply,
+			}
+			replied, err := manager.GetMessagesBySlaveReply(slaveLimb, c.reply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mentionsMe(event, replied); got != c.want {
+				t.Errorf("mentionsMe = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -17,6 +17,8 @@ import (
 
 	"github.com/duo/octopus/internal/common"
 	"github.com/duo/octopus/internal/manager"
+	"github.com/duo/octopus/internal/metrics"
+	"github.com/duo/octopus/internal/webhook"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
@@ -36,10 +38,25 @@ type ChatInfo struct {
 	id       int64
 	threadID int64
 	title    string
+
+	// topic of archive or linked forum, lost if deleted in Telegram
+	topic     *manager.Topic
+	topicLost bool
+
+	// send without notification by level and quiet hours
+	silent bool
 }
 
-// read events from limb
+// read events from limb, keep reading after panic until channel closed
 func (ms *MasterService) handleSlaveLoop() {
+	ms.slaveLoopRunning.Store(true)
+	defer ms.slaveLoopRunning.Store(false)
+
+	for !ms.readSlaveEvents() {
+	}
+}
+
+func (ms *MasterService) readSlaveEvents() (closed bool) {
 	defer func() {
 		panicErr := recover()
 		if panicErr != nil {
@@ -48,31 +65,61 @@ func (ms *MasterService) handleSlaveLoop() {
 	}()
 
 	for event := range ms.in {
+		event.Trace()
+
+		// rules go first, dropped events reach neither metrics nor webhooks
+		var rule *manager.Rule
+		if event.Type != common.EventSync && event.Type != common.EventObserve {
+			if rule = ms.matchRule(event, slaveLimbOf(event)); rule != nil && rule.Action == manager.RuleDrop {
+				common.EventLog(event).Debugf("Drop event by rule #%d", rule.ID)
+				continue
+			}
+		}
+
+		metrics.Events.WithLabelValues("in", event.Vendor.String(), event.Type.String()).Inc()
+		webhook.Publish(webhook.DirectionIn, event)
+
+		ms.inflight.Add(1)
 		if event.Type == common.EventSync {
-			go ms.updateChats(event)
+			go func() {
+				defer ms.inflight.Add(-1)
+				ms.updateChats(event)
+			}()
 		} else {
 			event := event
 			go func() {
+				defer ms.inflight.Add(-1)
+
 				ms.mutex.LockKey(event.Chat.ID)
 				defer ms.mutex.UnlockKey(event.Chat.ID)
 
-				ms.processSlaveEvent(event)
+				ms.processSlaveEvent(event, rule)
 			}()
 		}
 	}
+
+	return true
+}
+
+func slaveLimbOf(event *common.OctopusEvent) string {
+	return common.Limb{
+		Type:   event.Vendor.Type,
+		UID:    event.Vendor.UID,
+		ChatID: event.Chat.ID,
+	}.String()
 }
 
 // process master message
 func (ms *MasterService) processMasterMessage(ctx *ext.Context) error {
 	masterLimb := common.Limb{
 		Type:   "telegram",
-		UID:    common.Itoa(ms.config.Master.AdminID),
+		UID:    common.Itoa(ms.config().Master.AdminID),
 		ChatID: common.Itoa(ctx.EffectiveChat.Id),
 	}.String()
 
 	rawMsg := ctx.EffectiveMessage
 
-	log.Debugf("Receive Telegram message: %+v", rawMsg)
+	log.Debugf("Receive Telegram message #%d in chat %s", rawMsg.MessageId, common.RedactID(common.Itoa(rawMsg.Chat.Id)))
 
 	// find linked limb chat
 	if ctx.EffectiveChat.IsForum {
@@ -149,6 +196,7 @@ func (ms *MasterService) transferMasterMessage(ctx *ext.Context, slaveLimb strin
 	}
 
 	rawMsg := ctx.EffectiveMessage
+	sources := []*common.SourceMessage{sourceOf(rawMsg)}
 
 	// generate a basic event
 	event := &common.OctopusEvent{
@@ -158,6 +206,7 @@ func (ms *MasterService) transferMasterMessage(ctx *ext.Context, slaveLimb strin
 		},
 		ID:        common.Itoa(rawMsg.MessageId),
 		Timestamp: rawMsg.Date,
+		TraceID:   common.NewTraceID(),
 		From: common.User{
 			ID:       limb.UID,
 			Username: me.Title,
@@ -168,11 +217,10 @@ func (ms *MasterService) transferMasterMessage(ctx *ext.Context, slaveLimb strin
 			ID:    limb.ChatID,
 			Title: chat.Title,
 		},
-		Type:    common.EventText,
-		Content: rawMsg.Text,
-		Callback: func(event *common.OctopusEvent, err error) {
-			ms.transferCallback(rawMsg, event, err)
-		},
+		Type:     common.EventText,
+		Content:  rawMsg.Text,
+		Callback: ms.transferCallback(sources),
+		Sources:  sources,
 	}
 
 	// process reply message
@@ -181,7 +229,7 @@ func (ms *MasterService) transferMasterMessage(ctx *ext.Context, slaveLimb strin
 		rawMsg.ReplyToMessage.MessageId != rawMsg.ReplyToMessage.MessageThreadId {
 		masterLimb := common.Limb{
 			Type:   "telegram",
-			UID:    common.Itoa(ms.config.Master.AdminID),
+			UID:    common.Itoa(ms.config().Master.AdminID),
 			ChatID: common.Itoa(ctx.EffectiveChat.Id),
 		}.String()
 		logMsg, err := manager.GetMessageByMasterMsgId(
@@ -278,7 +326,17 @@ func (ms *MasterService) transferMasterMessage(ctx *ext.Context, slaveLimb strin
 			Latitude:  rawMsg.Location.Latitude,
 		}
 	} else if rawMsg.Text == "" {
-		return fmt.Errorf("message type not support: %+v", rawMsg)
+		return fmt.Errorf("type of message #%d not support", rawMsg.MessageId)
+	}
+
+	// other limbs get forwarded messages one by one
+	if rawMsg.ForwardOrigin != nil && ms.forwardSupport != nil && ms.forwardSupport(event.Vendor.String()) {
+		ms.batchForward(rawMsg, event)
+		return nil
+	}
+
+	if event.Type == common.EventFile {
+		ms.trackUpload(rawMsg, event)
 	}
 
 	ms.out <- event
@@ -286,17 +344,48 @@ func (ms *MasterService) transferMasterMessage(ctx *ext.Context, slaveLimb strin
 	return nil
 }
 
-// process limb client event response
-func (ms *MasterService) transferCallback(rawMSg *gotgbot.Message, event *common.OctopusEvent, cbErr error) {
-	if cbErr != nil {
-		ms.replayLinkIssue(rawMSg, fmt.Sprintf("*[FAIL]: %s*", strings.NewReplacer("*", "\\*").Replace(cbErr.Error())))
-		return
+// RestoreCallback re-create callback of event persisted on shutdown, events without sources have none
+func (ms *MasterService) RestoreCallback(event *common.OctopusEvent) {
+	if len(event.Sources) > 0 {
+		event.Callback = ms.transferCallback(event.Sources)
+	}
+}
+
+// telegram message as source of event
+func sourceOf(rawMsg *gotgbot.Message) *common.SourceMessage {
+	source := &common.SourceMessage{
+		ChatID:    rawMsg.Chat.Id,
+		MessageID: rawMsg.MessageId,
+		ThreadID:  rawMsg.MessageThreadId,
+	}
+	source.MediaType, source.MediaFileID = mediaOf(rawMsg)
+	return source
+}
+
+// process limb client event response, failure is replied to first source
+func (ms *MasterService) transferCallback(sources []*common.SourceMessage) func(*common.OctopusEvent, error) {
+	return func(event *common.OctopusEvent, err error) {
+		if err != nil {
+			rawMsg := &gotgbot.Message{
+				MessageId:       sources[0].MessageID,
+				MessageThreadId: sources[0].ThreadID,
+				Chat:            gotgbot.Chat{Id: sources[0].ChatID},
+			}
+			ms.replayLinkIssue(rawMsg, fmt.Sprintf("*[FAIL]: %s*", strings.NewReplacer("*", "\\*").Replace(err.Error())))
+			return
+		}
+		for _, source := range sources {
+			ms.addTransferred(source, event)
+		}
 	}
+}
 
+// log message sent to limb client
+func (ms *MasterService) addTransferred(source *common.SourceMessage, event *common.OctopusEvent) {
 	masterLimb := common.Limb{
 		Type:   "telegram",
-		UID:    common.Itoa(ms.config.Master.AdminID),
-		ChatID: common.Itoa(rawMSg.Chat.Id),
+		UID:    common.Itoa(ms.config().Master.AdminID),
+		ChatID: common.Itoa(source.ChatID),
 	}.String()
 	slaveLimb := common.Limb{
 		Type:   event.Vendor.Type,
@@ -306,34 +395,38 @@ func (ms *MasterService) transferCallback(rawMSg *gotgbot.Message, event *common
 
 	msg := &manager.Message{
 		MasterLimb:        masterLimb,
-		MasterMsgID:       common.Itoa(rawMSg.MessageId),
-		MasterMsgThreadID: common.Itoa(rawMSg.MessageThreadId),
+		MasterMsgID:       common.Itoa(source.MessageID),
+		MasterMsgThreadID: common.Itoa(source.ThreadID),
 		SlaveLimb:         slaveLimb,
 		SlaveMsgID:        event.ID,
 		SlaveSender:       event.From.ID,
 		Content:           event.Content,
 		Timestamp:         event.Timestamp,
+		MediaType:         source.MediaType,
+		MediaFileID:       source.MediaFileID,
 	}
 
 	if err := manager.AddMessage(msg); err != nil {
-		log.Warnf("Failed to add message: %+v %v", msg, err)
+		common.EventLog(event).Warnf("Failed to add message (%s, %s): %v", msg.MasterLimb, msg.MasterMsgID, err)
 	} else {
-		log.Debugf("Add message: %+v", msg)
+		common.EventLog(event).Debugf("Add message: %s -> %s", msg.MasterMsgID, common.RedactID(msg.SlaveMsgID))
 	}
 }
 
-// process events from limb client
-func (ms *MasterService) processSlaveEvent(event *common.OctopusEvent) {
+// process events from limb client, with rule matched by it
+func (ms *MasterService) processSlaveEvent(event *common.OctopusEvent, rule *manager.Rule) {
+	elog := common.EventLog(event)
+
 	defer func() {
 		panicErr := recover()
 		if panicErr != nil {
-			log.Errorf("Panic in handle slave event: %+v %v\n%s", event, panicErr, debug.Stack())
+			elog.Errorf("Panic in handle slave event: %+v %v\n%s", event, panicErr, debug.Stack())
 		}
 	}()
 
-	log.Debugf("Receive octopus event: %+v", event)
+	elog.Debugf("Receive octopus event: %v", event)
 
-	adminID := ms.config.Master.AdminID
+	adminID := ms.config().Master.AdminID
 
 	// handle observe event
 	if event.Type == common.EventObserve {
@@ -346,77 +439,109 @@ func (ms *MasterService) processSlaveEvent(event *common.OctopusEvent) {
 		return
 	}
 
-	slaveLimb := common.Limb{
-		Type:   event.Vendor.Type,
-		UID:    event.Vendor.UID,
-		ChatID: event.Chat.ID,
-	}.String()
+	slaveLimb := slaveLimbOf(event)
+
+	// muted requests are not prompted either
+	if rule != nil {
+		elog.Debugf("Match rule #%d: %s", rule.ID, rule.Action)
+		if rule.Action == manager.RuleMute {
+			ms.logMuted(event, slaveLimb)
+			return
+		}
+	}
+
+	// handle friend/group request event
+	if event.Type == common.EventRequest {
+		ms.processRequest(event)
+		return
+	}
+
+	if event.Type == common.EventNotice && !ms.isNoticeVisible(event) {
+		elog.Debugf("Ignore hidden notice: %v", event)
+		return
+	}
+
+	level, err := manager.GetNotifyLevel(slaveLimb)
+	if err != nil {
+		elog.Warnf("Get notify level failed: %v", err)
+	}
+	if level == manager.NotifyMuted {
+		ms.logMuted(event, slaveLimb)
+		return
+	}
+
+	// messages quoted by event, for reply and notification
+	var replied []*manager.Message
+	if event.Reply != nil {
+		if replied, err = manager.GetMessagesBySlaveReply(slaveLimb, event.Reply); err != nil {
+			elog.Warnf("Get reply messages failed: %v", err)
+			return
+		}
+	}
+	silent := ms.isSilent(event, slaveLimb, level, replied)
 
 	links, err := manager.GetLinksBySlave(slaveLimb)
 	if err != nil {
-		log.Warnf("Get links by slave failed: %v", err)
+		elog.Warnf("Get links by slave failed: %v", err)
 		return
 	}
-	log.Debugf("Links by slave(%s): %+v", slaveLimb, links)
+	elog.Debugf("Links by slave(%s): %d", common.RedactID(slaveLimb), len(links))
 
 	var replyMap = map[int64]int64{}
 	// get reply map for quote and revoke
-	if event.Reply != nil {
-		messages, err := manager.GetMessagesBySlaveReply(slaveLimb, event.Reply)
+	for _, m := range replied {
+		// logged while muted, never sent
+		if m.MasterLimb == "" {
+			continue
+		}
+		limb, err := common.LimbFromString(m.MasterLimb)
 		if err != nil {
-			log.Warnf("Get reply messages failed: %v", err)
-			return
+			elog.Warnf("Parse limb(%v) failed: %v", m.MasterLimb, err)
+			continue
 		}
-		for _, m := range messages {
-			limb, err := common.LimbFromString(m.MasterLimb)
-			if err != nil {
-				log.Warnf("Parse limb(%v) failed: %v", m.MasterLimb, err)
-				continue
-			}
-			chatID, err := common.Atoi(limb.ChatID)
-			if err != nil {
-				log.Warnf("Parse chatId(%v) failed: %v", limb.ChatID, err)
-				continue
-			}
-			masterMsgID, err := common.Atoi(m.MasterMsgID)
-			if err != nil {
-				log.Warnf("Parse mastetMsgId(%v) failed: %v", m.MasterMsgID, err)
-				continue
-			}
-			replyMap[chatID] = masterMsgID
+		chatID, err := common.Atoi(limb.ChatID)
+		if err != nil {
+			elog.Warnf("Parse chatId(%v) failed: %v", limb.ChatID, err)
+			continue
 		}
+		masterMsgID, err := common.Atoi(m.MasterMsgID)
+		if err != nil {
+			elog.Warnf("Parse mastetMsgId(%v) failed: %v", m.MasterMsgID, err)
+			continue
+		}
+		replyMap[chatID] = masterMsgID
 	}
 
 	chats := []*ChatInfo{}
 
-	if len(links) > 0 {
+	if rule != nil && rule.Action == manager.RuleRoute {
+		// send to Telegram chat of rule instead
+		chatID, err := common.Atoi(rule.Target)
+		if err != nil {
+			elog.Warnf("Parse target(%v) of rule #%d failed: %v", rule.Target, rule.ID, err)
+			return
+		}
+		if chat := ms.linkedChatInfo(chatID, event); chat != nil {
+			chats = append(chats, chat)
+		}
+	} else if len(links) > 0 {
 		// find linked Telegram chat
 		for _, l := range links {
 			limb, err := common.LimbFromString(l.MasterLimb)
 			if err != nil {
-				log.Warnf("Parse limb(%v) failed: %v", l.MasterLimb, err)
+				elog.Warnf("Parse limb(%v) failed: %v", l.MasterLimb, err)
 				continue
 			}
 			chatID, err := common.Atoi(limb.ChatID)
 			if err != nil {
-				log.Warnf("Parse chatId(%v) failed: %v", limb.ChatID, err)
-				continue
-			}
-			chat, err := ms.bot.GetChat(chatID, nil)
-			if err != nil {
-				log.Warnf("Failed to get chat(%d) info from Telegram: %v", chatID, err)
+				elog.Warnf("Parse chatId(%v) failed: %v", limb.ChatID, err)
 				continue
 			}
-			if chat.IsForum {
-				chats = append(chats, ms.createForumChatInfo(chatID, event))
-			} else {
-				chats = append(chats, &ChatInfo{
-					id:    chatID,
-					title: fmt.Sprintf("%s:", displayName(&event.From)),
-				})
+			if chat := ms.linkedChatInfo(chatID, event); chat != nil {
+				chats = append(chats, chat)
 			}
 		}
-	} else if chatID, ok := ms.archiveChats[event.Vendor.String()]; ok {
+	} else if chatID, ok := ms.archiveChat(event); ok {
 		// find archive supergroup (topic enabled)
 		chats = append(chats, ms.createForumChatInfo(chatID, event))
 	} else {
@@ -433,270 +558,287 @@ func (ms *MasterService) processSlaveEvent(event *common.OctopusEvent) {
 	}
 
 	for _, chat := range chats {
+		chat.silent = silent
+		if rule != nil && rule.Action == manager.RuleTag {
+			chat.title = ruleTag(rule) + " " + chat.title
+		}
+
 		var replyToMessageID int64 = 0
 		if val, ok := replyMap[chat.id]; ok {
 			replyToMessageID = val
 		}
 
-		switch event.Type {
-		case common.EventRevoke:
-			ms.bot.SendChatAction(chat.id, "typing", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
-			resp, err := ms.bot.SendMessage(
-				chat.id,
-				fmt.Sprintf(
-					"%s\n~%s~",
-					common.EscapeText("MarkdownV2", chat.title),
-					common.EscapeText("MarkdownV2", event.Content),
-				),
-				&gotgbot.SendMessageOpts{
-					ParseMode:       "MarkdownV2",
-					MessageThreadId: chat.threadID,
-					ReplyParameters: &gotgbot.ReplyParameters{
-						MessageId: replyToMessageID,
-					},
+		ms.sendEvent(chat, replyToMessageID, event)
+
+		// topic deleted in Telegram, send again to a new one
+		if chat.topicLost && ms.recreateTopic(chat, event) {
+			ms.sendEvent(chat, 0, event)
+		}
+	}
+}
+
+// send event to Telegram chat or topic
+func (ms *MasterService) sendEvent(chat *ChatInfo, replyToMessageID int64, event *common.OctopusEvent) {
+	elog := common.EventLog(event)
+	adminID := ms.config().Master.AdminID
+
+	switch event.Type {
+	case common.EventRevoke:
+		ms.bot.SendChatAction(chat.id, "typing", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
+		resp, err := ms.bot.SendMessage(
+			chat.id,
+			fmt.Sprintf(
+				"%s\n~%s~",
+				common.EscapeText("MarkdownV2", chat.title),
+				common.EscapeText("MarkdownV2", event.Content),
+			),
+			&gotgbot.SendMessageOpts{
+				ParseMode:           "MarkdownV2",
+				MessageThreadId:     chat.threadID,
+				DisableNotification: chat.silent,
+				ReplyParameters: &gotgbot.ReplyParameters{
+					MessageId: replyToMessageID,
 				},
-			)
-			ms.logMessage(chat, event, resp, err)
-		case common.EventText, common.EventSystem:
-			ms.bot.SendChatAction(chat.id, "typing", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
-			resp, err := ms.bot.SendMessage(
-				chat.id,
-				fmt.Sprintf("%s\n%s", chat.title, event.Content),
-				&gotgbot.SendMessageOpts{
-					MessageThreadId: chat.threadID,
-					ReplyParameters: &gotgbot.ReplyParameters{
-						MessageId: replyToMessageID,
-					},
+			},
+		)
+		ms.logMessage(chat, event, resp, err)
+	case common.EventText, common.EventSystem:
+		ms.bot.SendChatAction(chat.id, "typing", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
+		resp, err := ms.bot.SendMessage(
+			chat.id,
+			fmt.Sprintf("%s\n%s", chat.title, event.Content),
+			&gotgbot.SendMessageOpts{
+				MessageThreadId:     chat.threadID,
+				DisableNotification: chat.silent,
+				ReplyParameters: &gotgbot.ReplyParameters{
+					MessageId: replyToMessageID,
 				},
-			)
-			ms.logMessage(chat, event, resp, err)
-		case common.EventVoIP:
-			ms.bot.SendChatAction(chat.id, "typing", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
-			resp, err := ms.bot.SendMessage(
-				chat.id,
-				fmt.Sprintf(
-					"%s\n_%s_",
-					common.EscapeText("MarkdownV2", chat.title),
-					common.EscapeText("MarkdownV2", event.Content),
-				),
-				&gotgbot.SendMessageOpts{
-					ParseMode:       "MarkdownV2",
-					MessageThreadId: chat.threadID,
-					ReplyParameters: &gotgbot.ReplyParameters{
-						MessageId: replyToMessageID,
-					},
+			},
+		)
+		ms.logMessage(chat, event, resp, err)
+	case common.EventNotice:
+		text := noticeText(event)
+		if chat.id == adminID {
+			text = fmt.Sprintf("[%s] %s", event.Chat.Title, text)
+		}
+		resp, err := ms.bot.SendMessage(
+			chat.id,
+			fmt.Sprintf("<i>%s</i>", html.EscapeString(text)),
+			&gotgbot.SendMessageOpts{
+				ParseMode:           "HTML",
+				MessageThreadId:     chat.threadID,
+				DisableNotification: true,
+			},
+		)
+		ms.logMessage(chat, event, resp, err)
+	case common.EventVoIP:
+		ms.bot.SendChatAction(chat.id, "typing", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
+		resp, err := ms.bot.SendMessage(
+			chat.id,
+			fmt.Sprintf(
+				"%s\n_%s_",
+				common.EscapeText("MarkdownV2", chat.title),
+				common.EscapeText("MarkdownV2", event.Content),
+			),
+			&gotgbot.SendMessageOpts{
+				ParseMode:           "MarkdownV2",
+				MessageThreadId:     chat.threadID,
+				DisableNotification: chat.silent,
+				ReplyParameters: &gotgbot.ReplyParameters{
+					MessageId: replyToMessageID,
 				},
-			)
-			ms.logMessage(chat, event, resp, err)
-		case common.EventLocation:
-			location := event.Data.(*common.LocationData)
-			resp, err := ms.bot.SendVenue(
-				chat.id,
-				location.Latitude,
-				location.Longitude,
-				fmt.Sprintf("%s %s", chat.title, location.Name),
-				location.Address,
-				&gotgbot.SendVenueOpts{
-					MessageThreadId: chat.threadID,
-					ReplyParameters: &gotgbot.ReplyParameters{
-						MessageId: replyToMessageID,
-					},
+			},
+		)
+		ms.logMessage(chat, event, resp, err)
+	case common.EventLocation:
+		location := event.Data.(*common.LocationData)
+		resp, err := ms.bot.SendVenue(
+			chat.id,
+			location.Latitude,
+			location.Longitude,
+			fmt.Sprintf("%s %s", chat.title, location.Name),
+			location.Address,
+			&gotgbot.SendVenueOpts{
+				MessageThreadId:     chat.threadID,
+				DisableNotification: chat.silent,
+				ReplyParameters: &gotgbot.ReplyParameters{
+					MessageId: replyToMessageID,
 				},
-			)
-			ms.logMessage(chat, event, resp, err)
-		case common.EventApp:
-			app := event.Data.(*common.AppData)
-			text := fmt.Sprintf("%s\n<u>%s</u>\n\n%s",
-				chat.title,
-				html.EscapeString(app.Title),
-				html.EscapeString(app.Description),
-			)
-			if app.URL != "" {
-				source := html.EscapeString(app.Source)
-				if source == "" {
-					source = app.URL
-				}
-				text = fmt.Sprintf("%s\n\nvia <a href=\"%s\">%s</a>",
-					text,
-					app.URL,
-					source,
-				)
+			},
+		)
+		ms.logMessage(chat, event, resp, err)
+	case common.EventApp:
+		app := event.Data.(*common.AppData)
+		text := fmt.Sprintf("%s\n<u>%s</u>\n\n%s",
+			chat.title,
+			html.EscapeString(app.Title),
+			html.EscapeString(app.Description),
+		)
+		if app.URL != "" {
+			source := html.EscapeString(app.Source)
+			if source == "" {
+				source = app.URL
 			}
+			text = fmt.Sprintf("%s\n\nvia <a href=\"%s\">%s</a>",
+				text,
+				app.URL,
+				source,
+			)
+		}
 
-			if ms.config.Master.Telegraph.Enable && len(ms.config.Master.Telegraph.Tokens) > 0 && app.Content != "" {
-				if page, err := ms.postApp(app); err == nil {
-					text = fmt.Sprintf("%s\n<a href=\"%s\">%s</a>",
-						chat.title,
-						page.URL,
-						page.Title,
-					)
-				}
+		if ms.config().Master.Telegraph.Enable && len(ms.config().Master.Telegraph.Tokens) > 0 && app.Content != "" {
+			if page, err := ms.postApp(app); err == nil {
+				text = fmt.Sprintf("%s\n<a href=\"%s\">%s</a>",
+					chat.title,
+					page.URL,
+					page.Title,
+				)
 			}
+		}
 
-			ms.bot.SendChatAction(chat.id, "typing", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
-			resp, err := ms.bot.SendMessage(
-				chat.id,
-				text,
-				&gotgbot.SendMessageOpts{
-					MessageThreadId: chat.threadID,
-					ReplyParameters: &gotgbot.ReplyParameters{
-						MessageId: replyToMessageID,
-					},
-					ParseMode: "HTML",
+		ms.bot.SendChatAction(chat.id, "typing", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
+		resp, err := ms.bot.SendMessage(
+			chat.id,
+			text,
+			&gotgbot.SendMessageOpts{
+				MessageThreadId:     chat.threadID,
+				DisableNotification: chat.silent,
+				ReplyParameters: &gotgbot.ReplyParameters{
+					MessageId: replyToMessageID,
 				},
-			)
-			ms.logMessage(chat, event, resp, err)
-		case common.EventAudio:
-			ms.bot.SendChatAction(chat.id, "upload_voice", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
-			blob := event.Data.(*common.BlobData)
-			resp, err := ms.bot.SendVoice(
-				chat.id,
-				gotgbot.InputFileByReader(blob.Name, bytes.NewReader(blob.Binary)),
-				&gotgbot.SendVoiceOpts{
-					Caption:         fmt.Sprintf("%s\n%s", chat.title, event.Content),
-					MessageThreadId: chat.threadID,
-					ReplyParameters: &gotgbot.ReplyParameters{
-						MessageId: replyToMessageID,
-					},
+				ParseMode: "HTML",
+			},
+		)
+		ms.logMessage(chat, event, resp, err)
+	case common.EventAudio:
+		ms.bot.SendChatAction(chat.id, "upload_voice", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
+		blob := event.Data.(*common.BlobData)
+		resp, err := ms.bot.SendVoice(
+			chat.id,
+			gotgbot.InputFileByReader(blob.Name, bytes.NewReader(blob.Binary)),
+			&gotgbot.SendVoiceOpts{
+				Caption:             fmt.Sprintf("%s\n%s", chat.title, event.Content),
+				MessageThreadId:     chat.threadID,
+				DisableNotification: chat.silent,
+				ReplyParameters: &gotgbot.ReplyParameters{
+					MessageId: replyToMessageID,
 				},
-			)
-			ms.logMessage(chat, event, resp, err)
-		case common.EventVideo:
-			ms.bot.SendChatAction(chat.id, "upload_video", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
-			blob := event.Data.(*common.BlobData)
-			//mime := mimetype.Detect(blob.Binary)
-			//fileName := fmt.Sprintf("%s%s", msg.ID, mime.Extension())
-			text := fmt.Sprintf("%s\n%s", chat.title, event.Content)
-			resp, err := ms.bot.SendVideo(
+			},
+		)
+		ms.logMessage(chat, event, resp, err)
+	case common.EventVideo:
+		ms.bot.SendChatAction(chat.id, "upload_video", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
+		blob := event.Data.(*common.BlobData)
+		//mime := mimetype.Detect(blob.Binary)
+		//fileName := fmt.Sprintf("%s%s", msg.ID, mime.Extension())
+		text := fmt.Sprintf("%s\n%s", chat.title, event.Content)
+		resp, err := ms.bot.SendVideo(
+			chat.id,
+			//&gotgbot.NamedFile{
+			//	File:     bytes.NewReader(blob.Binary),
+			//	FileName: fileName,
+			//},
+			gotgbot.InputFileByReader(blob.Name, bytes.NewReader(blob.Binary)),
+			&gotgbot.SendVideoOpts{
+				Caption:             text,
+				MessageThreadId:     chat.threadID,
+				DisableNotification: chat.silent,
+				ReplyParameters: &gotgbot.ReplyParameters{
+					MessageId: replyToMessageID,
+				},
+			},
+		)
+		ms.logMessage(chat, event, resp, err)
+	case common.EventFile:
+		ms.bot.SendChatAction(chat.id, "upload_document", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
+		blob := event.Data.(*common.BlobData)
+		resp, err := ms.bot.SendDocument(
+			chat.id,
+			gotgbot.InputFileByReader(blob.Name, bytes.NewReader(blob.Binary)),
+			&gotgbot.SendDocumentOpts{
+				Caption:             chat.title,
+				MessageThreadId:     chat.threadID,
+				DisableNotification: chat.silent,
+				ReplyParameters: &gotgbot.ReplyParameters{
+					MessageId: replyToMessageID,
+				},
+			},
+		)
+		ms.logMessage(chat, event, resp, err)
+	case common.EventSticker:
+		blob := event.Data.(*common.BlobData)
+		if strings.HasSuffix(blob.Mime, "png") || strings.HasSuffix(blob.Mime, "webp") {
+			resp, err := ms.bot.SendSticker(
 				chat.id,
-				//&gotgbot.NamedFile{
-				//	File:     bytes.NewReader(blob.Binary),
-				//	FileName: fileName,
-				//},
 				gotgbot.InputFileByReader(blob.Name, bytes.NewReader(blob.Binary)),
-				&gotgbot.SendVideoOpts{
-					Caption:         text,
-					MessageThreadId: chat.threadID,
+				&gotgbot.SendStickerOpts{
+					MessageThreadId:     chat.threadID,
+					DisableNotification: chat.silent,
 					ReplyParameters: &gotgbot.ReplyParameters{
 						MessageId: replyToMessageID,
 					},
+					ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+						InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{
+							gotgbot.InlineKeyboardButton{
+								Text: fmt.Sprintf("%s\n%s", chat.title, event.Content),
+								Url:  "tg://sticker",
+							},
+						}},
+					},
 				},
 			)
 			ms.logMessage(chat, event, resp, err)
-		case common.EventFile:
-			ms.bot.SendChatAction(chat.id, "upload_document", &gotgbot.SendChatActionOpts{MessageThreadId: chat.threadID})
-			blob := event.Data.(*common.BlobData)
-			resp, err := ms.bot.SendDocument(
+		} else {
+			ms.sendPhoto(chat, replyToMessageID, blob, event)
+		}
+	case common.EventPhoto:
+		photos := event.Data.([]*common.BlobData)
+		if len(photos) == 1 {
+			ms.sendPhoto(chat, replyToMessageID, photos[0], event)
+		} else {
+			text := fmt.Sprintf("%s\n%s", chat.title, event.Content)
+			var mediaGroup []gotgbot.InputMedia
+			for i, photo := range photos {
+				if i == 10 {
+					break
+				}
+
+				caption := ""
+				if i == 0 {
+					caption = text
+				}
+
+				mediaGroup = append(mediaGroup, gotgbot.InputMediaPhoto{
+					Media:   gotgbot.InputFileByReader(photo.Name, bytes.NewReader(photo.Binary)),
+					Caption: caption,
+				})
+			}
+			resps, err := ms.bot.SendMediaGroup(
 				chat.id,
-				gotgbot.InputFileByReader(blob.Name, bytes.NewReader(blob.Binary)),
-				&gotgbot.SendDocumentOpts{
-					Caption:         chat.title,
-					MessageThreadId: chat.threadID,
+				mediaGroup,
+				&gotgbot.SendMediaGroupOpts{
+					MessageThreadId:     chat.threadID,
+					DisableNotification: chat.silent,
 					ReplyParameters: &gotgbot.ReplyParameters{
 						MessageId: replyToMessageID,
 					},
 				},
 			)
-			ms.logMessage(chat, event, resp, err)
-		case common.EventSticker:
-			blob := event.Data.(*common.BlobData)
-			if strings.HasSuffix(blob.Mime, "png") || strings.HasSuffix(blob.Mime, "webp") {
-				resp, err := ms.bot.SendSticker(
-					chat.id,
-					gotgbot.InputFileByReader(blob.Name, bytes.NewReader(blob.Binary)),
-					&gotgbot.SendStickerOpts{
-						MessageThreadId: chat.threadID,
-						ReplyParameters: &gotgbot.ReplyParameters{
-							MessageId: replyToMessageID,
-						},
-						ReplyMarkup: gotgbot.InlineKeyboardMarkup{
-							InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{
-								gotgbot.InlineKeyboardButton{
-									Text: fmt.Sprintf("%s\n%s", chat.title, event.Content),
-									Url:  "tg://sticker",
-								},
-							}},
-						},
-					},
-				)
-				ms.logMessage(chat, event, resp, err)
-			} else {
-				ms.sendPhoto(chat, replyToMessageID, blob, event)
-			}
-		case common.EventPhoto:
-			photos := event.Data.([]*common.BlobData)
-			if len(photos) == 1 {
-				ms.sendPhoto(chat, replyToMessageID, photos[0], event)
+			if err != nil {
+				elog.Warnf("Failed to send to Telegram (chat %d, %d): %v", chat.id, chat.threadID, err)
+				chat.topicLost = chat.topic != nil && isTopicNotFound(err)
 			} else {
-				text := fmt.Sprintf("%s\n%s", chat.title, event.Content)
-				var mediaGroup []gotgbot.InputMedia
-				for i, photo := range photos {
-					if i == 10 {
-						break
-					}
-
-					caption := ""
-					if i == 0 {
-						caption = text
-					}
-
-					mediaGroup = append(mediaGroup, gotgbot.InputMediaPhoto{
-						Media:   gotgbot.InputFileByReader(photo.Name, bytes.NewReader(photo.Binary)),
-						Caption: caption,
-					})
-				}
-				resps, err := ms.bot.SendMediaGroup(
-					chat.id,
-					mediaGroup,
-					&gotgbot.SendMediaGroupOpts{
-						MessageThreadId: chat.threadID,
-						ReplyParameters: &gotgbot.ReplyParameters{
-							MessageId: replyToMessageID,
-						},
-					},
-				)
-				if err != nil {
-					log.Warnf("Failed to send to Telegram (chat %d, %d): %v", chat.id, chat.threadID, err)
-				} else {
-					for _, resp := range resps {
-						ms.logMessage(chat, event, &resp, err)
-					}
+				for _, resp := range resps {
+					ms.logMessage(chat, event, &resp, err)
 				}
 			}
-		default:
-			log.Warnf("event type not support: %s", event.Type)
 		}
+	default:
+		elog.Warnf("event type not support: %s", event.Type)
 	}
 }
 
 // update chats from limb client
-func (ms *MasterService) updateChats(event *common.OctopusEvent) {
-	defer func() {
-		panicErr := recover()
-		if panicErr != nil {
-			log.Errorf("Panic in update chats event: %+v %v\n%s", event, panicErr, debug.Stack())
-		}
-	}()
-
-	chats := event.Data.([]*common.Chat)
-	log.Infof("Update chats for %s, count: %d", event.Vendor, len(chats))
-	for _, c := range chats {
-		limb := common.Limb{
-			Type:   event.Vendor.Type,
-			UID:    event.Vendor.UID,
-			ChatID: c.ID,
-		}.String()
-		chat := &manager.Chat{
-			Limb:     limb,
-			ChatType: c.Type,
-			Title:    c.Title,
-		}
-		if err := manager.AddOrUpdateChat(chat); err != nil {
-			log.Warnf("Failed to add or update chat: %v", err)
-		}
-	}
-}
-
 func (ms *MasterService) sendPhoto(chat *ChatInfo, replyToMessageID int64, photo *common.BlobData, event *common.OctopusEvent) {
 	text := fmt.Sprintf("%s\n%s", chat.title, event.Content)
 
@@ -707,8 +849,9 @@ func (ms *MasterService) sendPhoto(chat *ChatInfo, replyToMessageID int64, photo
 			chat.id,
 			gotgbot.InputFileByReader(photo.Name+".gif", bytes.NewReader(photo.Binary)),
 			&gotgbot.SendAnimationOpts{
-				Caption:         text,
-				MessageThreadId: chat.threadID,
+				Caption:             text,
+				MessageThreadId:     chat.threadID,
+				DisableNotification: chat.silent,
 				ReplyParameters: &gotgbot.ReplyParameters{
 					MessageId: replyToMessageID,
 				},
@@ -720,8 +863,9 @@ func (ms *MasterService) sendPhoto(chat *ChatInfo, replyToMessageID int64, photo
 			chat.id,
 			gotgbot.InputFileByReader(photo.Name, bytes.NewReader(photo.Binary)),
 			&gotgbot.SendDocumentOpts{
-				Caption:         text,
-				MessageThreadId: chat.threadID,
+				Caption:             text,
+				MessageThreadId:     chat.threadID,
+				DisableNotification: chat.silent,
 				ReplyParameters: &gotgbot.ReplyParameters{
 					MessageId: replyToMessageID,
 				},
@@ -733,8 +877,9 @@ func (ms *MasterService) sendPhoto(chat *ChatInfo, replyToMessageID int64, photo
 			chat.id,
 			gotgbot.InputFileByReader(photo.Name, bytes.NewReader(photo.Binary)),
 			&gotgbot.SendPhotoOpts{
-				Caption:         text,
-				MessageThreadId: chat.threadID,
+				Caption:             text,
+				MessageThreadId:     chat.threadID,
+				DisableNotification: chat.silent,
 				ReplyParameters: &gotgbot.ReplyParameters{
 					MessageId: replyToMessageID,
 				},
@@ -745,12 +890,14 @@ func (ms *MasterService) sendPhoto(chat *ChatInfo, replyToMessageID int64, photo
 }
 
 func (ms *MasterService) logMessage(chat *ChatInfo, event *common.OctopusEvent, resp *gotgbot.Message, err error) {
+	elog := common.EventLog(event)
 	if err != nil {
-		log.Warnf("Failed to send to Telegram (chat %d, %d): %v", chat.id, chat.threadID, err)
+		elog.Warnf("Failed to send to Telegram (chat %d, %d): %v", chat.id, chat.threadID, err)
+		chat.topicLost = chat.topic != nil && isTopicNotFound(err)
 	} else {
 		masterLimb := common.Limb{
 			Type:   "telegram",
-			UID:    common.Itoa(ms.config.Master.AdminID),
+			UID:    common.Itoa(ms.config().Master.AdminID),
 			ChatID: common.Itoa(resp.Chat.Id),
 		}.String()
 		slaveLimb := common.Limb{
@@ -768,10 +915,11 @@ func (ms *MasterService) logMessage(chat *ChatInfo, event *common.OctopusEvent,
 			Content:           event.Content,
 			Timestamp:         event.Timestamp,
 		}
+		msg.MediaType, msg.MediaFileID = mediaOf(resp)
 		if err := manager.AddMessage(msg); err != nil {
-			log.Warnf("Failed to add message %+v: %v", msg, err)
+			elog.Warnf("Failed to add message (%s, %s): %v", msg.MasterLimb, msg.MasterMsgID, err)
 		} else {
-			log.Debugf("Add message: %+v", msg)
+			elog.Debugf("Add message: %s, %s", msg.MasterLimb, msg.MasterMsgID)
 		}
 	}
 }
@@ -784,10 +932,26 @@ func (ms *MasterService) replayLinkIssue(msg *gotgbot.Message, text string) erro
 	return err
 }
 
+// chat info of Telegram chat, a topic of chat in forum supergroup
+func (ms *MasterService) linkedChatInfo(chatID int64, event *common.OctopusEvent) *ChatInfo {
+	chat, err := ms.bot.GetChat(chatID, nil)
+	if err != nil {
+		common.EventLog(event).Warnf("Failed to get chat(%d) info from Telegram: %v", chatID, err)
+		return nil
+	}
+	if chat.IsForum {
+		return ms.createForumChatInfo(chatID, event)
+	}
+	return &ChatInfo{
+		id:    chatID,
+		title: fmt.Sprintf("%s:", displayName(&event.From)),
+	}
+}
+
 func (ms *MasterService) createForumChatInfo(chatID int64, event *common.OctopusEvent) *ChatInfo {
 	masterLimb := common.Limb{
 		Type:   "telegram",
-		UID:    common.Itoa(ms.config.Master.AdminID),
+		UID:    common.Itoa(ms.config().Master.AdminID),
 		ChatID: common.Itoa(chatID),
 	}.String()
 	slaveLimb := common.Limb{
@@ -814,6 +978,7 @@ func (ms *MasterService) createForumChatInfo(chatID int64, event *common.Octopus
 			id:       chatID,
 			threadID: topicID,
 			title:    fmt.Sprintf("%s:", displayName(&event.From)),
+			topic:    topic,
 		}
 	}
 }
@@ -823,7 +988,7 @@ func (ms *MasterService) getOrCreateTopic(chatID int64, title, masterLimb, slave
 	if err != nil {
 		log.Warnf("Failed to get topic: %v", err)
 	} else if topic == nil {
-		resp, err := ms.bot.CreateForumTopic(chatID, title, &gotgbot.CreateForumTopicOpts{})
+		resp, err := ms.bot.CreateForumTopic(chatID, topicName(title), &gotgbot.CreateForumTopicOpts{})
 		if err != nil {
 			log.Warnf("Failed to create topic: %v", err)
 		} else {
@@ -846,7 +1011,7 @@ func (ms *MasterService) download(fileID string) (*common.BlobData, error) {
 	} else {
 		var data []byte
 
-		if ms.config.Master.LocalMode {
+		if ms.config().Master.LocalMode {
 			data, err = os.ReadFile(file.FilePath)
 			if err != nil {
 				return nil, err
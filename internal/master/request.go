@@ -0,0 +1,194 @@
+package master
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// forward friend/group request to admin with actionable buttons
+func (ms *MasterService) processRequest(event *common.OctopusEvent) {
+	request := event.Data.(*common.RequestData)
+
+	r := &manager.Request{
+		Vendor:      event.Vendor.String(),
+		RequestType: request.Type,
+		SubType:     request.SubType,
+		Flag:        request.Flag,
+		UserID:      request.UserID,
+		GroupID:     request.GroupID,
+		Comment:     request.Comment,
+		Status:      manager.RequestPending,
+	}
+	if err := manager.AddRequest(r); err != nil {
+		log.Warnf("Failed to add request %+v: %v", r, err)
+		return
+	}
+
+	var lines []string
+	if request.Type == "friend" {
+		lines = append(lines, "👤 Friend request")
+	} else if request.SubType == "invite" {
+		lines = append(lines, "👥 Group invitation")
+	} else {
+		lines = append(lines, "👥 Group join request")
+	}
+	lines = append(lines, fmt.Sprintf("From: %s (%s)", request.Nickname, request.UserID))
+
+	var profile []string
+	if request.Sex != "" && request.Sex != "unknown" {
+		profile = append(profile, request.Sex)
+	}
+	if request.Age > 0 {
+		profile = append(profile, fmt.Sprintf("%d years old", request.Age))
+	}
+	if len(profile) > 0 {
+		lines = append(lines, fmt.Sprintf("Profile: %s", strings.Join(profile, ", ")))
+	}
+	if request.Type == "group" {
+		lines = append(lines, fmt.Sprintf("Group: %s (%s)", request.GroupName, request.GroupID))
+	}
+	if request.Comment != "" {
+		lines = append(lines, fmt.Sprintf("Comment: %s", request.Comment))
+	}
+	lines = append(lines, fmt.Sprintf("Via: %s %s", event.Vendor.Type, event.Vendor.UID))
+
+	keyboard := []gotgbot.InlineKeyboardButton{}
+	for _, action := range []struct{ text, action string }{
+		{"✅ Approve", "approve"},
+		{"❌ Reject", "reject"},
+		{"🙈 Ignore", "ignore"},
+	} {
+		cb := Callback{
+			Category: "request",
+			Acction:  action.action,
+			Data:     common.Itoa(r.ID),
+		}
+		keyboard = append(keyboard, gotgbot.InlineKeyboardButton{Text: action.text, CallbackData: putCallback(cb)})
+	}
+
+	if _, err := ms.bot.SendMessage(
+		ms.config().Master.AdminID,
+		strings.Join(lines, "\n"),
+		&gotgbot.SendMessageOpts{
+			ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+				InlineKeyboard: [][]gotgbot.InlineKeyboardButton{keyboard},
+			},
+		},
+	); err != nil {
+		log.Warnf("Failed to send request to Telegram: %v", err)
+	}
+}
+
+// handle request decision from admin
+func (ms *MasterService) handleRequest(bot *gotgbot.Bot, ctx *ext.Context, cb Callback) error {
+	if ctx.Update.CallbackQuery.From.Id != ms.config().Master.AdminID {
+		return errors.New("request decision from stranger")
+	}
+
+	msg := ctx.EffectiveMessage
+
+	id, err := common.Atoi(cb.Data)
+	if err != nil {
+		return err
+	}
+	r, err := manager.GetRequest(id)
+	if err != nil {
+		log.Warnf("Get request failed: %v", err)
+		return err
+	}
+	if r == nil {
+		return ms.updateRequestPrompt(msg, "Request not found.")
+	}
+	if r.Status != manager.RequestPending {
+		return ms.updateRequestPrompt(msg, fmt.Sprintf("Already %s.", r.Status))
+	}
+
+	if cb.Acction == "ignore" {
+		if err := manager.UpdateRequestStatus(r.ID, manager.RequestIgnored, ""); err != nil {
+			log.Warnf("Update request status failed: %v", err)
+		}
+		return ms.updateRequestPrompt(msg, "Ignored.")
+	}
+
+	vendor, err := common.VendorFromString(r.Vendor)
+	if err != nil {
+		return err
+	}
+
+	chat := common.Chat{
+		Type: "private",
+		ID:   r.UserID,
+	}
+	if r.RequestType == "group" {
+		chat = common.Chat{
+			Type: "group",
+			ID:   r.GroupID,
+		}
+	}
+
+	// remove buttons to avoid duplicated decision
+	if err := ms.updateRequestPrompt(msg, "Processing..."); err != nil {
+		log.Warnf("Failed to update request prompt: %v", err)
+	}
+
+	decision := cb.Acction
+	ms.out <- &common.OctopusEvent{
+		Vendor:    *vendor,
+		ID:        common.Itoa(r.ID),
+		Timestamp: time.Now().Unix(),
+		Chat:      chat,
+		Type:      common.EventRequest,
+		Data: &common.RequestData{
+			Type:     r.RequestType,
+			SubType:  r.SubType,
+			Flag:     r.Flag,
+			UserID:   r.UserID,
+			GroupID:  r.GroupID,
+			Decision: decision,
+		},
+		Callback: func(event *common.OctopusEvent, err error) {
+			status := manager.RequestApproved
+			result := "Approved."
+			if decision == "reject" {
+				status = manager.RequestRejected
+				result = "Rejected."
+			}
+			if err != nil {
+				status = manager.RequestFailed
+				result = fmt.Sprintf("Failed: %v", err)
+			}
+
+			if err := manager.UpdateRequestStatus(r.ID, status, result); err != nil {
+				log.Warnf("Update request status failed: %v", err)
+			}
+			if err := ms.updateRequestPrompt(msg, result); err != nil {
+				log.Warnf("Failed to update request prompt: %v", err)
+			}
+		},
+	}
+
+	return nil
+}
+
+func (ms *MasterService) updateRequestPrompt(msg *gotgbot.Message, result string) error {
+	_, _, err := ms.bot.EditMessageText(
+		fmt.Sprintf("%s\n\n<i>%s</i>", html.EscapeString(msg.Text), html.EscapeString(result)),
+		&gotgbot.EditMessageTextOpts{
+			ChatId:    msg.Chat.Id,
+			MessageId: msg.MessageId,
+			ParseMode: "HTML",
+		},
+	)
+	return err
+}
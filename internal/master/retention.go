@@ -0,0 +1,159 @@
+package master
+
+import (
+	"fmt"
+	"html"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// pause between batches, let bridged messages get the database
+const purgeBatchPause = 100 * time.Millisecond
+
+// run fn periodically until done, disabled if interval is zero
+func (ms *MasterService) runPeriodically(interval time.Duration, fn func()) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ms.done:
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
+
+// purge messages older than retention, per chat policies override the global one
+func (ms *MasterService) purgeMessages() {
+	defer func() {
+		panicErr := recover()
+		if panicErr != nil {
+			log.Errorf("Panic in purge messages: %v\n%s", panicErr, debug.Stack())
+		}
+	}()
+
+	retention := ms.config().Database.Retention
+	anonymize := retention.Mode == common.RetentionAnonymize
+	now := time.Now()
+
+	exclude := make([]string, 0, len(retention.Chats))
+	for limb, maxAge := range retention.Chats {
+		exclude = append(exclude, limb)
+		if maxAge > 0 {
+			ms.purgeBatches(&manager.PurgeQuery{
+				Before:    now.Add(-maxAge),
+				SlaveLimb: limb,
+				Anonymize: anonymize,
+			})
+		}
+	}
+
+	if retention.MaxAge > 0 {
+		ms.purgeBatches(&manager.PurgeQuery{
+			Before:    now.Add(-retention.MaxAge),
+			Exclude:   exclude,
+			Anonymize: anonymize,
+		})
+	}
+}
+
+func (ms *MasterService) purgeBatches(q *manager.PurgeQuery) {
+	batchSize := ms.config().Database.Retention.BatchSize
+
+	var total int64
+	for {
+		select {
+		case <-ms.done:
+			return
+		default:
+		}
+
+		affected, err := manager.PurgeMessages(q, batchSize)
+		if err != nil {
+			log.Warnf("Failed to purge messages (%s): %v", purgeScope(q.SlaveLimb), err)
+			return
+		}
+		total += affected
+		if affected < int64(batchSize) {
+			break
+		}
+		time.Sleep(purgeBatchPause)
+	}
+
+	if total > 0 {
+		log.Infof("Purged %d messages (%s) created before %s, anonymize: %v",
+			total, purgeScope(q.SlaveLimb), q.Before.Format(time.DateTime), q.Anonymize)
+	}
+}
+
+func purgeScope(limb string) string {
+	if limb == "" {
+		return "all chats"
+	}
+	return limb
+}
+
+func (ms *MasterService) vacuum() {
+	start := time.Now()
+	if err := manager.Vacuum(); err != nil {
+		log.Warnf("Failed to vacuum database: %v", err)
+		return
+	}
+	log.Infof("Database vacuumed in %v", time.Since(start))
+}
+
+// show database size and row counts
+func (ms *MasterService) onStats(bot *gotgbot.Bot, ctx *ext.Context) error {
+	stats, err := manager.GetStats()
+	if err != nil {
+		log.Warnf("Get database stats failed: %v", err)
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("<b>Database (%s): %s</b>\n",
+		html.EscapeString(stats.Driver), formatSize(int(stats.Size))))
+	for _, t := range stats.Tables {
+		sb.WriteString(fmt.Sprintf("\n%s: %d rows, %s", html.EscapeString(t.Name), t.Rows, formatSize(int(t.Size))))
+	}
+
+	retention := ms.config().Database.Retention
+	if retention.MaxAge > 0 || len(retention.Chats) > 0 {
+		sb.WriteString(fmt.Sprintf("\n\n<b>Retention (%s)</b>\n", html.EscapeString(retention.Mode)))
+		if retention.MaxAge > 0 {
+			sb.WriteString(fmt.Sprintf("default: %v\n", retention.MaxAge))
+		}
+		for limb, maxAge := range retention.Chats {
+			keep := "forever"
+			if maxAge > 0 {
+				keep = maxAge.String()
+			}
+			sb.WriteString(fmt.Sprintf("%s: %s\n", html.EscapeString(limb), keep))
+		}
+	}
+
+	_, err = bot.SendMessage(
+		ctx.EffectiveChat.Id,
+		sb.String(),
+		&gotgbot.SendMessageOpts{
+			ParseMode:       "HTML",
+			MessageThreadId: ctx.EffectiveMessage.MessageThreadId,
+		},
+	)
+	return err
+}
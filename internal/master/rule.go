@@ -0,0 +1,357 @@
+package master
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+	"github.com/duo/octopus/internal/metrics"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const ruleUsage = "Usage: /rules add <drop|mute|tag|route> [target=hashtag|chatid] [vendor=type[;uid]] [chat=id|limb] [sender=id] [type=text|photo|...] [priority=n] [pattern=regexp]\n\n" +
+	"pattern must be the last, it takes the rest of line."
+
+type ruleMatcher struct {
+	*manager.Rule
+	pattern *regexp.Regexp
+}
+
+func (m *ruleMatcher) match(event *common.OctopusEvent, slaveLimb string) bool {
+	if m.Vendor != "" && m.Vendor != event.Vendor.Type && m.Vendor != event.Vendor.String() {
+		return false
+	}
+	if m.Chat != "" && m.Chat != event.Chat.ID && m.Chat != slaveLimb {
+		return false
+	}
+	if m.Sender != "" && m.Sender != event.From.ID {
+		return false
+	}
+	if m.EventType != "" && m.EventType != event.Type.String() {
+		return false
+	}
+	if m.pattern != nil && !m.pattern.MatchString(event.Content) {
+		return false
+	}
+	return true
+}
+
+// first enabled rule matched by event in order of priority, nil if none
+func (ms *MasterService) matchRule(event *common.OctopusEvent, slaveLimb string) *manager.Rule {
+	for _, m := range ms.loadRules() {
+		if m.match(event, slaveLimb) {
+			metrics.RuleMatches.WithLabelValues(m.Action).Inc()
+			return m.Rule
+		}
+	}
+	return nil
+}
+
+// compile enabled rules once, until changed by command
+func (ms *MasterService) loadRules() []*ruleMatcher {
+	if rules := ms.rules.Load(); rules != nil {
+		return *rules
+	}
+
+	list, err := manager.GetRuleList()
+	if err != nil {
+		log.Warnf("Get rule list failed: %v", err)
+		return nil
+	}
+
+	rules := []*ruleMatcher{}
+	for _, rule := range list {
+		if !rule.Enabled {
+			continue
+		}
+		m := &ruleMatcher{Rule: rule}
+		if rule.Pattern != "" {
+			if m.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+				log.Warnf("Skip rule #%d of invalid pattern: %v", rule.ID, err)
+				continue
+			}
+		}
+		rules = append(rules, m)
+	}
+	ms.rules.Store(&rules)
+
+	return rules
+}
+
+// hashtag of tag rule prefixed to title
+func ruleTag(rule *manager.Rule) string {
+	return "#" + strings.TrimPrefix(rule.Target, "#")
+}
+
+// list rules, or add one by arguments
+func (ms *MasterService) onRules(bot *gotgbot.Bot, ctx *ext.Context, args string) error {
+	if args == "" {
+		return ms.showRules(bot, ctx)
+	}
+
+	action, args, _ := strings.Cut(args, " ")
+	if action != "add" {
+		return ms.replyRuleIssue(bot, ctx, ruleUsage)
+	}
+
+	rule, err := parseRule(args)
+	if err != nil {
+		return ms.replyRuleIssue(bot, ctx, fmt.Sprintf("Invalid rule: %v\n\n%s", err, ruleUsage))
+	}
+	if err := manager.AddRule(rule); err != nil {
+		log.Warnf("Failed to add rule: %v", err)
+		return err
+	}
+	ms.rules.Store(nil)
+
+	return ms.showRules(bot, ctx)
+}
+
+// parse action and key=value conditions, pattern is the rest of line
+func parseRule(args string) (*manager.Rule, error) {
+	args, pattern, hasPattern := cutPattern(args)
+	if hasPattern {
+		if pattern == "" {
+			return nil, errors.New("empty pattern")
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return nil, errors.New("missing action")
+	}
+
+	rule := &manager.Rule{
+		Action:  fields[0],
+		Pattern: pattern,
+	}
+	if !slices.Contains(manager.RuleActions, rule.Action) {
+		return nil, fmt.Errorf("unknown action %s", rule.Action)
+	}
+
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid condition %s", field)
+		}
+		switch key {
+		case "target":
+			rule.Target = value
+		case "vendor":
+			rule.Vendor = value
+		case "chat":
+			rule.Chat = value
+		case "sender":
+			rule.Sender = value
+		case "type":
+			if !isEventTypeName(value) {
+				return nil, fmt.Errorf("unknown event type %s", value)
+			}
+			rule.EventType = value
+		case "priority":
+			priority, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid priority %s", value)
+			}
+			rule.Priority = priority
+		default:
+			return nil, fmt.Errorf("unknown key %s", key)
+		}
+	}
+
+	switch rule.Action {
+	case manager.RuleTag:
+		if strings.TrimPrefix(rule.Target, "#") == "" {
+			return nil, errors.New("tag needs target hashtag")
+		}
+	case manager.RuleRoute:
+		if _, err := common.Atoi(rule.Target); err != nil {
+			return nil, errors.New("route needs target chat id")
+		}
+	}
+
+	// a rule without condition would catch all events
+	if rule.Vendor == "" && rule.Chat == "" && rule.Sender == "" && rule.EventType == "" && rule.Pattern == "" {
+		return nil, errors.New("missing condition")
+	}
+
+	return rule, nil
+}
+
+// split at pattern key starting a field, not inside value of another key
+func cutPattern(args string) (before, pattern string, found bool) {
+	const key = "pattern="
+	for i := 0; i+len(key) <= len(args); i++ {
+		if strings.HasPrefix(args[i:], key) && (i == 0 || args[i-1] == ' ' || args[i-1] == '\t') {
+			return args[:i], args[i+len(key):], true
+		}
+	}
+	return args, "", false
+}
+
+func isEventTypeName(name string) bool {
+	for t := common.EventText; t <= common.EventForward; t++ {
+		if t.String() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (ms *MasterService) handleRule(bot *gotgbot.Bot, ctx *ext.Context, cb Callback) error {
+	if ctx.Update.CallbackQuery.From.Id != ms.config().Master.AdminID {
+		return errors.New("rule from stranger")
+	}
+
+	switch cb.Acction {
+	case "close":
+		_, _, err := ctx.EffectiveMessage.EditText(
+			bot,
+			"_Done._",
+			&gotgbot.EditMessageTextOpts{ParseMode: "Markdown"},
+		)
+		return err
+	case "enable", "disable":
+		id, err := common.Atoi(cb.Data)
+		if err != nil {
+			return err
+		}
+		if err := manager.SetRuleEnabled(id, cb.Acction == "enable"); err != nil {
+			log.Warnf("Failed to %s rule #%d: %v", cb.Acction, id, err)
+			return err
+		}
+	case "del":
+		id, err := common.Atoi(cb.Data)
+		if err != nil {
+			return err
+		}
+		if err := manager.DelRuleById(id); err != nil {
+			log.Warnf("Failed to delete rule #%d: %v", id, err)
+			return err
+		}
+	}
+	ms.rules.Store(nil)
+
+	return ms.showRules(bot, ctx)
+}
+
+func (ms *MasterService) showRules(bot *gotgbot.Bot, ctx *ext.Context) error {
+	rules, err := manager.GetRuleList()
+	if err != nil {
+		log.Warnf("Get rule list failed: %v", err)
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<b>Rules</b>")
+	if len(rules) == 0 {
+		sb.WriteString("\n\nNo rule, add one by /rules add.")
+	}
+	for _, rule := range rules {
+		sb.WriteString("\n")
+		sb.WriteString(html.EscapeString(describeRule(rule)))
+	}
+
+	keyboard := [][]gotgbot.InlineKeyboardButton{}
+	for _, rule := range rules {
+		toggle := Callback{
+			Category: "rule",
+			Acction:  "disable",
+			Data:     common.Itoa(rule.ID),
+		}
+		toggleText := fmt.Sprintf("Disable #%d", rule.ID)
+		if !rule.Enabled {
+			toggle.Acction = "enable"
+			toggleText = fmt.Sprintf("Enable #%d", rule.ID)
+		}
+		del := Callback{
+			Category: "rule",
+			Acction:  "del",
+			Data:     common.Itoa(rule.ID),
+		}
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{
+			{Text: toggleText, CallbackData: putCallback(toggle)},
+			{Text: fmt.Sprintf("Delete #%d", rule.ID), CallbackData: putCallback(del)},
+		})
+	}
+	closeCb := Callback{
+		Category: "rule",
+		Acction:  "close",
+	}
+	keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{{Text: "Close", CallbackData: putCallback(closeCb)}})
+
+	if ctx.EffectiveMessage.From.Id == bot.User.Id {
+		_, _, err := ctx.EffectiveMessage.EditText(
+			bot,
+			sb.String(),
+			&gotgbot.EditMessageTextOpts{
+				ParseMode: "HTML",
+				ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+					InlineKeyboard: keyboard,
+				},
+			},
+		)
+		return err
+	} else {
+		_, err := bot.SendMessage(
+			ctx.EffectiveChat.Id,
+			sb.String(),
+			&gotgbot.SendMessageOpts{
+				ParseMode:       "HTML",
+				MessageThreadId: ctx.EffectiveMessage.MessageThreadId,
+				ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+					InlineKeyboard: keyboard,
+				},
+			},
+		)
+		return err
+	}
+}
+
+func (ms *MasterService) replyRuleIssue(bot *gotgbot.Bot, ctx *ext.Context, text string) error {
+	_, err := ctx.EffectiveMessage.Reply(bot, text, &gotgbot.SendMessageOpts{
+		MessageThreadId: ctx.EffectiveMessage.MessageThreadId,
+	})
+	return err
+}
+
+// one line summary of rule, in the syntax of /rules add
+func describeRule(rule *manager.Rule) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("#%d ", rule.ID))
+	if !rule.Enabled {
+		sb.WriteString("[off] ")
+	}
+	sb.WriteString(rule.Action)
+	for _, kv := range [][2]string{
+		{"target", rule.Target},
+		{"vendor", rule.Vendor},
+		{"chat", rule.Chat},
+		{"sender", rule.Sender},
+		{"type", rule.EventType},
+	} {
+		if kv[1] != "" {
+			sb.WriteString(fmt.Sprintf(" %s=%s", kv[0], kv[1]))
+		}
+	}
+	if rule.Priority != 0 {
+		sb.WriteString(fmt.Sprintf(" priority=%d", rule.Priority))
+	}
+	if rule.Pattern != "" {
+		sb.WriteString(" pattern=" + rule.Pattern)
+	}
+	return sb.String()
+}
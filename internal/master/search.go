@@ -0,0 +1,266 @@
+package master
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const maxSearchSnippet = 80
+
+// search bridged messages, scoped to current topic or linked chat
+func (ms *MasterService) onSearch(bot *gotgbot.Bot, ctx *ext.Context, terms string) error {
+	if terms == "" {
+		_, err := ctx.EffectiveMessage.Reply(bot, "Usage: /search <terms>", &gotgbot.SendMessageOpts{
+			MessageThreadId: ctx.EffectiveMessage.MessageThreadId,
+		})
+		return err
+	}
+
+	masterLimb := common.Limb{
+		Type:   "telegram",
+		UID:    common.Itoa(ms.config().Master.AdminID),
+		ChatID: common.Itoa(ctx.EffectiveChat.Id),
+	}.String()
+
+	// scope is kept as "masterLimb|slaveLimb"
+	var scope string
+	if ctx.EffectiveChat.IsForum && ctx.EffectiveMessage.MessageThreadId != 0 {
+		topic, err := manager.GetTopicByMaster(masterLimb, ctx.EffectiveMessage.MessageThreadId)
+		if err != nil {
+			log.Warnf("Get topic by master failed: %v", err)
+			return err
+		}
+		if topic != nil {
+			scope = masterLimb + "|" + topic.SlaveLimb
+		}
+	} else if ctx.EffectiveChat.Type != "private" {
+		scope = masterLimb + "|"
+	}
+
+	return ms.showSearch(bot, ctx, Callback{
+		Category: "search",
+		Acction:  "list",
+		Query:    terms,
+		Data:     scope,
+	})
+}
+
+func (ms *MasterService) handleSearch(bot *gotgbot.Bot, ctx *ext.Context, cb Callback) error {
+	if ctx.Update.CallbackQuery.From.Id != ms.config().Master.AdminID {
+		return errors.New("search from stranger")
+	}
+
+	switch cb.Acction {
+	case "close":
+		_, _, err := ctx.EffectiveMessage.EditText(
+			bot,
+			"_Canceled by user._",
+			&gotgbot.EditMessageTextOpts{ParseMode: "Markdown"},
+		)
+		return err
+	case "jump":
+		return ms.jumpToMessage(bot, cb.Data)
+	}
+
+	return ms.showSearch(bot, ctx, cb)
+}
+
+func (ms *MasterService) showSearch(bot *gotgbot.Bot, ctx *ext.Context, cb Callback) error {
+	q := &manager.SearchQuery{Terms: strings.Fields(cb.Query)}
+	if cb.Data != "" {
+		parts := strings.SplitN(cb.Data, "|", 2)
+		q.MasterLimb = parts[0]
+		if len(parts) == 2 {
+			q.SlaveLimb = parts[1]
+		}
+	}
+
+	pageSize := ms.config().Master.PageSize
+
+	count, err := manager.GetSearchCount(q)
+	if err != nil {
+		log.Warnf("Get search count failed: %v", err)
+		return err
+	}
+
+	if count == 0 {
+		_, err := bot.SendMessage(
+			ctx.EffectiveChat.Id,
+			"No message found.",
+			&gotgbot.SendMessageOpts{
+				MessageThreadId: ctx.EffectiveMessage.MessageThreadId,
+			},
+		)
+		return err
+	}
+
+	pager := manager.CalcPager(cb.Page, pageSize, count)
+
+	messages, err := manager.SearchMessages(q, pager.CurrentPage, pageSize)
+	if err != nil {
+		log.Warnf("Search messages failed: %v", err)
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🔍 <b>%s</b>", html.EscapeString(cb.Query)))
+
+	jumps := []gotgbot.InlineKeyboardButton{}
+	for idx, m := range messages {
+		num := pageSize*(pager.CurrentPage-1) + idx + 1
+
+		sender := m.SlaveSender
+		chat := m.ChatTitle
+		if limb, err := common.LimbFromString(m.SlaveLimb); err == nil {
+			if sender == limb.UID {
+				sender = "Me"
+			}
+			chat = cmp.Or(chat, limb.ChatID)
+		}
+
+		sb.WriteString(fmt.Sprintf(
+			"\n\n<b>%d.</b> %s | %s | %s\n%s",
+			num,
+			html.EscapeString(formatTimestamp(m.Timestamp)),
+			html.EscapeString(chat),
+			html.EscapeString(sender),
+			html.EscapeString(snippet(m.Content)),
+		))
+
+		// logged while muted, nothing to jump to
+		if m.MasterLimb == "" {
+			continue
+		}
+		jump := Callback{
+			Category: "search",
+			Acction:  "jump",
+			Data:     strings.Join([]string{m.MasterLimb, m.MasterMsgID, m.MasterMsgThreadID}, "|"),
+		}
+		jumps = append(jumps, gotgbot.InlineKeyboardButton{Text: fmt.Sprint(num), CallbackData: putCallback(jump)})
+	}
+
+	keyboard := [][]gotgbot.InlineKeyboardButton{}
+	for len(jumps) > 0 {
+		n := min(len(jumps), 5)
+		keyboard = append(keyboard, jumps[:n])
+		jumps = jumps[n:]
+	}
+
+	var bottom = []gotgbot.InlineKeyboardButton{}
+	if pager.HasPrev {
+		prev := cb
+		prev.Acction = "list"
+		prev.Page = pager.PrevPage
+		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: "< Prev", CallbackData: putCallback(prev)})
+	} else {
+		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: " ", CallbackData: "0"})
+	}
+	{
+		info := fmt.Sprintf("%d / %d (%d) | Cancel",
+			pager.CurrentPage, pager.NumPages, pager.NumItems)
+		cb := Callback{
+			Category: "search",
+			Acction:  "close",
+		}
+		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: info, CallbackData: putCallback(cb)})
+	}
+	if pager.HasNext {
+		next := cb
+		next.Acction = "list"
+		next.Page = pager.NextPage
+		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: "Next >", CallbackData: putCallback(next)})
+	} else {
+		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: " ", CallbackData: "0"})
+	}
+	keyboard = append(keyboard, bottom)
+
+	if ctx.EffectiveMessage.From.Id == bot.User.Id {
+		_, _, err := ctx.EffectiveMessage.EditText(
+			bot,
+			sb.String(),
+			&gotgbot.EditMessageTextOpts{
+				ParseMode: "HTML",
+				ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+					InlineKeyboard: keyboard,
+				},
+			},
+		)
+		return err
+	} else {
+		_, err := bot.SendMessage(
+			ctx.EffectiveChat.Id,
+			sb.String(),
+			&gotgbot.SendMessageOpts{
+				ParseMode:       "HTML",
+				MessageThreadId: ctx.EffectiveMessage.MessageThreadId,
+				ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+					InlineKeyboard: keyboard,
+				},
+			},
+		)
+		return err
+	}
+}
+
+// reply to the stored master message so Telegram can jump to it
+func (ms *MasterService) jumpToMessage(bot *gotgbot.Bot, data string) error {
+	parts := strings.Split(data, "|")
+	if len(parts) != 3 {
+		return errors.New("invalid jump data")
+	}
+
+	limb, err := common.LimbFromString(parts[0])
+	if err != nil {
+		return err
+	}
+	chatID, err := common.Atoi(limb.ChatID)
+	if err != nil {
+		return err
+	}
+	msgID, err := common.Atoi(parts[1])
+	if err != nil {
+		return err
+	}
+	threadID, _ := common.Atoi(parts[2])
+
+	_, err = bot.SendMessage(
+		chatID,
+		"🔍 Search result",
+		&gotgbot.SendMessageOpts{
+			MessageThreadId: threadID,
+			ReplyParameters: &gotgbot.ReplyParameters{
+				MessageId: msgID,
+			},
+		},
+	)
+	return err
+}
+
+func snippet(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	runes := []rune(content)
+	if len(runes) > maxSearchSnippet {
+		return string(runes[:maxSearchSnippet]) + "…"
+	}
+	return content
+}
+
+// timestamps of limbs are in seconds or milliseconds
+func formatTimestamp(ts int64) string {
+	if ts > 1e12 {
+		return time.UnixMilli(ts).Format("2006-01-02 15:04")
+	}
+	return time.Unix(ts, 0).Format("2006-01-02 15:04")
+}
@@ -0,0 +1,226 @@
+package master
+
+import (
+	"fmt"
+	"html"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const maxShowSyncChanges = 20
+
+type chatDelta struct {
+	added   []string
+	renamed []string
+	removed []string
+}
+
+func (d *chatDelta) isEmpty() bool {
+	return len(d.added) == 0 && len(d.renamed) == 0 && len(d.removed) == 0
+}
+
+// update chats of vendor, mark missing chats as inactive
+func (ms *MasterService) updateChats(event *common.OctopusEvent) {
+	defer func() {
+		panicErr := recover()
+		if panicErr != nil {
+			log.Errorf("Panic in update chats event: %+v %v\n%s", event, panicErr, debug.Stack())
+		}
+	}()
+
+	vendor := event.Vendor.String()
+	chats := event.Data.([]*common.Chat)
+	log.Infof("Update chats for %s, count: %d", event.Vendor, len(chats))
+
+	existing, err := manager.GetChatsByVendor(vendor)
+	if err != nil {
+		log.Warnf("Failed to get chats of %s: %v", vendor, err)
+		return
+	}
+	known := map[string]*manager.Chat{}
+	for _, c := range existing {
+		known[c.Limb] = c
+	}
+
+	delta := &chatDelta{}
+	renamed := map[string]string{}
+	seen := map[string]bool{}
+	upserts := make([]*manager.Chat, 0, len(chats))
+	for _, c := range chats {
+		limb := common.Limb{
+			Type:   event.Vendor.Type,
+			UID:    event.Vendor.UID,
+			ChatID: c.ID,
+		}.String()
+		if seen[limb] {
+			continue
+		}
+		seen[limb] = true
+
+		if old, ok := known[limb]; !ok || !old.Active {
+			delta.added = append(delta.added, c.Title)
+		} else if old.Title != c.Title {
+			delta.renamed = append(delta.renamed, fmt.Sprintf("%s → %s", old.Title, c.Title))
+			renamed[limb] = c.Title
+		}
+
+		upserts = append(upserts, &manager.Chat{
+			Limb:     limb,
+			ChatType: c.Type,
+			Title:    c.Title,
+		})
+	}
+
+	result, err := manager.UpsertChats(upserts)
+	if err != nil {
+		log.Warnf("Failed to upsert chats of %s: %v", vendor, err)
+		return
+	}
+
+	for limb, title := range renamed {
+		ms.renameTopics(limb, title)
+	}
+
+	// an empty list is more likely a broken limb client than removing everything
+	if len(chats) > 0 {
+		removed := []string{}
+		for limb, old := range known {
+			if !old.Active || seen[limb] {
+				continue
+			}
+			removed = append(removed, limb)
+			delta.removed = append(delta.removed, old.Title)
+		}
+		if err := manager.DeactivateChats(removed); err != nil {
+			log.Warnf("Failed to deactivate chats of %s: %v", vendor, err)
+			delta.removed = nil
+		}
+	}
+
+	log.Infof("Chats of %s synced, inserted: %d, updated: %d, unchanged: %d, removed: %d",
+		vendor, result.Inserted, result.Updated, result.Unchanged, len(delta.removed))
+
+	// report first sync of vendor only if requested
+	ms.syncRequestsLock.Lock()
+	_, requested := ms.syncRequests[vendor]
+	delete(ms.syncRequests, vendor)
+	ms.syncRequestsLock.Unlock()
+
+	if requested || (len(existing) > 0 && !delta.isEmpty()) {
+		ms.reportSync(event.Vendor, delta)
+	}
+}
+
+// request limb clients to sync chats
+func (ms *MasterService) handleSync(ctx *ext.Context, query string) error {
+	var vendors []string
+	if query != "" {
+		if _, err := common.VendorFromString(query); err != nil {
+			_, err := ctx.EffectiveMessage.Reply(ms.bot, "Usage: /sync [vendor;uid]", nil)
+			return err
+		}
+		vendors = []string{query}
+	} else {
+		var err error
+		if vendors, err = manager.GetChatVendors(); err != nil {
+			log.Warnf("Get chat vendors failed: %v", err)
+			return err
+		}
+	}
+
+	if len(vendors) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(ms.bot, "No vendor currently avaiable.", nil)
+		return err
+	}
+
+	for _, v := range vendors {
+		vendor, err := common.VendorFromString(v)
+		if err != nil {
+			continue
+		}
+
+		ms.syncRequestsLock.Lock()
+		ms.syncRequests[v] = struct{}{}
+		ms.syncRequestsLock.Unlock()
+
+		ms.out <- &common.OctopusEvent{
+			Vendor:    *vendor,
+			ID:        "sync",
+			Timestamp: time.Now().Unix(),
+			Type:      common.EventSync,
+			Callback: func(event *common.OctopusEvent, err error) {
+				if err == nil {
+					return
+				}
+
+				ms.syncRequestsLock.Lock()
+				delete(ms.syncRequests, v)
+				ms.syncRequestsLock.Unlock()
+
+				ms.bot.SendMessage(
+					ms.config().Master.AdminID,
+					fmt.Sprintf("*[FAIL]: %s*", common.EscapeText("Markdown", err.Error())),
+					&gotgbot.SendMessageOpts{ParseMode: "Markdown"},
+				)
+			},
+		}
+	}
+
+	_, err := ctx.EffectiveMessage.Reply(
+		ms.bot,
+		fmt.Sprintf("Sync requested for %s.", strings.Join(vendors, ", ")),
+		nil,
+	)
+	return err
+}
+
+// send chat delta to admin
+func (ms *MasterService) reportSync(vendor common.Vendor, delta *chatDelta) {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("<b>Chats synced for %s</b>", html.EscapeString(vendor.String())))
+	if delta.isEmpty() {
+		sb.WriteString("\n\n<i>No changes.</i>")
+	}
+
+	for _, section := range []struct {
+		title string
+		items []string
+	}{
+		{"➕ Added", delta.added},
+		{"✏️ Renamed", delta.renamed},
+		{"➖ Removed", delta.removed},
+	} {
+		if len(section.items) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n\n<b>%s (%d)</b>", section.title, len(section.items)))
+		for i, item := range section.items {
+			if i == maxShowSyncChanges {
+				sb.WriteString(fmt.Sprintf("\n<i>... and %d more</i>", len(section.items)-i))
+				break
+			}
+			sb.WriteString("\n")
+			sb.WriteString(html.EscapeString(item))
+		}
+	}
+
+	if _, err := ms.bot.SendMessage(
+		ms.config().Master.AdminID,
+		sb.String(),
+		&gotgbot.SendMessageOpts{
+			ParseMode:           "HTML",
+			DisableNotification: true,
+		},
+	); err != nil {
+		log.Warnf("Failed to send sync result: %v", err)
+	}
+}
@@ -75,7 +75,7 @@ type Page struct {
 }
 
 func (ms *MasterService) postApp(app *common.AppData) (*Page, error) {
-	client = getClient(ms.config.Master.Telegraph.Proxy)
+	client = getClient(ms.config().Master.Telegraph.Proxy)
 
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(app.Content))
 	if err != nil {
@@ -84,7 +84,7 @@ func (ms *MasterService) postApp(app *common.AppData) (*Page, error) {
 
 	return createPage(
 		doc.Contents(),
-		ms.config.Master.Telegraph.Tokens[0],
+		ms.config().Master.Telegraph.Tokens[0],
 		app.Title,
 		app.Blobs,
 	)
@@ -0,0 +1,290 @@
+package master
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const maxTopicNameLength = 128
+
+// topic name limited by Telegram
+func topicName(title string) string {
+	if title == "" {
+		return "Untitled"
+	}
+	if utf8.RuneCountInString(title) <= maxTopicNameLength {
+		return title
+	}
+	return string([]rune(title)[:maxTopicNameLength])
+}
+
+// topic deleted in Telegram, its row is stale
+func isTopicNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "message thread not found") || strings.Contains(msg, "TOPIC_DELETED")
+}
+
+// drop stale topic of chat and create a new one, return false if failed
+func (ms *MasterService) recreateTopic(chat *ChatInfo, event *common.OctopusEvent) bool {
+	elog := common.EventLog(event)
+	stale := chat.topic
+	chat.topicLost = false
+
+	if err := manager.DelTopicById(stale.ID); err != nil {
+		elog.Warnf("Failed to delete stale topic %s: %v", stale.TopicID, err)
+		return false
+	}
+	topic := ms.getOrCreateTopic(chat.id, event.Chat.Title, stale.MasterLimb, stale.SlaveLimb)
+	if topic == nil {
+		return false
+	}
+	topicID, err := common.Atoi(topic.TopicID)
+	if err != nil {
+		return false
+	}
+
+	elog.Infof("Topic %s of %s not found, recreated as %s", stale.TopicID, stale.SlaveLimb, topic.TopicID)
+	chat.topic = topic
+	chat.threadID = topicID
+	return true
+}
+
+// rename topics of slave chat to new title, drop topics deleted in Telegram
+func (ms *MasterService) renameTopics(slaveLimb, title string) {
+	topics, err := manager.GetTopicsBySlave(slaveLimb)
+	if err != nil {
+		log.Warnf("Failed to get topics of %s: %v", slaveLimb, err)
+		return
+	}
+
+	for _, topic := range topics {
+		chatID, topicID, err := parseTopic(topic)
+		if err != nil {
+			log.Warnf("Parse topic(%v) failed: %v", topic.MasterLimb, err)
+			continue
+		}
+		_, err = ms.bot.EditForumTopic(chatID, topicID, &gotgbot.EditForumTopicOpts{Name: topicName(title)})
+		if isTopicNotFound(err) {
+			if err := manager.DelTopicById(topic.ID); err != nil {
+				log.Warnf("Failed to delete stale topic %s: %v", topic.TopicID, err)
+			}
+		} else if err != nil && !strings.Contains(err.Error(), "TOPIC_NOT_MODIFIED") {
+			log.Warnf("Failed to rename topic %s of %s: %v", topic.TopicID, slaveLimb, err)
+		}
+	}
+}
+
+func parseTopic(topic *manager.Topic) (int64, int64, error) {
+	limb, err := common.LimbFromString(topic.MasterLimb)
+	if err != nil {
+		return 0, 0, err
+	}
+	chatID, err := common.Atoi(limb.ChatID)
+	if err != nil {
+		return 0, 0, err
+	}
+	topicID, err := common.Atoi(topic.TopicID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return chatID, topicID, nil
+}
+
+// manage current topic, e.g. /topic [bind vendor;uid;chatid]
+func (ms *MasterService) onTopic(bot *gotgbot.Bot, ctx *ext.Context, args []string) error {
+	msg := ctx.EffectiveMessage
+	if !ctx.EffectiveChat.IsForum || msg.MessageThreadId == 0 {
+		return ms.replayLinkIssue(msg, "*Run in a topic of forum supergroup.*")
+	}
+
+	if len(args) == 0 {
+		return ms.showTopic(bot, ctx)
+	}
+	if len(args) != 2 || args[0] != "bind" {
+		_, err := msg.Reply(bot, "Usage: /topic [bind vendor;uid;chatid]", &gotgbot.SendMessageOpts{
+			MessageThreadId: msg.MessageThreadId,
+		})
+		return err
+	}
+
+	limb, err := common.LimbFromString(args[1])
+	if err != nil {
+		return ms.replayLinkIssue(msg, "*Invalid remote chat.*")
+	}
+	slaveLimb := limb.String()
+	masterLimb := ms.topicMasterLimb(ctx)
+
+	// a topic shows one chat, and a chat has one topic per supergroup
+	if old, err := manager.GetTopicByMaster(masterLimb, msg.MessageThreadId); err != nil {
+		log.Warnf("Get topic by master failed: %v", err)
+		return err
+	} else if old != nil {
+		if err := manager.DelTopicById(old.ID); err != nil {
+			log.Warnf("Failed to unbind topic: %v", err)
+			return err
+		}
+	}
+	if err := manager.DelTopic(masterLimb, slaveLimb); err != nil {
+		log.Warnf("Failed to unbind topic of %s: %v", slaveLimb, err)
+		return err
+	}
+	if err := manager.AddTopic(&manager.Topic{
+		MasterLimb: masterLimb,
+		SlaveLimb:  slaveLimb,
+		TopicID:    common.Itoa(msg.MessageThreadId),
+	}); err != nil {
+		log.Warnf("Failed to bind topic: %v", err)
+		return err
+	}
+
+	return ms.showTopic(bot, ctx)
+}
+
+func (ms *MasterService) handleTopic(bot *gotgbot.Bot, ctx *ext.Context, cb Callback) error {
+	if ctx.Update.CallbackQuery.From.Id != ms.config().Master.AdminID {
+		return errors.New("topic from stranger")
+	}
+
+	chatID := ctx.EffectiveChat.Id
+	topicID := ctx.EffectiveMessage.MessageThreadId
+	masterLimb := ms.topicMasterLimb(ctx)
+
+	var err error
+	switch cb.Acction {
+	case "close":
+		_, _, err := ctx.EffectiveMessage.EditText(
+			bot,
+			"_Canceled by user._",
+			&gotgbot.EditMessageTextOpts{ParseMode: "Markdown"},
+		)
+		return err
+	case "unbind":
+		var topic *manager.Topic
+		if topic, err = manager.GetTopicByMaster(masterLimb, topicID); err == nil && topic != nil {
+			err = manager.DelTopicById(topic.ID)
+		}
+	case "lock":
+		_, err = bot.CloseForumTopic(chatID, topicID, nil)
+	case "unlock":
+		_, err = bot.ReopenForumTopic(chatID, topicID, nil)
+	case "rename":
+		var topic *manager.Topic
+		var chat *manager.Chat
+		if topic, err = manager.GetTopicByMaster(masterLimb, topicID); err == nil && topic != nil {
+			if chat, err = manager.GetChat(topic.SlaveLimb); err == nil && chat != nil {
+				_, err = bot.EditForumTopic(chatID, topicID, &gotgbot.EditForumTopicOpts{Name: topicName(chat.Title)})
+			}
+		}
+	}
+	if err != nil && !strings.Contains(err.Error(), "TOPIC_NOT_MODIFIED") {
+		log.Warnf("Failed to %s topic %d: %v", cb.Acction, topicID, err)
+		_, _ = bot.SendMessage(chatID, fmt.Sprintf("*[FAIL]: %s*", common.EscapeText("Markdown", err.Error())), &gotgbot.SendMessageOpts{
+			ParseMode:       "Markdown",
+			MessageThreadId: topicID,
+		})
+	}
+
+	return ms.showTopic(bot, ctx)
+}
+
+// linked chat of current topic with actions
+func (ms *MasterService) showTopic(bot *gotgbot.Bot, ctx *ext.Context) error {
+	topicID := ctx.EffectiveMessage.MessageThreadId
+
+	topic, err := manager.GetTopicByMaster(ms.topicMasterLimb(ctx), topicID)
+	if err != nil {
+		log.Warnf("Get topic by master failed: %v", err)
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<b>Topic</b>")
+	var keyboard [][]gotgbot.InlineKeyboardButton
+	if topic == nil {
+		sb.WriteString("\n\nNo linked chat.\n<i>Bind with /topic bind vendor;uid;chatid</i>")
+	} else {
+		sb.WriteString(fmt.Sprintf("\n\n<code>%s</code>", html.EscapeString(topic.SlaveLimb)))
+		chat, err := manager.GetChat(topic.SlaveLimb)
+		if err != nil {
+			log.Warnf("Get chat failed: %v", err)
+		} else if chat != nil {
+			sb.WriteString(fmt.Sprintf("\n%s (%s)", html.EscapeString(chat.Title), html.EscapeString(chat.ChatType)))
+			if !chat.Active {
+				sb.WriteString(" <i>inactive</i>")
+			}
+		}
+		sb.WriteString("\n\n<i>Rebind with /topic bind vendor;uid;chatid</i>")
+
+		keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{
+			topicButton("Rename from source", "rename"),
+			topicButton("Unbind", "unbind"),
+		}, []gotgbot.InlineKeyboardButton{
+			notifyButton(topic.SlaveLimb),
+		})
+	}
+	keyboard = append(keyboard, []gotgbot.InlineKeyboardButton{
+		topicButton("Close topic", "lock"),
+		topicButton("Reopen topic", "unlock"),
+		topicButton("Cancel", "close"),
+	})
+
+	if ctx.EffectiveMessage.From.Id == bot.User.Id {
+		_, _, err := ctx.EffectiveMessage.EditText(
+			bot,
+			sb.String(),
+			&gotgbot.EditMessageTextOpts{
+				ParseMode: "HTML",
+				ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+					InlineKeyboard: keyboard,
+				},
+			},
+		)
+		if err != nil && strings.Contains(err.Error(), "message is not modified") {
+			return nil
+		}
+		return err
+	} else {
+		_, err := bot.SendMessage(
+			ctx.EffectiveChat.Id,
+			sb.String(),
+			&gotgbot.SendMessageOpts{
+				ParseMode:       "HTML",
+				MessageThreadId: topicID,
+				ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+					InlineKeyboard: keyboard,
+				},
+			},
+		)
+		return err
+	}
+}
+
+func (ms *MasterService) topicMasterLimb(ctx *ext.Context) string {
+	return common.Limb{
+		Type:   "telegram",
+		UID:    common.Itoa(ms.config().Master.AdminID),
+		ChatID: common.Itoa(ctx.EffectiveChat.Id),
+	}.String()
+}
+
+func topicButton(text, action string) gotgbot.InlineKeyboardButton {
+	cb := Callback{
+		Category: "topic",
+		Acction:  action,
+	}
+	return gotgbot.InlineKeyboardButton{Text: text, CallbackData: putCallback(cb)}
+}
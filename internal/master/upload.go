@@ -0,0 +1,82 @@
+package master
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const uploadActionInterval = 5 * time.Second
+
+// report file upload progress to Telegram until limb client responds
+func (ms *MasterService) trackUpload(rawMsg *gotgbot.Message, event *common.OctopusEvent) {
+	blob := event.Data.(*common.BlobData)
+
+	status, err := rawMsg.Reply(
+		ms.bot,
+		fmt.Sprintf("*[UPLOADING]: %s (%s)*", common.EscapeText("Markdown", blob.Name), formatSize(len(blob.Binary))),
+		&gotgbot.SendMessageOpts{
+			ParseMode:           "Markdown",
+			MessageThreadId:     rawMsg.MessageThreadId,
+			DisableNotification: true,
+		},
+	)
+	if err != nil {
+		log.Warnf("Failed to send upload status: %v", err)
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(uploadActionInterval)
+		defer ticker.Stop()
+
+		for {
+			ms.bot.SendChatAction(rawMsg.Chat.Id, "upload_document", &gotgbot.SendChatActionOpts{MessageThreadId: rawMsg.MessageThreadId})
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	callback := event.Callback
+	event.Callback = func(event *common.OctopusEvent, err error) {
+		close(done)
+
+		if err != nil {
+			if _, _, err := status.EditText(
+				ms.bot,
+				fmt.Sprintf("*[FAIL]: %s*", common.EscapeText("Markdown", err.Error())),
+				&gotgbot.EditMessageTextOpts{ParseMode: "Markdown"},
+			); err != nil {
+				log.Warnf("Failed to update upload status: %v", err)
+			}
+			return
+		}
+
+		if _, err := status.Delete(ms.bot, nil); err != nil {
+			log.Warnf("Failed to delete upload status: %v", err)
+		}
+		callback(event, nil)
+	}
+}
+
+func formatSize(size int) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := unit, 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
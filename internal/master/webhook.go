@@ -0,0 +1,191 @@
+package master
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/duo/octopus/internal/manager"
+	"github.com/duo/octopus/internal/webhook"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/gabriel-vasile/mimetype"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// show webhook delivery log
+func (ms *MasterService) onWebhooks(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if len(ms.config().Webhook.Endpoints) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(bot, "No webhook configured.", &gotgbot.SendMessageOpts{
+			MessageThreadId: ctx.EffectiveMessage.MessageThreadId,
+		})
+		return err
+	}
+
+	return ms.showWebhooks(bot, ctx, Callback{
+		Category: "webhook",
+		Acction:  "list",
+	})
+}
+
+func (ms *MasterService) handleWebhook(bot *gotgbot.Bot, ctx *ext.Context, cb Callback) error {
+	if ctx.Update.CallbackQuery.From.Id != ms.config().Master.AdminID {
+		return errors.New("webhook from stranger")
+	}
+
+	if cb.Acction == "close" {
+		_, _, err := ctx.EffectiveMessage.EditText(
+			bot,
+			"_Canceled by user._",
+			&gotgbot.EditMessageTextOpts{ParseMode: "Markdown"},
+		)
+		return err
+	}
+
+	return ms.showWebhooks(bot, ctx, cb)
+}
+
+func (ms *MasterService) showWebhooks(bot *gotgbot.Bot, ctx *ext.Context, cb Callback) error {
+	pageSize := ms.config().Master.PageSize
+
+	count, err := manager.GetDeliveryCount()
+	if err != nil {
+		log.Warnf("Get delivery count failed: %v", err)
+		return err
+	}
+
+	if count == 0 {
+		_, err := bot.SendMessage(
+			ctx.EffectiveChat.Id,
+			"No webhook delivery found.",
+			&gotgbot.SendMessageOpts{
+				MessageThreadId: ctx.EffectiveMessage.MessageThreadId,
+			},
+		)
+		return err
+	}
+
+	pager := manager.CalcPager(cb.Page, pageSize, count)
+
+	deliveries, err := manager.GetDeliveryList(pager.CurrentPage, pageSize)
+	if err != nil {
+		log.Warnf("Get delivery list failed: %v", err)
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<b>Webhook deliveries</b>")
+	for _, d := range deliveries {
+		sb.WriteString(fmt.Sprintf(
+			"\n\n%s <b>%s</b> | %s\n%s %s %s | %s",
+			deliveryIcon(d.Status),
+			html.EscapeString(d.Webhook),
+			d.Updated.Local().Format("2006-01-02 15:04:05"),
+			d.Direction,
+			html.EscapeString(d.EventType),
+			html.EscapeString(d.Vendor),
+			html.EscapeString(d.Chat),
+		))
+		if d.Attempts > 0 {
+			sb.WriteString(fmt.Sprintf("\nattempts: %d, code: %d", d.Attempts, d.ResponseCode))
+		}
+		if d.Error != "" {
+			sb.WriteString(fmt.Sprintf("\n<i>%s</i>", html.EscapeString(d.Error)))
+		}
+	}
+
+	var bottom = []gotgbot.InlineKeyboardButton{}
+	if pager.HasPrev {
+		prev := cb
+		prev.Acction = "list"
+		prev.Page = pager.PrevPage
+		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: "< Prev", CallbackData: putCallback(prev)})
+	} else {
+		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: " ", CallbackData: "0"})
+	}
+	{
+		info := fmt.Sprintf("%d / %d (%d) | Cancel",
+			pager.CurrentPage, pager.NumPages, pager.NumItems)
+		cb := Callback{
+			Category: "webhook",
+			Acction:  "close",
+		}
+		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: info, CallbackData: putCallback(cb)})
+	}
+	if pager.HasNext {
+		next := cb
+		next.Acction = "list"
+		next.Page = pager.NextPage
+		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: "Next >", CallbackData: putCallback(next)})
+	} else {
+		bottom = append(bottom, gotgbot.InlineKeyboardButton{Text: " ", CallbackData: "0"})
+	}
+	keyboard := [][]gotgbot.InlineKeyboardButton{bottom}
+
+	if ctx.EffectiveMessage.From.Id == bot.User.Id {
+		_, _, err := ctx.EffectiveMessage.EditText(
+			bot,
+			sb.String(),
+			&gotgbot.EditMessageTextOpts{
+				ParseMode: "HTML",
+				ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+					InlineKeyboard: keyboard,
+				},
+			},
+		)
+		return err
+	} else {
+		_, err := bot.SendMessage(
+			ctx.EffectiveChat.Id,
+			sb.String(),
+			&gotgbot.SendMessageOpts{
+				ParseMode:       "HTML",
+				MessageThreadId: ctx.EffectiveMessage.MessageThreadId,
+				ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+					InlineKeyboard: keyboard,
+				},
+			},
+		)
+		return err
+	}
+}
+
+func deliveryIcon(status string) string {
+	switch status {
+	case manager.DeliverySuccess:
+		return "✅"
+	case manager.DeliveryFailed:
+		return "❌"
+	case manager.DeliveryDropped:
+		return "🚫"
+	default:
+		return "⏳"
+	}
+}
+
+// download blob referenced by webhook payload, e.g. GET /api/v1/blobs/{hash}
+func (ms *MasterService) apiGetBlob(w http.ResponseWriter, r *http.Request) {
+	path, err := webhook.BlobFile(r.PathValue("hash"))
+	if err != nil {
+		apiError(w, http.StatusNotFound, "M_NOT_FOUND", err)
+		return
+	}
+
+	mime, err := mimetype.DetectFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			apiError(w, http.StatusNotFound, "M_NOT_FOUND", errors.New("blob not found or expired"))
+		} else {
+			apiError(w, http.StatusInternalServerError, "M_UNKNOWN", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", mime.String())
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "octopus"
+
+var (
+	LimbClients = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "limb_clients",
+		Help:      "Connected limb clients by kind and vendor.",
+	}, []string{"kind", "vendor"})
+
+	Events = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_total",
+		Help:      "Events between master and limbs by direction, vendor and type.",
+	}, []string{"direction", "vendor", "type"})
+
+	TelegramRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "telegram_request_duration_seconds",
+		Help:      "Telegram Bot API request latency by method.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method"})
+
+	TelegramRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_request_errors_total",
+		Help:      "Failed Telegram Bot API requests by method.",
+	}, []string{"method"})
+
+	TranscodeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "transcode_duration_seconds",
+		Help:      "Media transcoding duration of filters by converter.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"converter"})
+
+	WebsocketPendingRequests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_pending_requests",
+		Help:      "Outstanding websocket requests waiting for response by vendor.",
+	}, []string{"vendor"})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency by operation.",
+		Buckets:   []float64{.0005, .001, .005, .01, .05, .1, .5, 1, 5},
+	}, []string{"operation"})
+
+	RuleMatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rule_matches_total",
+		Help:      "Incoming events matched by rules by action.",
+	}, []string{"action"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		LimbClients,
+		Events,
+		TelegramRequestDuration,
+		TelegramRequestErrors,
+		TranscodeDuration,
+		WebsocketPendingRequests,
+		DBQueryDuration,
+		RuleMatches,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterChanDepth report buffered events of a message channel
+func RegisterChanDepth(name string, depth func() int) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "message_chan_depth",
+		Help:        "Buffered events of message channel.",
+		ConstLabels: prometheus.Labels{"chan": name},
+	}, func() float64 {
+		return float64(depth())
+	}))
+}
+
+// RegisterChanBuffer report memory and spill queue of a message channel
+func RegisterChanBuffer(name string, memory, spilled, spillTotal func() int64) {
+	labels := prometheus.Labels{"chan": name}
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "message_chan_memory_bytes",
+			Help:        "Estimated memory of buffered events of message channel.",
+			ConstLabels: labels,
+		}, func() float64 {
+			return float64(memory())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "message_chan_spilled",
+			Help:        "Events of message channel waiting in spill queue on disk.",
+			ConstLabels: labels,
+		}, func() float64 {
+			return float64(spilled())
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "message_chan_spilled_total",
+			Help:        "Events of message channel spilled to disk over memory budget.",
+			ConstLabels: labels,
+		}, func() float64 {
+			return float64(spillTotal())
+		}),
+	)
+}
+
+// ObserveTranscode record duration of converter since start
+func ObserveTranscode(converter string, start time.Time) {
+	TranscodeDuration.WithLabelValues(converter).Observe(time.Since(start).Seconds())
+}
+
+// ObserveDBQuery record duration of database operation since start
+func ObserveDBQuery(operation string, start time.Time) {
+	DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// BotClient measures requests of wrapped Telegram bot client
+type BotClient struct {
+	gotgbot.BotClient
+}
+
+func (c BotClient) RequestWithContext(ctx context.Context, token string, method string, params map[string]string, data map[string]gotgbot.FileReader, opts *gotgbot.RequestOpts) (json.RawMessage, error) {
+	start := time.Now()
+	resp, err := c.BotClient.RequestWithContext(ctx, token, method, params, data, opts)
+	TelegramRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		TelegramRequestErrors.WithLabelValues(method).Inc()
+	}
+	return resp, err
+}
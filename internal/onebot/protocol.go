@@ -65,7 +65,9 @@ const (
 	SendForwardMsg        RequestType = "send_forward_msg"
 	SendPrivateForwardMsg RequestType = "send_private_forward_msg"
 	SendGroupForwardMsg   RequestType = "send_group_forward_msg"
+	UploadPrivateFile     RequestType = "upload_private_file"
 	UploadGroupFile       RequestType = "upload_group_file"
+	GetGroupRootFiles     RequestType = "get_group_root_files"
 	DownloadFile          RequestType = "download_file"
 	GetFile               RequestType = "get_file"
 )
@@ -98,6 +100,50 @@ func NewGetGroupMemberInfoRequest(groupID, userID int64, noCache bool) *Request
 		Params: map[string]interface{}{
 			"group_id": groupID,
 			"user_id":  userID,
+			"no_cache": noCache,
+		},
+	}
+}
+
+func NewGetGroupMemberListRequest(groupID int64) *Request {
+	return &Request{
+		Action: "get_group_member_list",
+		Params: map[string]interface{}{
+			"group_id": groupID,
+		},
+	}
+}
+
+func NewGetStrangerInfoRequest(userID int64, noCache bool) *Request {
+	return &Request{
+		Action: "get_stranger_info",
+		Params: map[string]interface{}{
+			"user_id":  userID,
+			"no_cache": noCache,
+		},
+	}
+}
+
+func NewSetFriendAddRequest(flag string, approve bool, remark string) *Request {
+	return &Request{
+		Action: "set_friend_add_request",
+		Params: map[string]interface{}{
+			"flag":    flag,
+			"approve": approve,
+			"remark":  remark,
+		},
+	}
+}
+
+func NewSetGroupAddRequest(flag, subType string, approve bool, reason string) *Request {
+	return &Request{
+		Action: "set_group_add_request",
+		Params: map[string]interface{}{
+			"flag":     flag,
+			"sub_type": subType,
+			"type":     subType,
+			"approve":  approve,
+			"reason":   reason,
 		},
 	}
 }
@@ -182,6 +228,26 @@ func NewGroupForwardRequest(groupID int64, messageID int32) *Request {
 	}
 }
 
+func NewPrivateForwardMsgRequest(userID int64, nodes []ISegment) *Request {
+	return &Request{
+		Action: "send_private_forward_msg",
+		Params: map[string]interface{}{
+			"user_id":  userID,
+			"messages": nodes,
+		},
+	}
+}
+
+func NewGroupForwardMsgRequest(groupID int64, nodes []ISegment) *Request {
+	return &Request{
+		Action: "send_group_forward_msg",
+		Params: map[string]interface{}{
+			"group_id": groupID,
+			"messages": nodes,
+		},
+	}
+}
+
 // Lagrange.OneBot
 func NewUploadPrivateFileRequest(userID int64, file string, name string) *Request {
 	return &Request{
@@ -195,13 +261,27 @@ func NewUploadPrivateFileRequest(userID int64, file string, name string) *Reques
 }
 
 // Lagrange.OneBot
-func NewUploadGroupFileRequest(groupID int64, file string, name string) *Request {
+func NewUploadGroupFileRequest(groupID int64, file string, name string, folder string) *Request {
+	params := map[string]interface{}{
+		"group_id": groupID,
+		"file":     file,
+		"name":     name,
+	}
+	if folder != "" {
+		params["folder"] = folder
+	}
+
 	return &Request{
 		Action: "upload_group_file",
+		Params: params,
+	}
+}
+
+func NewGetGroupRootFilesRequest(groupID int64) *Request {
+	return &Request{
+		Action: "get_group_root_files",
 		Params: map[string]interface{}{
 			"group_id": groupID,
-			"file":     file,
-			"name":     name,
 		},
 	}
 }
@@ -209,6 +289,8 @@ func NewUploadGroupFileRequest(groupID int64, file string, name string) *Request
 type Response struct {
 	Status  string `json:"status"`
 	Retcode int32  `json:"retcode"`
+	Message string `json:"message,omitempty" mapstructure:"message"`
+	Wording string `json:"wording,omitempty" mapstructure:"wording"`
 	Data    any    `json:"params,omitempty"`
 	Echo    string `json:"echo,omitempty"`
 }
@@ -223,11 +305,23 @@ type FriendInfo struct {
 	Remark   string `json:"remark,omitempty" mapstructure:"remark,omitempty"`
 }
 
+type StrangerInfo struct {
+	ID       int64  `json:"user_id" mapstructure:"user_id"`
+	Nickname string `json:"nickname,omitempty" mapstructure:"nickname,omitempty"`
+	Sex      string `json:"sex,omitempty" mapstructure:"sex,omitempty"`
+	Age      int32  `json:"age,omitempty" mapstructure:"age,omitempty"`
+}
+
 type GroupInfo struct {
 	ID   int64  `json:"group_id" mapstructure:"group_id"`
 	Name string `json:"group_name,omitempty" mapstructure:"group_name,omitempty"`
 }
 
+type FolderInfo struct {
+	ID   string `json:"folder_id" mapstructure:"folder_id"`
+	Name string `json:"folder_name" mapstructure:"folder_name"`
+}
+
 type FileInfo struct {
 	ID       string `json:"id,omitempty" mapstructure:"id,omitempty"`
 	Name     string `json:"name,omitempty" mapstructure:"name,omitempty"`
@@ -235,6 +329,7 @@ type FileInfo struct {
 	FileName string `json:"file_name,omitempty" mapstructure:"file_name,omitempty"`
 	URL      string `json:"url" mapstructure:"url"`
 	Base64   string `json:"base64,omitempty" mapstructure:"base64,omitempty"`
+	Size     int64  `json:"size,omitempty" mapstructure:"size,omitempty"`
 	Data     []byte
 	//FileSize string `json:"file_size" mapstructure:"file_size"`
 }
@@ -261,6 +356,7 @@ const (
 	NoticeGroupDecrease EventType = "notice_group_decrease"
 	NoticeGroupIncrease EventType = "notice_group_increase"
 	NoticeGroupBan      EventType = "notice_group_ban"
+	NoticeGroupCard     EventType = "notice_group_card"
 	NoticeFriendAdd     EventType = "notice_friend_add"
 	NoticeGroupRecall   EventType = "notice_group_recall"
 	NoticeFriendRecall  EventType = "notice_friend_recall"
@@ -403,6 +499,69 @@ func (g *FriendRecall) EventType() EventType {
 	return NoticeFriendRecall
 }
 
+type GroupNotice struct {
+	Event      `mapstructure:",squash"`
+	NoticeType string `json:"notice_type" mapstructure:"notice_type"`
+	SubType    string `json:"sub_type" mapstructure:"sub_type"`
+	GroupID    int64  `json:"group_id" mapstructure:"group_id"`
+	UserID     int64  `json:"user_id" mapstructure:"user_id"`
+	OperatorID int64  `json:"operator_id" mapstructure:"operator_id"`
+	TargetID   int64  `json:"target_id" mapstructure:"target_id"`
+	Duration   int64  `json:"duration" mapstructure:"duration"`
+	HonorType  string `json:"honor_type" mapstructure:"honor_type"`
+	CardNew    string `json:"card_new" mapstructure:"card_new"`
+	CardOld    string `json:"card_old" mapstructure:"card_old"`
+}
+
+func (n *GroupNotice) EventType() EventType {
+	switch n.NoticeType {
+	case "group_increase":
+		return NoticeGroupIncrease
+	case "group_decrease":
+		return NoticeGroupDecrease
+	case "group_ban":
+		return NoticeGroupBan
+	case "group_admin":
+		return NoticeGroupAdmin
+	case "group_card":
+		return NoticeGroupCard
+	}
+
+	switch n.SubType {
+	case "lucky_king":
+		return NoticeLuckyKing
+	case "honor":
+		return NoticeHonnor
+	}
+	return NoticeNotify
+}
+
+type FriendRequest struct {
+	Event       `mapstructure:",squash"`
+	RequestType string `json:"request_type" mapstructure:"request_type"`
+	UserID      int64  `json:"user_id" mapstructure:"user_id"`
+	Comment     string `json:"comment" mapstructure:"comment"`
+	Flag        string `json:"flag" mapstructure:"flag"`
+}
+
+func (r *FriendRequest) EventType() EventType {
+	return RequestFriend
+}
+
+type GroupRequest struct {
+	Event       `mapstructure:",squash"`
+	RequestType string `json:"request_type" mapstructure:"request_type"`
+	SubType     string `json:"sub_type" mapstructure:"sub_type"`
+	GroupID     int64  `json:"group_id" mapstructure:"group_id"`
+	UserID      int64  `json:"user_id" mapstructure:"user_id"`
+	Comment     string `json:"comment" mapstructure:"comment"`
+	Flag        string `json:"flag" mapstructure:"flag"`
+}
+
+func (r *GroupRequest) EventType() EventType {
+	return RequestGroup
+}
+
 type SegmentType string
 
 const (
@@ -711,6 +870,22 @@ func NewNode(id string) *NodeSegment {
 	}
 }
 
+func NewCustomNode(name, uin string, ts int64, content []ISegment) *NodeSegment {
+	return &NodeSegment{
+		Segment{
+			Type: string(Node),
+			Data: map[string]interface{}{
+				"name":     name,
+				"uin":      uin,
+				"user_id":  uin,
+				"nickname": name,
+				"time":     ts,
+				"content":  content,
+			},
+		},
+	}
+}
+
 func NewXML(content string) *NodeSegment {
 	return &NodeSegment{
 		Segment{
@@ -741,7 +916,7 @@ func UnmarshalPayload(m map[string]interface{}) (Payload, error) {
 		case "notice":
 			return unmarshalNotice(m)
 		case "request":
-			return unmarshalEvent(m)
+			return unmarshalRequestEvent(m)
 		}
 		return nil, fmt.Errorf("event %s not support", postType)
 	} else if _, ok := m["retcode"]; ok {
@@ -796,6 +971,25 @@ func unmarshalNotice(m map[string]interface{}) (Payload, error) {
 		var event FriendRecall
 		err := mapstructure.WeakDecode(m, &event)
 		return &event, err
+	case "group_increase", "group_decrease", "group_ban", "group_admin", "group_card", "notify":
+		var event GroupNotice
+		err := mapstructure.WeakDecode(m, &event)
+		return &event, err
+	}
+
+	return unmarshalEvent(m)
+}
+
+func unmarshalRequestEvent(m map[string]interface{}) (Payload, error) {
+	switch m["request_type"] {
+	case "friend":
+		var event FriendRequest
+		err := mapstructure.WeakDecode(m, &event)
+		return &event, err
+	case "group":
+		var event GroupRequest
+		err := mapstructure.WeakDecode(m, &event)
+		return &event, err
 	}
 
 	return unmarshalEvent(m)
@@ -0,0 +1,262 @@
+package satori
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+)
+
+type Opcode int
+
+const (
+	OpEvent Opcode = iota
+	OpPing
+	OpPong
+	OpIdentify
+	OpReady
+)
+
+type ChannelType int
+
+const (
+	ChannelText ChannelType = iota
+	ChannelDirect
+	ChannelCategory
+	ChannelVoice
+)
+
+type RequestType string
+
+const (
+	ChannelGet        RequestType = "channel.get"
+	ChannelList       RequestType = "channel.list"
+	GuildGet          RequestType = "guild.get"
+	GuildList         RequestType = "guild.list"
+	GuildMemberGet    RequestType = "guild.member.get"
+	FriendList        RequestType = "friend.list"
+	UserGet           RequestType = "user.get"
+	UserChannelCreate RequestType = "user.channel.create"
+	MessageCreate     RequestType = "message.create"
+	MessageGet        RequestType = "message.get"
+	MessageDelete     RequestType = "message.delete"
+)
+
+type EventType string
+
+const (
+	MessageCreated EventType = "message-created"
+	MessageDeleted EventType = "message-deleted"
+	GuildAdded     EventType = "guild-added"
+	GuildUpdated   EventType = "guild-updated"
+	GuildRemoved   EventType = "guild-removed"
+	FriendRequest  EventType = "friend-request"
+	LoginAdded     EventType = "login-added"
+	LoginRemoved   EventType = "login-removed"
+	LoginUpdated   EventType = "login-updated"
+)
+
+type Signal struct {
+	Op   Opcode          `json:"op"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+type Identify struct {
+	Token    string `json:"token,omitempty"`
+	Sequence int64  `json:"sequence,omitempty"`
+}
+
+type Ready struct {
+	Logins []*Login `json:"logins"`
+}
+
+type Login struct {
+	User     *User  `json:"user,omitempty"`
+	SelfID   string `json:"self_id,omitempty"`
+	Platform string `json:"platform,omitempty"`
+	Status   int    `json:"status,omitempty"`
+}
+
+type Event struct {
+	ID        int64        `json:"id"`
+	Type      EventType    `json:"type"`
+	Platform  string       `json:"platform"`
+	SelfID    string       `json:"self_id"`
+	Timestamp int64        `json:"timestamp"`
+	Channel   *Channel     `json:"channel,omitempty"`
+	Guild     *Guild       `json:"guild,omitempty"`
+	Login     *Login       `json:"login,omitempty"`
+	Member    *GuildMember `json:"member,omitempty"`
+	Message   *Message     `json:"message,omitempty"`
+	Operator  *User        `json:"operator,omitempty"`
+	User      *User        `json:"user,omitempty"`
+}
+
+type User struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Nick   string `json:"nick,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+	IsBot  bool   `json:"is_bot,omitempty"`
+}
+
+type Channel struct {
+	ID       string      `json:"id"`
+	Type     ChannelType `json:"type"`
+	Name     string      `json:"name,omitempty"`
+	ParentID string      `json:"parent_id,omitempty"`
+}
+
+type Guild struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+type GuildMember struct {
+	User     *User  `json:"user,omitempty"`
+	Nick     string `json:"nick,omitempty"`
+	Avatar   string `json:"avatar,omitempty"`
+	JoinedAt int64  `json:"joined_at,omitempty"`
+}
+
+type Message struct {
+	ID        string       `json:"id"`
+	Content   string       `json:"content"`
+	Channel   *Channel     `json:"channel,omitempty"`
+	Guild     *Guild       `json:"guild,omitempty"`
+	Member    *GuildMember `json:"member,omitempty"`
+	User      *User        `json:"user,omitempty"`
+	Quote     *Message     `json:"quote,omitempty"`
+	CreatedAt int64        `json:"created_at,omitempty"`
+	UpdatedAt int64        `json:"updated_at,omitempty"`
+}
+
+type List[T any] struct {
+	Data []T    `json:"data"`
+	Next string `json:"next,omitempty"`
+}
+
+type ElementType string
+
+const (
+	Text  ElementType = "text"
+	At    ElementType = "at"
+	Sharp ElementType = "sharp"
+	Link  ElementType = "a"
+	Img   ElementType = "img"
+	Audio ElementType = "audio"
+	Video ElementType = "video"
+	File  ElementType = "file"
+	Quote ElementType = "quote"
+	Br    ElementType = "br"
+	P     ElementType = "p"
+)
+
+// Element is a flattened message element, children of quote are dropped
+type Element struct {
+	Type  ElementType
+	Attrs map[string]string
+	Text  string
+}
+
+func (e *Element) Attr(key string) string {
+	return e.Attrs[key]
+}
+
+func NewText(content string) *Element {
+	return &Element{Type: Text, Text: content}
+}
+
+func NewAt(id string) *Element {
+	return &Element{Type: At, Attrs: map[string]string{"id": id}}
+}
+
+func NewQuote(id string) *Element {
+	return &Element{Type: Quote, Attrs: map[string]string{"id": id}}
+}
+
+func NewResource(t ElementType, src string, title string) *Element {
+	attrs := map[string]string{"src": src}
+	if title != "" {
+		attrs["title"] = title
+	}
+	return &Element{Type: t, Attrs: attrs}
+}
+
+// Parse satori message content into elements
+func Parse(content string) []*Element {
+	elements := []*Element{}
+
+	z := nethtml.NewTokenizer(strings.NewReader(content))
+	quoteDepth := 0
+	for {
+		tt := z.Next()
+		switch tt {
+		case nethtml.ErrorToken:
+			return elements
+		case nethtml.TextToken:
+			if quoteDepth == 0 {
+				elements = append(elements, NewText(string(z.Text())))
+			}
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			e := &Element{
+				Type:  ElementType(name),
+				Attrs: map[string]string{},
+			}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				e.Attrs[string(key)] = string(val)
+			}
+
+			if quoteDepth == 0 {
+				switch e.Type {
+				case Br:
+					elements = append(elements, NewText("\n"))
+				case P:
+				default:
+					elements = append(elements, e)
+				}
+			}
+			if e.Type == Quote && tt == nethtml.StartTagToken {
+				quoteDepth++
+			}
+		case nethtml.EndTagToken:
+			name, _ := z.TagName()
+			if ElementType(name) == Quote && quoteDepth > 0 {
+				quoteDepth--
+			} else if ElementType(name) == P && quoteDepth == 0 {
+				elements = append(elements, NewText("\n"))
+			}
+		}
+	}
+}
+
+// Build satori message content from elements
+func Build(elements []*Element) string {
+	var sb strings.Builder
+	for _, e := range elements {
+		if e.Type == Text {
+			sb.WriteString(html.EscapeString(e.Text))
+			continue
+		}
+
+		sb.WriteString("<")
+		sb.WriteString(string(e.Type))
+		keys := make([]string, 0, len(e.Attrs))
+		for key := range e.Attrs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sb.WriteString(fmt.Sprintf(" %s=\"%s\"", key, html.EscapeString(e.Attrs[key])))
+		}
+		sb.WriteString("/>")
+	}
+	return sb.String()
+}
@@ -11,3 +11,15 @@ type Client interface {
 
 	Dispose()
 }
+
+// ForwardClient accepts EventForward of several messages
+type ForwardClient interface {
+	SupportsForward() bool
+}
+
+// AsyncClient reports result of some events after sending returned, e.g. when
+// the id of sent message arrives with a later notice
+type AsyncClient interface {
+	// SendEventAsync sends event like SendEvent, done is called once with the result
+	SendEventAsync(event *common.OctopusEvent, done func(*common.OctopusEvent, error))
+}
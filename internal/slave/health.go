@@ -0,0 +1,138 @@
+package slave
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+type healthResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type healthResponse struct {
+	Status string          `json:"status"`
+	Checks []*healthResult `json:"checks"`
+}
+
+// register health checks of other services
+func (ls *LimbService) AddHealthChecks(checks ...common.HealthCheck) {
+	ls.healthChecksLock.Lock()
+	defer ls.healthChecksLock.Unlock()
+
+	ls.healthChecks = append(ls.healthChecks, checks...)
+}
+
+func (ls *LimbService) ownHealthChecks() []common.HealthCheck {
+	return []common.HealthCheck{
+		{
+			Name:     "master_loop",
+			Liveness: true,
+			Check: func(_ context.Context) (string, error) {
+				if !ls.masterLoopRunning.Load() {
+					return "", errors.New("master event loop exited")
+				}
+				return "running", nil
+			},
+		},
+		{
+			Name:  "limbs",
+			Check: ls.checkLimbs,
+		},
+	}
+}
+
+// required vendors fail readiness when disconnected, other known vendors are only reported
+func (ls *LimbService) checkLimbs(_ context.Context) (string, error) {
+	ls.clientsLock.Lock()
+	connected := make([]string, 0, len(ls.clients))
+	for vendor := range ls.clients {
+		connected = append(connected, vendor)
+	}
+	ls.clientsLock.Unlock()
+
+	expected := slices.Clone(ls.config.Service.RequiredVendors)
+	if vendors, err := manager.GetChatVendors(); err != nil {
+		log.Warnf("Get chat vendors failed: %v", err)
+	} else {
+		expected = append(expected, vendors...)
+	}
+	slices.Sort(expected)
+	expected = slices.Compact(expected)
+
+	missingRequired := []string{}
+	disconnected := []string{}
+	for _, vendor := range expected {
+		if slices.Contains(connected, vendor) {
+			continue
+		}
+		disconnected = append(disconnected, vendor)
+		if slices.Contains(ls.config.Service.RequiredVendors, vendor) {
+			missingRequired = append(missingRequired, vendor)
+		}
+	}
+
+	slices.Sort(connected)
+	detail := fmt.Sprintf("connected: [%s], disconnected: [%s]",
+		strings.Join(connected, ", "), strings.Join(disconnected, ", "))
+	if len(missingRequired) > 0 {
+		return detail, fmt.Errorf("required limbs disconnected: %s", strings.Join(missingRequired, ", "))
+	}
+	return detail, nil
+}
+
+// liveness runs liveness checks only, readiness runs all, details are shown to authorized requests
+func (ls *LimbService) handleHealth(w http.ResponseWriter, r *http.Request, readiness bool) {
+	ls.healthChecksLock.Lock()
+	checks := slices.Clone(ls.healthChecks)
+	ls.healthChecksLock.Unlock()
+
+	verbose := ls.authorize(r) == nil
+
+	resp := &healthResponse{Status: "ok", Checks: []*healthResult{}}
+	for _, check := range checks {
+		if !readiness && !check.Liveness {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		detail, err := check.Check(ctx)
+		cancel()
+
+		result := &healthResult{Name: check.Name, Status: "ok"}
+		if err != nil {
+			result.Status = "fail"
+			resp.Status = "fail"
+			log.Warnf("Health check %s failed: %v", check.Name, err)
+		}
+		if verbose {
+			result.Detail = detail
+			if err != nil {
+				result.Error = err.Error()
+			}
+		}
+		resp.Checks = append(resp.Checks, result)
+	}
+
+	if resp.Status != "ok" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := common.Respond(w, resp); err != nil {
+		log.Warnf("Failed to write health response: %v", err)
+	}
+}
@@ -9,18 +9,23 @@ import (
 
 	"github.com/duo/octopus/internal/common"
 	"github.com/duo/octopus/internal/filter"
+	"github.com/duo/octopus/internal/metrics"
 
 	"github.com/gorilla/websocket"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// events of limb client handled concurrently, reading stops when all are busy
+const maxPendingEvents = 64
+
 type LimbClient struct {
 	vendor string
 	config *common.Configure
 
 	conn *websocket.Conn
 	out  chan<- *common.OctopusEvent
+	done chan struct{}
 
 	s2m filter.EventFilterChain
 	m2s filter.EventFilterChain
@@ -32,6 +37,7 @@ type LimbClient struct {
 	websocketRequestID    int64
 
 	mutex common.KeyMutex
+	slots chan struct{}
 }
 
 func NewLimbClient(vendor string, config *common.Configure, conn *websocket.Conn, out chan<- *common.OctopusEvent) *LimbClient {
@@ -52,10 +58,12 @@ func NewLimbClient(vendor string, config *common.Configure, conn *websocket.Conn
 		config:            config,
 		conn:              conn,
 		out:               out,
+		done:              make(chan struct{}),
 		m2s:               m2s,
 		s2m:               s2m,
 		websocketRequests: make(map[int64]chan<- *common.OctopusResponse),
 		mutex:             common.NewHashed(47),
+		slots:             make(chan struct{}, maxPendingEvents),
 	}
 }
 
@@ -68,9 +76,12 @@ func (lc *LimbClient) run(stopFunc func()) {
 	defer func() {
 		log.Infof("LimbClient(%s) disconnected from websocket", lc.vendor)
 		_ = lc.conn.Close()
+		close(lc.done)
 		stopFunc()
 	}()
 
+	go syncPeriodically(lc.config.Service.SyncInterval, lc.done, lc.requestSync)
+
 	for {
 		var msg common.OctopusMessage
 		err := lc.conn.ReadJSON(&msg)
@@ -85,13 +96,19 @@ func (lc *LimbClient) run(stopFunc func()) {
 			if request.Type == common.ReqPing {
 				log.Debugln("Receive ping request")
 			} else if request.Type == common.ReqEvent {
+				// stop reading when master falls behind, instead of piling up goroutines
+				lc.slots <- struct{}{}
 				go func() {
+					defer func() { <-lc.slots }()
+
 					event := request.Data.(*common.OctopusEvent)
 
 					lc.mutex.LockKey(event.Chat.ID)
 					defer lc.mutex.UnlockKey(event.Chat.ID)
 
-					event = lc.s2m.Apply(event)
+					if event = lc.s2m.Apply(event); event == nil {
+						return
+					}
 
 					lc.out <- event
 				}()
@@ -121,6 +138,7 @@ func (lc *LimbClient) SendEvent(event *common.OctopusEvent) (*common.OctopusEven
 	defer cancel()
 
 	event = lc.m2s.Apply(event)
+	common.EventLog(event).Debugf("Send octopus event: %v", event)
 
 	if data, err := lc.request(ctx, &common.OctopusRequest{
 		Type: common.ReqEvent,
@@ -128,7 +146,33 @@ func (lc *LimbClient) SendEvent(event *common.OctopusEvent) (*common.OctopusEven
 	}); err != nil {
 		return nil, err
 	} else {
-		return data.(*common.OctopusEvent), nil
+		resp := data.(*common.OctopusEvent)
+		// limb may answer sync request with chat list, instead of sending it later
+		if event.Type == common.EventSync && resp.Type == common.EventSync {
+			if _, ok := resp.Data.([]*common.Chat); ok {
+				resp.Vendor = event.Vendor
+				lc.out <- resp
+			}
+		}
+		return resp, nil
+	}
+}
+
+// ask limb to sync its chats
+func (lc *LimbClient) requestSync() {
+	vendor, err := common.VendorFromString(lc.vendor)
+	if err != nil {
+		log.Warnf("LimbClient(%s) invalid vendor: %v", lc.vendor, err)
+		return
+	}
+
+	if _, err := lc.SendEvent(&common.OctopusEvent{
+		Vendor:    *vendor,
+		ID:        "sync",
+		Timestamp: time.Now().Unix(),
+		Type:      common.EventSync,
+	}); err != nil {
+		log.Warnf("LimbClient(%s) failed to request sync: %v", lc.vendor, err)
 	}
 }
 
@@ -185,6 +229,7 @@ func (lc *LimbClient) addWebsocketResponseWaiter(reqID int64, waiter chan<- *com
 	lc.websocketRequestsLock.Lock()
 	lc.websocketRequests[reqID] = waiter
 	lc.websocketRequestsLock.Unlock()
+	metrics.WebsocketPendingRequests.WithLabelValues(lc.vendor).Inc()
 }
 
 func (lc *LimbClient) removeWebsocketResponseWaiter(reqID int64, waiter chan<- *common.OctopusResponse) {
@@ -194,6 +239,7 @@ func (lc *LimbClient) removeWebsocketResponseWaiter(reqID int64, waiter chan<- *
 		delete(lc.websocketRequests, reqID)
 	}
 	lc.websocketRequestsLock.Unlock()
+	metrics.WebsocketPendingRequests.WithLabelValues(lc.vendor).Dec()
 	close(waiter)
 }
 
@@ -1,16 +1,21 @@
 package slave
 
 import (
+	"cmp"
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/metrics"
+	"github.com/duo/octopus/internal/webhook"
 
 	"github.com/gorilla/websocket"
 
@@ -46,16 +51,52 @@ type LimbService struct {
 	in  <-chan *common.OctopusEvent
 	out chan<- *common.OctopusEvent
 
-	server *http.Server
+	server     *http.Server
+	stopServer sync.Once
 
 	clients     map[string]Client
+	replays     map[string]chan struct{} // closed once undelivered events of vendor are replayed
 	clientsLock sync.Mutex
 
+	// re-create callback of undelivered event before replay
+	restoreCallback func(*common.OctopusEvent)
+
+	stop chan struct{}
+
+	masterLoopRunning atomic.Bool
+
+	// master events being sent to clients
+	inflight atomic.Int64
+
+	healthChecks     []common.HealthCheck
+	healthChecksLock sync.Mutex
+
+	handlers map[string]http.Handler
+
 	mutex common.KeyMutex
 }
 
 // handle client connnection
 func (ls *LimbService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/metrics":
+		ls.handleMetrics(w, r)
+		return
+	case "/healthz":
+		ls.handleHealth(w, r, false)
+		return
+	case "/readyz":
+		ls.handleHealth(w, r, true)
+		return
+	}
+
+	for prefix, handler := range ls.handlers {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+	}
+
 	if strings.HasPrefix(r.URL.Path, "/onebot/") {
 		ls.handleOnebotConnection(w, r)
 		return
@@ -90,13 +131,13 @@ func (ls *LimbService) handleLimbConnection(w http.ResponseWriter, r *http.Reque
 	}
 
 	ls.observe(fmt.Sprintf("LimbClient(%s) connected", vendor))
+	metrics.LimbClients.WithLabelValues("limb", vendor).Inc()
 
 	lc := NewLimbClient(vendor, ls.config, conn, ls.out)
-	ls.clientsLock.Lock()
-	ls.clients[vendor] = lc
-	ls.clientsLock.Unlock()
+	ls.register(vendor, lc)
 	lc.run(func() {
 		ls.observe(fmt.Sprintf("LimbClient(%s) disconnected", vendor))
+		metrics.LimbClients.WithLabelValues("limb", vendor).Dec()
 		ls.clientsLock.Lock()
 		delete(ls.clients, vendor)
 		ls.clientsLock.Unlock()
@@ -133,19 +174,81 @@ func (ls *LimbService) handleOnebotConnection(w http.ResponseWriter, r *http.Req
 	}
 
 	ls.observe(fmt.Sprintf("OnebotClient(%s) connected", vendor))
+	metrics.LimbClients.WithLabelValues("onebot", vendor.String()).Inc()
 
 	oc := NewOnebotClient(&vendor, r.Header.Get("User-Agent"), ls.config, conn, ls.out)
-	ls.clientsLock.Lock()
-	ls.clients[vendor.String()] = oc
-	ls.clientsLock.Unlock()
+	ls.register(vendor.String(), oc)
 	oc.run(func() {
 		ls.observe(fmt.Sprintf("OnebotClient(%s) disconnected", vendor))
+		metrics.LimbClients.WithLabelValues("onebot", vendor.String()).Dec()
 		ls.clientsLock.Lock()
 		delete(ls.clients, vendor.String())
 		ls.clientsLock.Unlock()
 	})
 }
 
+// serve requests under path prefix by handler of other services, must be called before Start
+func (ls *LimbService) Handle(prefix string, handler http.Handler) {
+	ls.handlers[prefix] = handler
+}
+
+// expose prometheus metrics, protected by metrics token or secret
+func (ls *LimbService) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if err := ls.authorize(r); err != nil {
+		err.Write(w)
+		return
+	}
+
+	metrics.Handler().ServeHTTP(w, r)
+}
+
+// check bearer token of metrics and health endpoints
+func (ls *LimbService) authorize(r *http.Request) *common.ErrorResponse {
+	token := cmp.Or(ls.config.Service.MetricsToken, ls.config.Service.Secret)
+
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return &errMissingToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(authHeader[len("Bearer "):]), []byte(token)) != 1 {
+		return &errUnknownToken
+	}
+
+	return nil
+}
+
+// connect to satori endpoint, and reconnect on disconnect
+func (ls *LimbService) connectSatori(endpoint common.SatoriEndpoint) {
+	var sequence int64
+	for {
+		sc, err := NewSatoriClient(endpoint, sequence, ls.config, ls.out)
+		if err != nil {
+			log.Warnf("Failed to connect to Satori(%s): %v", endpoint.Endpoint, err)
+		} else {
+			vendor := sc.Vendor()
+			ls.observe(fmt.Sprintf("SatoriClient(%s) connected", vendor))
+			metrics.LimbClients.WithLabelValues("satori", vendor).Inc()
+
+			ls.register(vendor, sc)
+			sc.run(func() {
+				ls.observe(fmt.Sprintf("SatoriClient(%s) disconnected", vendor))
+				metrics.LimbClients.WithLabelValues("satori", vendor).Dec()
+				ls.clientsLock.Lock()
+				delete(ls.clients, vendor)
+				ls.clientsLock.Unlock()
+			})
+			sequence = sc.Sequence()
+		}
+
+		select {
+		case <-ls.stop:
+			return
+		case <-time.After(satoriRetryInterval):
+		}
+	}
+}
+
 func (ls *LimbService) Start() {
 	log.Infoln("LimbService starting to listen on", ls.config.Service.Addr)
 	go func() {
@@ -155,43 +258,72 @@ func (ls *LimbService) Start() {
 		}
 	}()
 
+	for _, endpoint := range ls.config.Service.Satori {
+		go ls.connectSatori(endpoint)
+	}
+
 	go ls.handleMasterLoop()
 }
 
 func (ls *LimbService) Stop() {
 	log.Infoln("LimbService stopping")
+	close(ls.stop)
+
 	ls.clientsLock.Lock()
 	for _, client := range ls.clients {
 		client.Dispose()
 	}
 	ls.clientsLock.Unlock()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	err := ls.server.Shutdown(ctx)
-	if err != nil {
-		log.Warnf("Failed to close server: %v", err)
-	}
+	ls.StopAccepting()
+}
+
+// StopAccepting close listener for new connections and API requests, connected clients are kept
+func (ls *LimbService) StopAccepting() {
+	ls.stopServer.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := ls.server.Shutdown(ctx); err != nil {
+			log.Warnf("Failed to close server: %v", err)
+		}
+	})
+}
+
+// Pending master events being sent to clients
+func (ls *LimbService) Pending() int {
+	return int(ls.inflight.Load())
 }
 
 func NewLimbService(config *common.Configure, in <-chan *common.OctopusEvent, out chan<- *common.OctopusEvent) *LimbService {
 	service := &LimbService{
-		config:  config,
-		in:      in,
-		out:     out,
-		clients: make(map[string]Client),
-		mutex:   common.NewHashed(47),
+		config:   config,
+		in:       in,
+		out:      out,
+		clients:  make(map[string]Client),
+		replays:  make(map[string]chan struct{}),
+		handlers: make(map[string]http.Handler),
+		stop:     make(chan struct{}),
+		mutex:    common.NewHashed(47),
 	}
 	service.server = &http.Server{
 		Addr:    service.config.Service.Addr,
 		Handler: service,
 	}
+	service.AddHealthChecks(service.ownHealthChecks()...)
 
 	return service
 }
 
-// read events from master
+// read events from master, keep reading after panic until channel closed
 func (ls *LimbService) handleMasterLoop() {
+	ls.masterLoopRunning.Store(true)
+	defer ls.masterLoopRunning.Store(false)
+
+	for !ls.readMasterEvents() {
+	}
+}
+
+func (ls *LimbService) readMasterEvents() (closed bool) {
 	defer func() {
 		panicErr := recover()
 		if panicErr != nil {
@@ -200,33 +332,100 @@ func (ls *LimbService) handleMasterLoop() {
 	}()
 
 	for event := range ls.in {
+		event.Trace()
 		vendor := event.Vendor.String()
+		metrics.Events.WithLabelValues("out", vendor, event.Type.String()).Inc()
+		webhook.Publish(webhook.DirectionOut, event)
 		ls.clientsLock.Lock()
 		client, ok := ls.clients[vendor]
+		replayed := ls.replays[vendor]
 		ls.clientsLock.Unlock()
 
+		ls.inflight.Add(1)
 		if ok {
 			event := event
 			go func() {
+				defer ls.inflight.Add(-1)
+
+				// undelivered events go first
+				<-replayed
+
 				ls.mutex.LockKey(event.Chat.ID)
 				defer ls.mutex.UnlockKey(event.Chat.ID)
 
 				ls.handleEvent(client, event)
 			}()
 		} else {
-			go event.Callback(nil, fmt.Errorf("LimbClient(%s) not found", vendor))
+			go func() {
+				defer ls.inflight.Add(-1)
+				callback(event, nil, fmt.Errorf("LimbClient(%s) not found", vendor))
+			}()
 		}
 	}
+
+	return true
+}
+
+// SupportsForward whether connected client of vendor accepts merged forward
+func (ls *LimbService) SupportsForward(vendor string) bool {
+	ls.clientsLock.Lock()
+	client := ls.clients[vendor]
+	ls.clientsLock.Unlock()
+
+	forwarder, ok := client.(ForwardClient)
+	return ok && forwarder.SupportsForward()
 }
 
 func (ls *LimbService) handleEvent(client Client, event *common.OctopusEvent) {
-	if resp, err := client.SendEvent(event); err != nil {
+	if async, ok := client.(AsyncClient); ok {
+		// still pending until result is reported
+		ls.inflight.Add(1)
+		async.SendEventAsync(event, func(resp *common.OctopusEvent, err error) {
+			defer ls.inflight.Add(-1)
+			handleResult(client, event, resp, err)
+		})
+		return
+	}
+
+	resp, err := client.SendEvent(event)
+	handleResult(client, event, resp, err)
+}
+
+func handleResult(client Client, event *common.OctopusEvent, resp *common.OctopusEvent, err error) {
+	if err != nil {
 		sendErr := fmt.Errorf("failed to send event to %s: %v", client.Vendor(), err)
-		event.Callback(nil, sendErr)
+		common.EventLog(event).Warn(sendErr)
+		callback(event, nil, sendErr)
 	} else {
 		event.ID = resp.ID
 		event.Timestamp = resp.Timestamp
-		event.Callback(event, nil)
+		callback(event, event, nil)
+	}
+}
+
+// report result to sender of event, events restored from disk have no callback
+func callback(event *common.OctopusEvent, result *common.OctopusEvent, err error) {
+	if event.Callback != nil {
+		event.Callback(result, err)
+	}
+}
+
+// sync chats periodically until done, disabled if interval is zero
+func syncPeriodically(interval time.Duration, done <-chan struct{}, sync func()) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			sync()
+		}
 	}
 }
 
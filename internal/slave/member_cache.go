@@ -0,0 +1,168 @@
+package slave
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/duo/octopus/internal/onebot"
+)
+
+// group member directory, refreshed lazily by ttl
+type MemberCache struct {
+	ttl time.Duration
+
+	groups     map[int64]*groupMembers
+	groupsLock sync.RWMutex
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type groupMembers struct {
+	members map[int64]*onebot.Sender
+	updated time.Time
+
+	// users not in member list nor found by member info, until expired
+	absent map[int64]time.Time
+}
+
+// member change found by refresh, before is nil for joined and after is nil for left
+type memberChange struct {
+	before *onebot.Sender
+	after  *onebot.Sender
+}
+
+func NewMemberCache(ttl time.Duration) *MemberCache {
+	return &MemberCache{
+		ttl:    ttl,
+		groups: make(map[int64]*groupMembers),
+	}
+}
+
+// get member from cache, count hit or miss
+func (mc *MemberCache) Get(groupID, userID int64) (*onebot.Sender, bool) {
+	mc.groupsLock.RLock()
+	defer mc.groupsLock.RUnlock()
+
+	if group, ok := mc.groups[groupID]; ok && time.Since(group.updated) < mc.ttl {
+		if member, ok := group.members[userID]; ok {
+			mc.hits.Add(1)
+			return member, true
+		}
+	}
+
+	mc.misses.Add(1)
+	return nil, false
+}
+
+// Peek gets member even if member list expired, without counting hit or miss.
+// Used right after a refresh, or to update a member already known
+func (mc *MemberCache) Peek(groupID, userID int64) (*onebot.Sender, bool) {
+	mc.groupsLock.RLock()
+	defer mc.groupsLock.RUnlock()
+
+	if group, ok := mc.groups[groupID]; ok {
+		member, ok := group.members[userID]
+		return member, ok
+	}
+	return nil, false
+}
+
+func (mc *MemberCache) IsFresh(groupID int64) bool {
+	mc.groupsLock.RLock()
+	defer mc.groupsLock.RUnlock()
+
+	group, ok := mc.groups[groupID]
+	return ok && time.Since(group.updated) < mc.ttl
+}
+
+// replace all members of group, return changes since last fill
+func (mc *MemberCache) Fill(groupID int64, members []*onebot.Sender) []memberChange {
+	group := &groupMembers{
+		members: make(map[int64]*onebot.Sender, len(members)),
+		updated: time.Now(),
+		absent:  make(map[int64]time.Time),
+	}
+	for _, m := range members {
+		group.members[m.UserID] = m
+	}
+
+	mc.groupsLock.Lock()
+	old, ok := mc.groups[groupID]
+	mc.groups[groupID] = group
+	mc.groupsLock.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	changes := []memberChange{}
+	for _, m := range members {
+		if before, ok := old.members[m.UserID]; !ok {
+			changes = append(changes, memberChange{after: m})
+		} else if before.Card != m.Card {
+			changes = append(changes, memberChange{before: before, after: m})
+		}
+	}
+	for userID, before := range old.members {
+		if _, ok := group.members[userID]; !ok {
+			changes = append(changes, memberChange{before: before})
+		}
+	}
+	return changes
+}
+
+func (mc *MemberCache) Put(groupID int64, member *onebot.Sender) {
+	mc.groupsLock.Lock()
+	defer mc.groupsLock.Unlock()
+
+	if group, ok := mc.groups[groupID]; ok {
+		group.members[member.UserID] = member
+		delete(group.absent, member.UserID)
+	}
+}
+
+// remember user is not a member, until member list expires
+func (mc *MemberCache) PutAbsent(groupID, userID int64) {
+	mc.groupsLock.Lock()
+	defer mc.groupsLock.Unlock()
+
+	if group, ok := mc.groups[groupID]; ok {
+		group.absent[userID] = time.Now().Add(mc.ttl)
+	}
+}
+
+// whether user is known not to be a member, counted as hit
+func (mc *MemberCache) IsAbsent(groupID, userID int64) bool {
+	mc.groupsLock.RLock()
+	defer mc.groupsLock.RUnlock()
+
+	if group, ok := mc.groups[groupID]; ok {
+		if expires, ok := group.absent[userID]; ok && time.Now().Before(expires) {
+			mc.hits.Add(1)
+			return true
+		}
+	}
+	return false
+}
+
+func (mc *MemberCache) Remove(groupID, userID int64) {
+	mc.groupsLock.Lock()
+	defer mc.groupsLock.Unlock()
+
+	if group, ok := mc.groups[groupID]; ok {
+		delete(group.members, userID)
+	}
+}
+
+// drop group, e.g. the group was left
+func (mc *MemberCache) Evict(groupID int64) {
+	mc.groupsLock.Lock()
+	delete(mc.groups, groupID)
+	mc.groupsLock.Unlock()
+}
+
+func (mc *MemberCache) Stats() (hits, misses int64) {
+	return mc.hits.Load(), mc.misses.Load()
+}
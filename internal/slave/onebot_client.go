@@ -4,7 +4,9 @@ import (
 	"cmp"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -12,6 +14,7 @@ import (
 
 	"github.com/duo/octopus/internal/common"
 	"github.com/duo/octopus/internal/filter"
+	"github.com/duo/octopus/internal/metrics"
 	"github.com/duo/octopus/internal/onebot"
 	"github.com/tidwall/gjson"
 
@@ -24,8 +27,30 @@ import (
 
 const (
 	LAGRANGE_ONEBOT string = "Lagrange.OneBot"
+	NAPCAT_ONEBOT   string = "NapCat.Onebot"
+
+	uploadNoticeTimeout = 30 * time.Second
+	selfUploadTTL       = 10 * time.Minute
+
+	// more member changes found by one refresh are only logged, the list was stale for long
+	maxMemberChanges = 20
 )
 
+var errMemberAbsent = errors.New("not a group member")
+
+// own group file upload, matched with its notice to get file id and not echo it back
+type pendingUpload struct {
+	groupID int64
+	name    string
+	size    int64
+	fileID  string    // from upload response or notice
+	notice  bool      // notice received
+	expires time.Time // forgotten after, notice is lost
+
+	// report file id once notice is received, nil if reported or not waited
+	done func(fileID string)
+}
+
 type OnebotClient struct {
 	vendor *common.Vendor
 	agent  string
@@ -37,6 +62,7 @@ type OnebotClient struct {
 
 	conn *websocket.Conn
 	out  chan<- *common.OctopusEvent
+	done chan struct{}
 
 	s2m filter.EventFilterChain
 	m2s filter.EventFilterChain
@@ -47,6 +73,12 @@ type OnebotClient struct {
 	websocketRequestsLock sync.RWMutex
 	websocketRequestID    int64
 
+	members      *MemberCache
+	membersMutex common.KeyMutex
+
+	uploads     []*pendingUpload // own group uploads whose notice is not received yet
+	uploadsLock sync.Mutex
+
 	mutex common.KeyMutex
 }
 
@@ -74,10 +106,17 @@ func NewOnebotClient(vendor *common.Vendor, agent string, config *common.Configu
 		m2s:               m2s,
 		s2m:               s2m,
 		websocketRequests: make(map[string]chan<- *onebot.Response),
+		done:              make(chan struct{}),
+		members:           NewMemberCache(config.Service.MemberTTL),
+		membersMutex:      common.NewHashed(47),
 		mutex:             common.NewHashed(47),
 	}
 }
 
+func (oc *OnebotClient) SupportsForward() bool {
+	return true
+}
+
 func (oc *OnebotClient) Vendor() string {
 	return oc.vendor.String()
 }
@@ -86,10 +125,13 @@ func (oc *OnebotClient) Vendor() string {
 func (oc *OnebotClient) run(stopFunc func()) {
 	defer func() {
 		log.Infof("OnebotClient(%s) disconnected from websocket", oc.vendor)
+		close(oc.done)
 		_ = oc.conn.Close()
 		stopFunc()
 	}()
 
+	go syncPeriodically(oc.config.Service.SyncInterval, oc.done, oc.updateChats)
+
 	for {
 		var m map[string]interface{}
 		if err := oc.conn.ReadJSON(&m); err != nil {
@@ -115,15 +157,72 @@ func (oc *OnebotClient) run(stopFunc func()) {
 
 // send event to onebot client, and return response
 func (oc *OnebotClient) SendEvent(event *common.OctopusEvent) (*common.OctopusEvent, error) {
-	log.Debugf("Receive Octopus event: %+v", event)
+	return oc.sendEvent(event, nil)
+}
+
+// send event to onebot client, group file upload is reported when its notice arrives
+func (oc *OnebotClient) SendEventAsync(event *common.OctopusEvent, done func(*common.OctopusEvent, error)) {
+	if resp, err := oc.sendEvent(event, done); resp != nil || err != nil {
+		done(resp, err)
+	}
+}
+
+// with done given, nil response and error means result will be reported by done
+func (oc *OnebotClient) sendEvent(event *common.OctopusEvent, done func(*common.OctopusEvent, error)) (*common.OctopusEvent, error) {
+	common.EventLog(event).Debugf("Receive octopus event: %v", event)
 
 	event = oc.m2s.Apply(event)
 
+	// events without chat
+	switch event.Type {
+	case common.EventSync:
+		go oc.updateChats()
+		return &common.OctopusEvent{
+			ID:        "sync",
+			Timestamp: time.Now().Unix(),
+		}, nil
+	case common.EventRequest:
+		return oc.setAddRequest(event)
+	}
+
 	targetID, err := common.Atoi(event.Chat.ID)
 	if err != nil {
 		return nil, err
 	}
 
+	switch event.Type {
+	case common.EventForward:
+		return oc.sendForward(targetID, event)
+	case common.EventFile:
+		if oc.canUploadFile() {
+			return oc.sendFile(targetID, event, done)
+		}
+	}
+
+	segments, err := oc.convertSegments(event)
+	if err != nil {
+		return nil, err
+	}
+
+	var request *onebot.Request
+	if event.Chat.Type == "private" {
+		request = onebot.NewPrivateMsgRequest(targetID, segments)
+	} else {
+		request = onebot.NewGroupMsgRequest(targetID, segments)
+	}
+
+	if messageID, err := oc.sendMsg(request); err != nil {
+		return nil, err
+	} else {
+		return &common.OctopusEvent{
+			ID:        common.Itoa(messageID),
+			Timestamp: time.Now().Unix(),
+		}, nil
+	}
+}
+
+// convert octopus event to onebot segments
+func (oc *OnebotClient) convertSegments(event *common.OctopusEvent) ([]onebot.ISegment, error) {
 	segments := []onebot.ISegment{}
 
 	if event.Reply != nil {
@@ -152,11 +251,6 @@ func (oc *OnebotClient) SendEvent(event *common.OctopusEvent) (*common.OctopusEv
 		binary := fmt.Sprintf("base64://%s", base64.StdEncoding.EncodeToString(blob.Binary))
 		segments = append(segments, onebot.NewRecord(binary))
 	case common.EventFile:
-		// TODO:
-		/*
-			if oc.agent == LAGRANGE_ONEBOT {
-			}
-		*/
 		blob := event.Data.(*common.BlobData)
 		binary := fmt.Sprintf("base64://%s", base64.StdEncoding.EncodeToString(blob.Binary))
 		segments = append(segments, onebot.NewFile(binary, blob.Name))
@@ -194,21 +288,201 @@ func (oc *OnebotClient) SendEvent(event *common.OctopusEvent) (*common.OctopusEv
 		return nil, fmt.Errorf("%s not support", event.Type)
 	}
 
+	return segments, nil
+}
+
+// whether implementation accepts base64 file in upload file APIs
+func (oc *OnebotClient) canUploadFile() bool {
+	return strings.HasPrefix(oc.agent, LAGRANGE_ONEBOT) || strings.HasPrefix(oc.agent, NAPCAT_ONEBOT)
+}
+
+// send file through group/private file APIs, see sendEvent for done
+func (oc *OnebotClient) sendFile(targetID int64, event *common.OctopusEvent, done func(*common.OctopusEvent, error)) (*common.OctopusEvent, error) {
+	blob := event.Data.(*common.BlobData)
+	binary := fmt.Sprintf("base64://%s", base64.StdEncoding.EncodeToString(blob.Binary))
+
+	result := func(fileID string) *common.OctopusEvent {
+		return &common.OctopusEvent{
+			ID:        cmp.Or(fileID, fmt.Sprint(time.Now().Unix())),
+			Timestamp: time.Now().Unix(),
+		}
+	}
+
+	if event.Chat.Type == "private" {
+		fileID, err := oc.uploadPrivateFile(targetID, binary, blob.Name)
+		if err != nil {
+			return nil, err
+		}
+		return result(fileID), nil
+	}
+
+	// notice may arrive before response
+	upload := &pendingUpload{
+		groupID: targetID,
+		name:    blob.Name,
+		size:    int64(len(blob.Binary)),
+		expires: time.Now().Add(selfUploadTTL),
+	}
+	oc.uploadsLock.Lock()
+	oc.addUpload(upload)
+	oc.uploadsLock.Unlock()
+
+	fileID, err := oc.uploadGroupFile(targetID, binary, blob.Name, oc.getUploadFolder(targetID))
+
+	oc.uploadsLock.Lock()
+	defer oc.uploadsLock.Unlock()
+
+	if err != nil {
+		oc.uploads = slices.DeleteFunc(oc.uploads, func(u *pendingUpload) bool { return u == upload })
+		return nil, err
+	}
+	if upload.notice {
+		return result(upload.fileID), nil
+	}
+	if fileID != "" || done == nil {
+		// keep until notice to not echo it back
+		upload.fileID = fileID
+		return result(fileID), nil
+	}
+
+	// the uploaded file id is only available from group upload notice
+	upload.done = func(fileID string) {
+		done(result(fileID), nil)
+	}
+	time.AfterFunc(uploadNoticeTimeout, func() {
+		oc.uploadsLock.Lock()
+		report := upload.done
+		upload.done = nil
+		oc.uploadsLock.Unlock()
+
+		if report != nil {
+			log.Warnf("OnebotClient(%s) upload notice of %s in group %d not received", oc.vendor, upload.name, upload.groupID)
+			report("")
+		}
+	})
+
+	return nil, nil
+}
+
+// resolve configured folder name to folder id
+func (oc *OnebotClient) getUploadFolder(groupID int64) string {
+	folder, ok := oc.config.Service.UploadFolders[common.Itoa(groupID)]
+	if !ok || folder == "" || folder == "/" {
+		return ""
+	}
+
+	resp, err := oc.request(onebot.NewGetGroupRootFilesRequest(groupID))
+	if err != nil {
+		log.Warnf("Failed to get root files of group %d: %v", groupID, err)
+		return folder
+	}
+
+	var files struct {
+		Folders []*onebot.FolderInfo `mapstructure:"folders"`
+	}
+	if err := mapstructure.WeakDecode(resp, &files); err != nil {
+		log.Warnf("Failed to decode root files of group %d: %v", groupID, err)
+		return folder
+	}
+	for _, f := range files.Folders {
+		if f.Name == folder || f.ID == folder {
+			return f.ID
+		}
+	}
+
+	log.Warnf("Folder %s not found in group %d, upload to root", folder, groupID)
+	return ""
+}
+
+// remember own upload, forget expired ones.
+// must be called with uploadsLock held
+func (oc *OnebotClient) addUpload(upload *pendingUpload) {
+	now := time.Now()
+	oc.uploads = slices.DeleteFunc(oc.uploads, func(u *pendingUpload) bool {
+		return u.expires.Before(now)
+	})
+	oc.uploads = append(oc.uploads, upload)
+}
+
+// take own upload of notice, by file id if known, otherwise the oldest one of same file.
+// must be called with uploadsLock held
+func (oc *OnebotClient) takeUpload(groupID int64, file *onebot.FileInfo) *pendingUpload {
+	now := time.Now()
+	idx := slices.IndexFunc(oc.uploads, func(u *pendingUpload) bool {
+		return file.ID != "" && u.fileID == file.ID
+	})
+	if idx < 0 {
+		idx = slices.IndexFunc(oc.uploads, func(u *pendingUpload) bool {
+			return u.fileID == "" && !u.expires.Before(now) &&
+				u.groupID == groupID && u.name == file.Name &&
+				(file.Size == 0 || u.size == file.Size)
+		})
+	}
+	if idx < 0 {
+		return nil
+	}
+
+	upload := oc.uploads[idx]
+	oc.uploads = slices.Delete(oc.uploads, idx, idx+1)
+	return upload
+}
+
+// send merged forward message
+func (oc *OnebotClient) sendForward(targetID int64, event *common.OctopusEvent) (*common.OctopusEvent, error) {
+	forward := event.Data.(*common.ForwardData)
+
+	nodes := []onebot.ISegment{}
+	for _, message := range forward.Messages {
+		message.Vendor = event.Vendor
+		message.Chat = event.Chat
+		message.Reply = nil
+		message = oc.m2s.Apply(message)
+
+		segments, err := oc.convertSegments(message)
+		if err != nil {
+			log.Warnf("Failed to convert forward message: %v", err)
+			segments = []onebot.ISegment{onebot.NewText(fmt.Sprintf("[%s]", message.Type))}
+		} else if len(segments) == 0 {
+			continue
+		}
+
+		nodes = append(nodes, onebot.NewCustomNode(
+			cmp.Or(message.From.Remark, message.From.Username, message.From.ID),
+			cmp.Or(message.From.ID, oc.vendor.UID),
+			message.Timestamp,
+			segments,
+		))
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("empty forward message")
+	}
+
 	var request *onebot.Request
 	if event.Chat.Type == "private" {
-		request = onebot.NewPrivateMsgRequest(targetID, segments)
+		request = onebot.NewPrivateForwardMsgRequest(targetID, nodes)
 	} else {
-		request = onebot.NewGroupMsgRequest(targetID, segments)
+		request = onebot.NewGroupForwardMsgRequest(targetID, nodes)
 	}
 
-	if messageID, err := oc.sendMsg(request); err != nil {
+	resp, err := oc.request(request)
+	if err != nil {
 		return nil, err
-	} else {
-		return &common.OctopusEvent{
-			ID:        common.Itoa(messageID),
-			Timestamp: time.Now().Unix(),
-		}, nil
 	}
+
+	// some implementations only return forward id
+	var id string
+	if data, ok := resp.(map[string]interface{}); ok {
+		if messageID, ok := data["message_id"].(float64); ok {
+			id = common.Itoa(int64(messageID))
+		} else if forwardID, ok := data["forward_id"].(string); ok {
+			id = forwardID
+		}
+	}
+
+	return &common.OctopusEvent{
+		ID:        id,
+		Timestamp: time.Now().Unix(),
+	}, nil
 }
 
 func (oc *OnebotClient) Dispose() {
@@ -225,7 +499,7 @@ func (oc *OnebotClient) Dispose() {
 }
 
 func (oc *OnebotClient) processResponse(resp *onebot.Response) {
-	log.Debugf("Receive response: %+v", resp)
+	log.Debugf("Receive response #%s: %s %d", resp.Echo, resp.Status, resp.Retcode)
 	oc.websocketRequestsLock.RLock()
 	respChan, ok := oc.websocketRequests[resp.Echo]
 	oc.websocketRequestsLock.RUnlock()
@@ -241,7 +515,7 @@ func (oc *OnebotClient) processResponse(resp *onebot.Response) {
 }
 
 func (oc *OnebotClient) processEvent(event onebot.IEvent) {
-	log.Debugf("Receive event: %+v", event)
+	log.Debugf("Receive event: %s", event.EventType())
 
 	key := oc.getEventKey(event)
 	oc.mutex.LockKey(key)
@@ -262,6 +536,13 @@ func (oc *OnebotClient) processEvent(event onebot.IEvent) {
 		oc.processGroupRecall(event.(*onebot.GroupRecall))
 	case onebot.NoticeFriendRecall:
 		oc.processFriendRecall(event.(*onebot.FriendRecall))
+	case onebot.NoticeGroupIncrease, onebot.NoticeGroupDecrease, onebot.NoticeGroupBan, onebot.NoticeGroupCard,
+		onebot.NoticeGroupAdmin, onebot.NoticeNotify, onebot.NoticeLuckyKing, onebot.NoticeHonnor:
+		oc.processGroupNotice(event.(*onebot.GroupNotice))
+	case onebot.RequestFriend:
+		oc.processFriendRequest(event.(*onebot.FriendRequest))
+	case onebot.RequestGroup:
+		oc.processGroupRequest(event.(*onebot.GroupRequest))
 	case onebot.MetaHeartbeat:
 		log.Debugf("Receive heartbeat: %+v", event.(*onebot.Heartbeat).Status)
 	}
@@ -286,6 +567,17 @@ func (oc *OnebotClient) getEventKey(event onebot.IEvent) string {
 		return common.Itoa(event.(*onebot.GroupRecall).GroupID)
 	case onebot.NoticeFriendRecall:
 		return common.Itoa(event.(*onebot.FriendRecall).UserID)
+	case onebot.NoticeGroupIncrease, onebot.NoticeGroupDecrease, onebot.NoticeGroupBan, onebot.NoticeGroupCard,
+		onebot.NoticeGroupAdmin, onebot.NoticeNotify, onebot.NoticeLuckyKing, onebot.NoticeHonnor:
+		n := event.(*onebot.GroupNotice)
+		if n.GroupID == 0 {
+			return common.Itoa(n.UserID)
+		}
+		return common.Itoa(n.GroupID)
+	case onebot.RequestFriend:
+		return common.Itoa(event.(*onebot.FriendRequest).UserID)
+	case onebot.RequestGroup:
+		return common.Itoa(event.(*onebot.GroupRequest).GroupID)
 	}
 
 	return ""
@@ -340,6 +632,11 @@ func (oc *OnebotClient) processGroupMessage(m *onebot.Message) {
 		Username: m.Sender.Nickname,
 		Remark:   m.Sender.Card,
 	}
+	if event.From.Remark == "" {
+		if member, err := oc.getMember(m.GroupID, m.Sender.UserID); err == nil {
+			event.From.Remark = member.Card
+		}
+	}
 	event.Chat = common.Chat{
 		Type:  "group",
 		ID:    common.Itoa(m.GroupID),
@@ -376,10 +673,11 @@ func (oc *OnebotClient) processMessage(event *common.OctopusEvent, segments []on
 
 			groupID, _ := common.Atoi(event.Chat.ID)
 			memberID, _ := common.Atoi(v.Target())
-			if member, err := oc.getGroupMemberInfo(groupID, memberID, false); err == nil {
+			if member, err := oc.getMember(groupID, memberID); err == nil {
 				targetName = cmp.Or(member.Card, member.Nickname)
 			}
 			summary = append(summary, fmt.Sprintf("@%s ", targetName))
+			event.Mentions = append(event.Mentions, v.Target())
 		case *onebot.ImageSegment:
 			summary = append(summary, "[图片]")
 			if v.URL() == "" {
@@ -547,8 +845,30 @@ func (oc *OnebotClient) processOfflineFile(m *onebot.OfflineFile) {
 }
 
 func (oc *OnebotClient) processGroupUpload(m *onebot.OfflineFile) {
-	// FIXME: can't get message id
-	event := oc.generateEvent(fmt.Sprint(time.Now().Unix()), time.Now().UnixMilli())
+	// file uploaded by ourselves from Telegram
+	if oc.self != nil && m.UserID == oc.self.ID {
+		oc.uploadsLock.Lock()
+		upload := oc.takeUpload(m.GroupID, &m.File)
+		var report func(string)
+		if upload != nil {
+			upload.notice = true
+			upload.fileID = cmp.Or(upload.fileID, m.File.ID)
+			report = upload.done
+			upload.done = nil
+		}
+		oc.uploadsLock.Unlock()
+
+		if report != nil {
+			report(m.File.ID)
+		}
+		// sendFile may have returned already, don't echo it back
+		if upload != nil {
+			return
+		}
+	}
+
+	// use file id as message id
+	event := oc.generateEvent(cmp.Or(m.File.ID, fmt.Sprint(time.Now().Unix())), time.Now().UnixMilli())
 
 	groupName := common.Itoa(m.GroupID)
 	if group, ok := oc.groups[m.GroupID]; ok {
@@ -556,7 +876,7 @@ func (oc *OnebotClient) processGroupUpload(m *onebot.OfflineFile) {
 	}
 
 	targetName := common.Itoa(m.UserID)
-	if member, err := oc.getGroupMemberInfo(m.GroupID, m.UserID, false); err == nil {
+	if member, err := oc.getMember(m.GroupID, m.UserID); err == nil {
 		targetName = cmp.Or(member.Card, member.Nickname)
 	}
 
@@ -592,7 +912,7 @@ func (oc *OnebotClient) processGroupRecall(m *onebot.GroupRecall) {
 	}
 
 	targetName := common.Itoa(m.OperatorID)
-	if member, err := oc.getGroupMemberInfo(m.GroupID, m.OperatorID, false); err == nil {
+	if member, err := oc.getMember(m.GroupID, m.OperatorID); err == nil {
 		targetName = cmp.Or(member.Card, member.Nickname)
 	}
 
@@ -656,6 +976,358 @@ func (oc *OnebotClient) processFriendRecall(m *onebot.FriendRecall) {
 	oc.pushEvent(event)
 }
 
+func (oc *OnebotClient) processGroupNotice(m *onebot.GroupNotice) {
+	event := oc.generateEvent(fmt.Sprint(time.Now().Unix()), time.Now().UnixMilli())
+
+	notice := &common.NoticeData{
+		SubType: m.SubType,
+	}
+
+	switch m.EventType() {
+	case onebot.NoticeGroupIncrease:
+		notice.Type = common.NoticeGroupIncrease
+		if member, err := oc.getGroupMemberInfo(m.GroupID, m.UserID, true); err == nil {
+			oc.members.Put(m.GroupID, member)
+		}
+		notice.Target = oc.resolveUser(m.GroupID, m.UserID)
+		notice.Operator = oc.resolveUser(m.GroupID, m.OperatorID)
+	case onebot.NoticeGroupDecrease:
+		notice.Type = common.NoticeGroupDecrease
+		notice.Target = oc.resolveUser(m.GroupID, m.UserID)
+		notice.Operator = oc.resolveUser(m.GroupID, m.OperatorID)
+		if m.SubType == "kick_me" || (oc.self != nil && m.UserID == oc.self.ID) {
+			oc.members.Evict(m.GroupID)
+		} else {
+			oc.members.Remove(m.GroupID, m.UserID)
+		}
+	case onebot.NoticeGroupBan:
+		notice.Type = common.NoticeGroupBan
+		notice.Target = oc.resolveUser(m.GroupID, m.UserID)
+		notice.Operator = oc.resolveUser(m.GroupID, m.OperatorID)
+		notice.Duration = m.Duration
+	case onebot.NoticeGroupAdmin:
+		notice.Type = common.NoticeGroupAdmin
+		notice.Target = oc.resolveUser(m.GroupID, m.UserID)
+	case onebot.NoticeGroupCard:
+		if m.CardNew == m.CardOld {
+			return
+		}
+		notice.Type = common.NoticeGroupCard
+		if notice.Target = oc.resolveUser(m.GroupID, m.UserID); notice.Target == nil {
+			return
+		}
+		notice.Target.Remark = m.CardOld
+		notice.Card = m.CardNew
+		if member, ok := oc.members.Peek(m.GroupID, m.UserID); ok {
+			renamed := *member
+			renamed.Card = m.CardNew
+			oc.members.Put(m.GroupID, &renamed)
+		}
+	case onebot.NoticeLuckyKing:
+		notice.Type = common.NoticeLuckyKing
+		notice.Target = oc.resolveUser(m.GroupID, m.TargetID)
+		notice.Operator = oc.resolveUser(m.GroupID, m.UserID)
+	case onebot.NoticeHonnor:
+		notice.Type = common.NoticeHonor
+		notice.Target = oc.resolveUser(m.GroupID, m.UserID)
+		notice.Honor = m.HonorType
+	default:
+		if m.SubType != "poke" {
+			log.Debugf("Notify %s not support", m.SubType)
+			return
+		}
+		notice.Type = common.NoticePoke
+		notice.Target = oc.resolveUser(m.GroupID, m.TargetID)
+		notice.Operator = oc.resolveUser(m.GroupID, m.UserID)
+	}
+
+	if notice.Operator != nil {
+		event.From = *notice.Operator
+	} else if notice.Target != nil {
+		event.From = *notice.Target
+	}
+
+	if m.GroupID == 0 {
+		targetID := m.UserID
+		if oc.self != nil && targetID == oc.self.ID {
+			targetID = m.TargetID
+		}
+		targetName := common.Itoa(targetID)
+		if target, ok := oc.friends[targetID]; ok {
+			targetName = cmp.Or(target.Remark, target.Nickname)
+		}
+		event.Chat = common.Chat{
+			Type:  "private",
+			ID:    common.Itoa(targetID),
+			Title: targetName,
+		}
+	} else {
+		event.Chat = oc.groupChat(m.GroupID)
+	}
+
+	event.Type = common.EventNotice
+	event.Data = notice
+
+	oc.pushEvent(event)
+}
+
+func (oc *OnebotClient) groupChat(groupID int64) common.Chat {
+	groupName := common.Itoa(groupID)
+	if group, ok := oc.groups[groupID]; ok {
+		groupName = group.Name
+	}
+	return common.Chat{
+		Type:  "group",
+		ID:    common.Itoa(groupID),
+		Title: groupName,
+	}
+}
+
+// notify members joined, left or renamed without notice, found by refreshing member list
+func (oc *OnebotClient) notifyMemberChanges(groupID int64, changes []memberChange) {
+	if len(changes) > maxMemberChanges {
+		log.Infof("OnebotClient(%s) %d members of group %d changed since last refresh", oc.vendor, len(changes), groupID)
+		return
+	}
+
+	for _, c := range changes {
+		notice := &common.NoticeData{}
+		switch {
+		case c.before == nil:
+			notice.Type = common.NoticeGroupIncrease
+			notice.Target = memberUser(c.after)
+		case c.after == nil:
+			notice.Type = common.NoticeGroupDecrease
+			notice.SubType = "leave"
+			notice.Target = memberUser(c.before)
+		default:
+			notice.Type = common.NoticeGroupCard
+			notice.Target = memberUser(c.before)
+			notice.Card = c.after.Card
+		}
+
+		event := oc.generateEvent(fmt.Sprint(time.Now().Unix()), time.Now().UnixMilli())
+		event.From = *notice.Target
+		event.Chat = oc.groupChat(groupID)
+		event.Type = common.EventNotice
+		event.Data = notice
+
+		oc.pushEvent(event)
+	}
+}
+
+func memberUser(member *onebot.Sender) *common.User {
+	return &common.User{
+		ID:       common.Itoa(member.UserID),
+		Username: cmp.Or(member.Nickname, common.Itoa(member.UserID)),
+		Remark:   member.Card,
+	}
+}
+
+// resolve user name by group member card, friend remark or stranger nickname
+func (oc *OnebotClient) resolveUser(groupID, userID int64) *common.User {
+	if userID == 0 {
+		return nil
+	}
+
+	user := &common.User{
+		ID:       common.Itoa(userID),
+		Username: common.Itoa(userID),
+	}
+
+	if groupID != 0 {
+		if member, err := oc.getMember(groupID, userID); err == nil {
+			user.Username = cmp.Or(member.Nickname, user.Username)
+			user.Remark = member.Card
+			return user
+		}
+	}
+
+	if friend, ok := oc.friends[userID]; ok {
+		user.Username = cmp.Or(friend.Nickname, user.Username)
+		user.Remark = friend.Remark
+	} else if info, err := oc.getStrangerInfo(userID); err == nil {
+		user.Username = cmp.Or(info.Nickname, user.Username)
+	}
+
+	return user
+}
+
+func (oc *OnebotClient) processFriendRequest(m *onebot.FriendRequest) {
+	event := oc.generateEvent(fmt.Sprint(time.Now().Unix()), time.Now().UnixMilli())
+
+	request := &common.RequestData{
+		Type:     "friend",
+		SubType:  "add",
+		Flag:     m.Flag,
+		UserID:   common.Itoa(m.UserID),
+		Nickname: common.Itoa(m.UserID),
+		Comment:  m.Comment,
+	}
+	oc.fillRequestProfile(request, m.UserID)
+
+	event.From = common.User{
+		ID:       request.UserID,
+		Username: request.Nickname,
+		Remark:   request.Nickname,
+	}
+	event.Chat = common.Chat{
+		Type:  "private",
+		ID:    request.UserID,
+		Title: request.Nickname,
+	}
+
+	event.Type = common.EventRequest
+	event.Data = request
+
+	oc.pushEvent(event)
+}
+
+func (oc *OnebotClient) processGroupRequest(m *onebot.GroupRequest) {
+	event := oc.generateEvent(fmt.Sprint(time.Now().Unix()), time.Now().UnixMilli())
+
+	groupName := common.Itoa(m.GroupID)
+	if group, ok := oc.groups[m.GroupID]; ok {
+		groupName = group.Name
+	}
+
+	request := &common.RequestData{
+		Type:      "group",
+		SubType:   m.SubType,
+		Flag:      m.Flag,
+		UserID:    common.Itoa(m.UserID),
+		Nickname:  common.Itoa(m.UserID),
+		GroupID:   common.Itoa(m.GroupID),
+		GroupName: groupName,
+		Comment:   m.Comment,
+	}
+	oc.fillRequestProfile(request, m.UserID)
+
+	event.From = common.User{
+		ID:       request.UserID,
+		Username: request.Nickname,
+		Remark:   request.Nickname,
+	}
+	event.Chat = common.Chat{
+		Type:  "group",
+		ID:    request.GroupID,
+		Title: groupName,
+	}
+
+	event.Type = common.EventRequest
+	event.Data = request
+
+	oc.pushEvent(event)
+}
+
+func (oc *OnebotClient) fillRequestProfile(request *common.RequestData, userID int64) {
+	if info, err := oc.getStrangerInfo(userID); err != nil {
+		log.Warnf("Failed to get stranger info of %d: %v", userID, err)
+	} else {
+		request.Nickname = cmp.Or(info.Nickname, request.Nickname)
+		request.Sex = info.Sex
+		request.Age = int(info.Age)
+	}
+}
+
+// approve or reject friend/group request
+func (oc *OnebotClient) setAddRequest(event *common.OctopusEvent) (*common.OctopusEvent, error) {
+	request := event.Data.(*common.RequestData)
+	approve := request.Decision == "approve"
+
+	var err error
+	if request.Type == "friend" {
+		_, err = oc.request(onebot.NewSetFriendAddRequest(request.Flag, approve, ""))
+	} else {
+		_, err = oc.request(onebot.NewSetGroupAddRequest(request.Flag, request.SubType, approve, request.Reason))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &common.OctopusEvent{
+		ID:        request.Flag,
+		Timestamp: time.Now().Unix(),
+	}, nil
+}
+
+func (oc *OnebotClient) getStrangerInfo(userID int64) (*onebot.StrangerInfo, error) {
+	resp, err := oc.request(onebot.NewGetStrangerInfoRequest(userID, false))
+	if err == nil {
+		var info onebot.StrangerInfo
+		err = mapstructure.WeakDecode(resp, &info)
+		return &info, err
+	}
+
+	return nil, err
+}
+
+// get group member from cache, refresh member list if expired.
+// master never asks for members, names of senders, mentions and notices sent to it are all resolved here
+func (oc *OnebotClient) getMember(groupID, userID int64) (*onebot.Sender, error) {
+	if oc.members.IsAbsent(groupID, userID) {
+		return nil, errMemberAbsent
+	}
+	if member, ok := oc.members.Get(groupID, userID); ok {
+		return member, nil
+	}
+
+	key := common.Itoa(groupID)
+	oc.membersMutex.LockKey(key)
+	defer oc.membersMutex.UnlockKey(key)
+
+	if !oc.members.IsFresh(groupID) {
+		if err := oc.refreshMembers(groupID); err != nil {
+			log.Warnf("Failed to refresh members of group %d: %v", groupID, err)
+		}
+	}
+	if member, ok := oc.members.Peek(groupID, userID); ok {
+		return member, nil
+	}
+
+	if oc.members.IsAbsent(groupID, userID) {
+		return nil, errMemberAbsent
+	}
+
+	member, err := oc.getGroupMemberInfo(groupID, userID, false)
+	if err == nil {
+		oc.members.Put(groupID, member)
+	} else if errors.Is(err, errMemberAbsent) {
+		oc.members.PutAbsent(groupID, userID)
+	}
+	return member, err
+}
+
+func (oc *OnebotClient) refreshMembers(groupID int64) error {
+	resp, err := oc.request(onebot.NewGetGroupMemberListRequest(groupID))
+	if err != nil {
+		return err
+	}
+
+	list, ok := resp.([]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected member list response: %T", resp)
+	}
+
+	members := []*onebot.Sender{}
+	for _, member := range list {
+		var s onebot.Sender
+		if err := mapstructure.WeakDecode(member, &s); err != nil {
+			continue
+		}
+		members = append(members, &s)
+	}
+	changes := oc.members.Fill(groupID, members)
+
+	hits, misses := oc.members.Stats()
+	log.Infof("OnebotClient(%s) refreshed %d members of group %d, cache hits: %d, misses: %d",
+		oc.vendor, len(members), groupID, hits, misses)
+
+	oc.notifyMemberChanges(groupID, changes)
+
+	return nil
+}
+
 func (oc *OnebotClient) getGroupMemberInfo(groupID, userID int64, noCache bool) (*onebot.Sender, error) {
 	resp, err := oc.request(onebot.NewGetGroupMemberInfoRequest(groupID, userID, noCache))
 	if err == nil {
@@ -664,9 +1336,24 @@ func (oc *OnebotClient) getGroupMemberInfo(groupID, userID int64, noCache bool)
 		return &s, err
 	}
 
+	if memberNotFound(resp) {
+		return nil, errMemberAbsent
+	}
 	return nil, err
 }
 
+// whether failed response tells user is not a member, other failures may be transient
+func memberNotFound(resp any) bool {
+	r, ok := resp.(*onebot.Response)
+	if !ok {
+		return false
+	}
+
+	// e.g. go-cqhttp answers MEMBER_NOT_FOUND / 群员不存在
+	text := strings.ToLower(r.Message + " " + r.Wording)
+	return strings.Contains(text, "not_found") || strings.Contains(text, "not found") || strings.Contains(text, "不存在")
+}
+
 func (oc *OnebotClient) getMedia(t onebot.RequestType, file string) (*common.BlobData, error) {
 	var request *onebot.Request
 	switch t {
@@ -760,16 +1447,31 @@ func (oc *OnebotClient) sendMsg(request *onebot.Request) (int64, error) {
 	return 0, err
 }
 
-// Lagrange.OneBot
-func (oc *OnebotClient) uploadPrivateFile(userID int64, file string, name string) error {
-	_, err := oc.request(onebot.NewUploadPrivateFileRequest(userID, file, name))
-	return err
+// Lagrange.OneBot, return file id if provided
+func (oc *OnebotClient) uploadPrivateFile(userID int64, file string, name string) (string, error) {
+	resp, err := oc.request(onebot.NewUploadPrivateFileRequest(userID, file, name))
+	if err != nil {
+		return "", err
+	}
+	return getFileID(resp), nil
 }
 
-// Lagrange.OneBot
-func (oc *OnebotClient) uploadGroupFile(groupID int64, file string, name string) error {
-	_, err := oc.request(onebot.NewUploadGroupFileRequest(groupID, file, name))
-	return err
+// Lagrange.OneBot, return file id if provided
+func (oc *OnebotClient) uploadGroupFile(groupID int64, file string, name string, folder string) (string, error) {
+	resp, err := oc.request(onebot.NewUploadGroupFileRequest(groupID, file, name, folder))
+	if err != nil {
+		return "", err
+	}
+	return getFileID(resp), nil
+}
+
+func getFileID(resp any) string {
+	if data, ok := resp.(map[string]interface{}); ok {
+		if id, ok := data["file_id"]; ok && id != nil {
+			return fmt.Sprint(id)
+		}
+	}
+	return ""
 }
 
 func (oc *OnebotClient) convertForward(id string) *common.AppData {
@@ -855,6 +1557,7 @@ func (oc *OnebotClient) convertForward(id string) *common.AppData {
 }
 
 func (oc *OnebotClient) updateChats() {
+	// incomplete chat list will be treated as removal by master, skip sync on failure
 	if resp, err := oc.request(onebot.NewGetFriendListRequest()); err == nil {
 		friends := map[int64]*onebot.FriendInfo{}
 
@@ -867,6 +1570,9 @@ func (oc *OnebotClient) updateChats() {
 		}
 
 		oc.friends = friends
+	} else {
+		log.Warnf("OnebotClient(%s) failed to get friend list: %v", oc.vendor, err)
+		return
 	}
 
 	if resp, err := oc.request(onebot.NewGetLoginInfoRequest()); err == nil {
@@ -889,6 +1595,9 @@ func (oc *OnebotClient) updateChats() {
 		}
 
 		oc.groups = groups
+	} else {
+		log.Warnf("OnebotClient(%s) failed to get group list: %v", oc.vendor, err)
+		return
 	}
 
 	// Sync chats
@@ -926,7 +1635,9 @@ func (oc *OnebotClient) generateEvent(id string, ts int64) *common.OctopusEvent
 }
 
 func (oc *OnebotClient) pushEvent(event *common.OctopusEvent) {
-	event = oc.s2m.Apply(event)
+	if event = oc.s2m.Apply(event); event == nil {
+		return
+	}
 
 	oc.out <- event
 }
@@ -942,7 +1653,7 @@ func (oc *OnebotClient) request(req *onebot.Request) (any, error) {
 	oc.addWebsocketResponseWaiter(req.Echo, respChan)
 	defer oc.removeWebsocketResponseWaiter(req.Echo, respChan)
 
-	log.Debugf("Send request message #%s %s %+v", req.Echo, req.Action, req)
+	log.Debugf("Send request message #%s %s", req.Echo, req.Action)
 	if err := oc.sendMessage(req); err != nil {
 		return nil, err
 	}
@@ -976,6 +1687,7 @@ func (oc *OnebotClient) addWebsocketResponseWaiter(echo string, waiter chan<- *o
 	oc.websocketRequestsLock.Lock()
 	oc.websocketRequests[echo] = waiter
 	oc.websocketRequestsLock.Unlock()
+	metrics.WebsocketPendingRequests.WithLabelValues(oc.Vendor()).Inc()
 }
 
 func (oc *OnebotClient) removeWebsocketResponseWaiter(echo string, waiter chan<- *onebot.Response) {
@@ -985,5 +1697,6 @@ func (oc *OnebotClient) removeWebsocketResponseWaiter(echo string, waiter chan<-
 		delete(oc.websocketRequests, echo)
 	}
 	oc.websocketRequestsLock.Unlock()
+	metrics.WebsocketPendingRequests.WithLabelValues(oc.Vendor()).Dec()
 	close(waiter)
 }
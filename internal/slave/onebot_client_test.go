@@ -0,0 +1,265 @@
+package slave
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+
+	"github.com/gorilla/websocket"
+)
+
+const fakeOnebotSelf = 10001
+
+type fakeAction struct {
+	action string
+	params map[string]any
+}
+
+// fakeOnebot answers api requests of a OnebotClient over reverse websocket
+type fakeOnebot struct {
+	t    *testing.T
+	conn *websocket.Conn
+
+	// data of api responses by action, ok with empty data if missing
+	responses map[string]any
+	// failed responses by action, with retcode and message
+	failures map[string]map[string]any
+
+	writeLock   sync.Mutex
+	actionsLock sync.Mutex
+	actions     []*fakeAction
+}
+
+func newFakeOnebot(t *testing.T, agent string, out chan<- *common.OctopusEvent) (*OnebotClient, *fakeOnebot) {
+	t.Helper()
+
+	config := &common.Configure{}
+	config.Service.SendTiemout = 5 * time.Second
+	config.Service.MemberTTL = time.Minute
+
+	clients := make(chan *OnebotClient, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		oc := NewOnebotClient(&common.Vendor{Type: "qq", UID: common.Itoa(fakeOnebotSelf)}, agent, config, conn, out)
+		clients <- oc
+		oc.run(func() {})
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	fo := &fakeOnebot{
+		t:    t,
+		conn: conn,
+		responses: map[string]any{
+			"get_friend_list": []any{map[string]any{"user_id": 20002, "nickname": "Bob"}},
+			"get_login_info":  map[string]any{"user_id": fakeOnebotSelf, "nickname": "Octopus"},
+			"get_group_list":  []any{map[string]any{"group_id": 30003, "group_name": "Group"}},
+		},
+		failures: map[string]map[string]any{},
+	}
+	go fo.serve()
+
+	return <-clients, fo
+}
+
+func (fo *fakeOnebot) serve() {
+	for {
+		var req struct {
+			Action string         `json:"action"`
+			Params map[string]any `json:"params"`
+			Echo   string         `json:"echo"`
+		}
+		if err := fo.conn.ReadJSON(&req); err != nil {
+			return
+		}
+
+		fo.actionsLock.Lock()
+		fo.actions = append(fo.actions, &fakeAction{action: req.Action, params: req.Params})
+		data := fo.responses[req.Action]
+		failure, failed := fo.failures[req.Action]
+		fo.actionsLock.Unlock()
+
+		if failed {
+			resp := map[string]any{"status": "failed", "data": nil, "echo": req.Echo}
+			for k, v := range failure {
+				resp[k] = v
+			}
+			fo.send(resp)
+			continue
+		}
+		fo.send(map[string]any{"status": "ok", "retcode": 0, "data": data, "echo": req.Echo})
+	}
+}
+
+func (fo *fakeOnebot) send(v any) {
+	fo.writeLock.Lock()
+	defer fo.writeLock.Unlock()
+	if err := fo.conn.WriteJSON(v); err != nil {
+		fo.t.Errorf("write: %v", err)
+	}
+}
+
+func (fo *fakeOnebot) actionsOf(action string) []*fakeAction {
+	fo.actionsLock.Lock()
+	defer fo.actionsLock.Unlock()
+
+	var actions []*fakeAction
+	for _, a := range fo.actions {
+		if a.action == action {
+			actions = append(actions, a)
+		}
+	}
+	return actions
+}
+
+func TestOnebotClientSync(t *testing.T) {
+	out := make(chan *common.OctopusEvent, 16)
+	oc, fo := newFakeOnebot(t, "", out)
+
+	// /sync sends event without chat
+	resp, err := oc.SendEvent(&common.OctopusEvent{
+		Vendor: *oc.vendor,
+		ID:     "sync",
+		Type:   common.EventSync,
+	})
+	if err != nil {
+		t.Fatalf("send sync: %v", err)
+	}
+	if resp.ID != "sync" {
+		t.Errorf("sync response = %+v", resp)
+	}
+
+	sync := waitEvent(t, out, common.EventSync)
+	chats := sync.Data.([]*common.Chat)
+	if len(chats) != 3 {
+		t.Errorf("synced chats = %+v", chats)
+	}
+	if len(fo.actionsOf("get_group_list")) != 1 {
+		t.Error("group list not requested")
+	}
+}
+
+func TestOnebotClientGroupUpload(t *testing.T) {
+	out := make(chan *common.OctopusEvent, 16)
+	oc, fo := newFakeOnebot(t, NAPCAT_ONEBOT+"/4.0", out)
+
+	// learn own account from login info
+	oc.SendEvent(&common.OctopusEvent{Vendor: *oc.vendor, Type: common.EventSync})
+	waitEvent(t, out, common.EventSync)
+
+	// file id of group upload only comes with notice
+	fo.actionsLock.Lock()
+	fo.responses["upload_group_file"] = nil
+	fo.actionsLock.Unlock()
+
+	// same file uploaded twice at once
+	results := make(chan *common.OctopusEvent, 2)
+	for i := 0; i < 2; i++ {
+		returned := make(chan struct{})
+		go func() {
+			oc.SendEventAsync(&common.OctopusEvent{
+				Vendor: *oc.vendor,
+				Chat:   common.Chat{ID: "30003", Type: "group"},
+				Type:   common.EventFile,
+				Data:   &common.BlobData{Name: "a.txt", Binary: []byte("hello")},
+			}, func(resp *common.OctopusEvent, err error) {
+				if err != nil {
+					t.Errorf("upload: %v", err)
+				}
+				results <- resp
+			})
+			close(returned)
+		}()
+		select {
+		case <-returned:
+		case <-time.After(time.Second):
+			t.Fatal("sending blocked until upload notice")
+		}
+	}
+	if uploads := fo.actionsOf("upload_group_file"); len(uploads) != 2 {
+		t.Fatalf("upload requests = %d", len(uploads))
+	}
+
+	for _, id := range []string{"f1", "f2"} {
+		fo.send(map[string]any{
+			"post_type":   "notice",
+			"notice_type": "group_upload",
+			"time":        time.Now().Unix(),
+			"self_id":     fakeOnebotSelf,
+			"group_id":    30003,
+			"user_id":     fakeOnebotSelf,
+			"file":        map[string]any{"id": id, "name": "a.txt", "size": 5, "busid": 102},
+		})
+	}
+
+	ids := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case resp := <-results:
+			ids[resp.ID] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("upload result not reported")
+		}
+	}
+	if !ids["f1"] || !ids["f2"] {
+		t.Errorf("upload results = %v", ids)
+	}
+
+	// own uploads are not echoed back
+	select {
+	case event := <-out:
+		t.Errorf("unexpected event %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestOnebotClientMemberAbsent(t *testing.T) {
+	out := make(chan *common.OctopusEvent, 16)
+	oc, fo := newFakeOnebot(t, "", out)
+
+	fo.actionsLock.Lock()
+	fo.responses["get_group_member_list"] = []any{map[string]any{"group_id": 30003, "user_id": 20002, "nickname": "Bob"}}
+	fo.failures["get_group_member_info"] = map[string]any{"retcode": 200, "message": "timeout"}
+	fo.actionsLock.Unlock()
+
+	if member, err := oc.getMember(30003, 20002); err != nil || member.Nickname != "Bob" {
+		t.Fatalf("listed member = %+v, %v", member, err)
+	}
+
+	// transient failure is asked again
+	if _, err := oc.getMember(30003, 40004); err == nil || errors.Is(err, errMemberAbsent) {
+		t.Errorf("failed lookup error = %v", err)
+	}
+	if oc.members.IsAbsent(30003, 40004) {
+		t.Error("failed lookup cached as absent")
+	}
+
+	fo.actionsLock.Lock()
+	fo.failures["get_group_member_info"] = map[string]any{"retcode": 100, "message": "MEMBER_NOT_FOUND", "wording": "群员不存在"}
+	fo.actionsLock.Unlock()
+
+	if _, err := oc.getMember(30003, 40004); !errors.Is(err, errMemberAbsent) {
+		t.Errorf("not found lookup error = %v", err)
+	}
+	if _, err := oc.getMember(30003, 40004); !errors.Is(err, errMemberAbsent) {
+		t.Errorf("cached absent lookup error = %v", err)
+	}
+	if infos := fo.actionsOf("get_group_member_info"); len(infos) != 2 {
+		t.Errorf("member info requests = %d", len(infos))
+	}
+}
@@ -0,0 +1,69 @@
+package slave
+
+import (
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const replayBatchSize = 100
+
+// SetCallbackRestorer re-create callbacks of replayed events, must be called before Start
+func (ls *LimbService) SetCallbackRestorer(restore func(*common.OctopusEvent)) {
+	ls.restoreCallback = restore
+}
+
+// add connected client, and send events of it left undelivered on last shutdown before new ones
+func (ls *LimbService) register(vendor string, client Client) {
+	replayed := make(chan struct{})
+	ls.clientsLock.Lock()
+	ls.clients[vendor] = client
+	ls.replays[vendor] = replayed
+	ls.clientsLock.Unlock()
+
+	go func() {
+		defer close(replayed)
+		ls.replayPending(vendor, client)
+	}()
+}
+
+func (ls *LimbService) replayPending(vendor string, client Client) {
+	replayed := 0
+	for {
+		queued, err := manager.GetQueuedEvents(manager.QueueShutdownOut, vendor, replayBatchSize)
+		if err != nil {
+			log.Warnf("Failed to get undelivered events of %s: %v", vendor, err)
+			return
+		}
+		if len(queued) == 0 {
+			break
+		}
+
+		// removed once handed to client, a crash in between sends it again
+		for _, q := range queued {
+			if event, err := common.DecodeEvent(q.Payload); err != nil {
+				log.Warnf("Failed to decode undelivered event %d: %v", q.ID, err)
+			} else {
+				// original callback is gone, restored from sources of event if any
+				if ls.restoreCallback != nil {
+					ls.restoreCallback(event)
+				}
+
+				ls.mutex.LockKey(event.Chat.ID)
+				ls.handleEvent(client, event)
+				ls.mutex.UnlockKey(event.Chat.ID)
+				replayed++
+			}
+
+			if err := manager.DelQueuedEvent(q.ID); err != nil {
+				log.Warnf("Failed to delete undelivered event %d: %v", q.ID, err)
+				return
+			}
+		}
+	}
+
+	if replayed > 0 {
+		log.Infof("Replayed %d undelivered events to %s", replayed, vendor)
+	}
+}
@@ -0,0 +1,116 @@
+package slave
+
+import (
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/db"
+	"github.com/duo/octopus/internal/manager"
+)
+
+// fakeClient records events sent to it, the first one is slow
+type fakeClient struct {
+	vendor string
+
+	lock sync.Mutex
+	sent []string
+}
+
+func (fc *fakeClient) Vendor() string {
+	return fc.vendor
+}
+
+func (fc *fakeClient) SendEvent(event *common.OctopusEvent) (*common.OctopusEvent, error) {
+	fc.lock.Lock()
+	first := len(fc.sent) == 0
+	fc.sent = append(fc.sent, event.ID)
+	fc.lock.Unlock()
+
+	if first {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return &common.OctopusEvent{ID: "sent-" + event.ID, Timestamp: time.Now().Unix()}, nil
+}
+
+func (fc *fakeClient) Dispose() {}
+
+func (fc *fakeClient) sentIDs() []string {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	return slices.Clone(fc.sent)
+}
+
+func TestReplayBeforeLiveEvents(t *testing.T) {
+	conn, err := db.Open(db.DriverSQLite, filepath.Join(t.TempDir(), "octopus.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	manager.Init(manager.NewSQLiteStore(conn))
+
+	vendor := common.Vendor{Type: "qq", UID: "10001"}
+	for _, id := range []string{"1", "2"} {
+		payload, err := common.EncodeEvent(&common.OctopusEvent{
+			Vendor:  vendor,
+			ID:      id,
+			Chat:    common.Chat{ID: "30003", Type: "group"},
+			Type:    common.EventText,
+			Sources: []*common.SourceMessage{{ChatID: -100, MessageID: 7}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := manager.PushEvent(manager.QueueShutdownOut, vendor.String(), payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	in := make(chan *common.OctopusEvent)
+	ls := NewLimbService(&common.Configure{}, in, make(chan *common.OctopusEvent))
+
+	var lock sync.Mutex
+	var restored []string
+	ls.SetCallbackRestorer(func(event *common.OctopusEvent) {
+		if len(event.Sources) != 1 || event.Sources[0].MessageID != 7 {
+			t.Errorf("sources of replayed event = %+v", event.Sources)
+		}
+		event.Callback = func(result *common.OctopusEvent, err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			restored = append(restored, result.ID)
+		}
+	})
+	go ls.handleMasterLoop()
+	defer close(in)
+
+	client := &fakeClient{vendor: vendor.String()}
+	ls.register(vendor.String(), client)
+	in <- &common.OctopusEvent{
+		Vendor: vendor,
+		ID:     "3",
+		Chat:   common.Chat{ID: "30004", Type: "group"},
+		Type:   common.EventText,
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for ls.Pending() > 0 || len(client.sentIDs()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("sent = %v", client.sentIDs())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if sent := client.sentIDs(); !slices.Equal(sent, []string{"1", "2", "3"}) {
+		t.Errorf("sent = %v", sent)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if !slices.Equal(restored, []string{"sent-1", "sent-2"}) {
+		t.Errorf("restored callbacks = %v", restored)
+	}
+}
@@ -0,0 +1,754 @@
+package slave
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/filter"
+	"github.com/duo/octopus/internal/satori"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gorilla/websocket"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	satoriPingInterval  = 10 * time.Second
+	satoriReadyTimeout  = 30 * time.Second
+	satoriRetryInterval = 30 * time.Second
+)
+
+type SatoriClient struct {
+	vendor   *common.Vendor
+	platform string
+	config   *common.Configure
+	endpoint common.SatoriEndpoint
+	apiURL   string
+
+	self *satori.User
+
+	// user id -> direct channel id
+	channels     map[string]string
+	channelsLock sync.RWMutex
+
+	client http.Client
+	conn   *websocket.Conn
+	out    chan<- *common.OctopusEvent
+
+	s2m filter.EventFilterChain
+	m2s filter.EventFilterChain
+
+	writeLock sync.Mutex
+	sequence  atomic.Int64
+
+	done chan struct{}
+
+	mutex common.KeyMutex
+}
+
+// connect to satori endpoint, resume from sequence and wait for ready signal
+func NewSatoriClient(endpoint common.SatoriEndpoint, sequence int64, config *common.Configure, out chan<- *common.OctopusEvent) (*SatoriClient, error) {
+	base := strings.TrimSuffix(strings.TrimSuffix(endpoint.Endpoint, "/"), "/v1")
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.Path += "/v1/events"
+
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &SatoriClient{
+		config:   config,
+		endpoint: endpoint,
+		apiURL:   base + "/v1/",
+		channels: make(map[string]string),
+		client:   http.Client{Timeout: config.Service.SendTiemout},
+		conn:     conn,
+		out:      out,
+		m2s: filter.NewEventFilterChain(
+			filter.StickerM2SFilter{},
+			filter.VoiceM2SFilter{},
+		),
+		s2m: filter.NewEventFilterChain(
+			filter.VoiceS2MFilter{},
+			filter.EmoticonS2MFilter{},
+			filter.StickerS2MFilter{},
+		),
+		done:  make(chan struct{}),
+		mutex: common.NewHashed(47),
+	}
+	sc.sequence.Store(sequence)
+
+	if err := sc.identify(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	log.Infof("SatoriClient(%s) websocket connected", sc.vendor)
+
+	return sc, nil
+}
+
+func (sc *SatoriClient) Vendor() string {
+	return sc.vendor.String()
+}
+
+func (sc *SatoriClient) Sequence() int64 {
+	return sc.sequence.Load()
+}
+
+// send identify signal and pick login from ready signal
+func (sc *SatoriClient) identify() error {
+	body, _ := json.Marshal(&satori.Identify{Token: sc.endpoint.Token, Sequence: sc.sequence.Load()})
+	if err := sc.sendSignal(&satori.Signal{Op: satori.OpIdentify, Body: body}); err != nil {
+		return err
+	}
+
+	_ = sc.conn.SetReadDeadline(time.Now().Add(satoriReadyTimeout))
+	defer sc.conn.SetReadDeadline(time.Time{})
+
+	for {
+		var signal satori.Signal
+		if err := sc.conn.ReadJSON(&signal); err != nil {
+			return err
+		}
+		if signal.Op != satori.OpReady {
+			continue
+		}
+
+		var ready satori.Ready
+		if err := json.Unmarshal(signal.Body, &ready); err != nil {
+			return err
+		}
+		for _, login := range ready.Logins {
+			selfID := login.SelfID
+			if selfID == "" && login.User != nil {
+				selfID = login.User.ID
+			}
+			if sc.endpoint.SelfID != "" && sc.endpoint.SelfID != selfID {
+				continue
+			}
+
+			sc.platform = login.Platform
+			sc.self = login.User
+			if sc.self == nil {
+				sc.self = &satori.User{ID: selfID}
+			}
+			sc.vendor = &common.Vendor{
+				Type: cmp.Or(sc.endpoint.Vendor, login.Platform),
+				UID:  selfID,
+			}
+			return nil
+		}
+
+		return errors.New("no available login found")
+	}
+}
+
+// read signal from satori endpoint
+func (sc *SatoriClient) run(stopFunc func()) {
+	defer func() {
+		log.Infof("SatoriClient(%s) disconnected from websocket", sc.vendor)
+		close(sc.done)
+		_ = sc.conn.Close()
+		stopFunc()
+	}()
+
+	go sc.ping()
+	go sc.updateChats()
+	go syncPeriodically(sc.config.Service.SyncInterval, sc.done, sc.updateChats)
+
+	for {
+		var signal satori.Signal
+		if err := sc.conn.ReadJSON(&signal); err != nil {
+			log.Warnf("Error reading from websocket: %v", err)
+			break
+		}
+
+		switch signal.Op {
+		case satori.OpEvent:
+			var event satori.Event
+			if err := json.Unmarshal(signal.Body, &event); err != nil {
+				log.Warnf("Failed to unmarshal event: %v", err)
+				continue
+			}
+			if event.ID > sc.sequence.Load() {
+				sc.sequence.Store(event.ID)
+			}
+			go sc.processEvent(&event)
+		case satori.OpPong:
+			log.Debugln("Receive pong signal")
+		default:
+			log.Warnf("Signal %d not support", signal.Op)
+		}
+	}
+}
+
+// send event to satori endpoint, and return response
+func (sc *SatoriClient) SendEvent(event *common.OctopusEvent) (*common.OctopusEvent, error) {
+	common.EventLog(event).Debugf("Receive octopus event: %v", event)
+
+	event = sc.m2s.Apply(event)
+
+	if event.Type == common.EventSync {
+		go sc.updateChats()
+		return &common.OctopusEvent{
+			ID:        "sync",
+			Timestamp: time.Now().Unix(),
+		}, nil
+	}
+
+	channelID := event.Chat.ID
+	if event.Chat.Type == "private" {
+		var err error
+		if channelID, err = sc.getDirectChannel(event.Chat.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	elements := []*satori.Element{}
+
+	if event.Reply != nil {
+		elements = append(elements, satori.NewQuote(event.Reply.ID))
+	}
+
+	switch event.Type {
+	case common.EventText:
+		elements = append(elements, satori.NewText(event.Content))
+	case common.EventPhoto:
+		photos := event.Data.([]*common.BlobData)
+		for _, photo := range photos {
+			elements = append(elements, satori.NewResource(satori.Img, dataURL(photo), ""))
+		}
+		if event.Content != "" {
+			elements = append(elements, satori.NewText(event.Content))
+		}
+	case common.EventSticker:
+		blob := event.Data.(*common.BlobData)
+		elements = append(elements, satori.NewResource(satori.Img, dataURL(blob), ""))
+	case common.EventVideo:
+		blob := event.Data.(*common.BlobData)
+		elements = append(elements, satori.NewResource(satori.Video, dataURL(blob), ""))
+	case common.EventAudio:
+		blob := event.Data.(*common.BlobData)
+		elements = append(elements, satori.NewResource(satori.Audio, dataURL(blob), ""))
+	case common.EventFile:
+		blob := event.Data.(*common.BlobData)
+		elements = append(elements, satori.NewResource(satori.File, dataURL(blob), blob.Name))
+	case common.EventLocation:
+		location := event.Data.(*common.LocationData)
+		elements = append(elements, satori.NewText(fmt.Sprintf("[位置]%s\n%s", location.Name, location.Address)))
+	default:
+		return nil, fmt.Errorf("%s not support", event.Type)
+	}
+
+	var messages []*satori.Message
+	if err := sc.request(satori.MessageCreate, map[string]interface{}{
+		"channel_id": channelID,
+		"content":    satori.Build(elements),
+	}, &messages); err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, errors.New("empty message.create response")
+	}
+
+	return &common.OctopusEvent{
+		ID:        messages[0].ID,
+		Timestamp: time.Now().Unix(),
+	}, nil
+}
+
+func (sc *SatoriClient) Dispose() {
+	oldConn := sc.conn
+	if oldConn == nil {
+		return
+	}
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server_shutting_down")
+	_ = oldConn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(3*time.Second))
+	_ = oldConn.Close()
+}
+
+func (sc *SatoriClient) ping() {
+	ticker := time.NewTicker(satoriPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sc.done:
+			return
+		case <-ticker.C:
+			if err := sc.sendSignal(&satori.Signal{Op: satori.OpPing}); err != nil {
+				log.Warnf("Failed to send ping signal: %v", err)
+			}
+		}
+	}
+}
+
+func (sc *SatoriClient) processEvent(event *satori.Event) {
+	log.Debugf("Receive event #%d: %s", event.ID, event.Type)
+
+	if event.SelfID != "" && event.SelfID != sc.vendor.UID {
+		return
+	}
+
+	switch event.Type {
+	case satori.MessageCreated:
+		sc.processMessage(event)
+	case satori.MessageDeleted:
+		sc.processRecall(event)
+	case satori.GuildAdded, satori.GuildUpdated, satori.GuildRemoved:
+		sc.updateChats()
+	}
+}
+
+func (sc *SatoriClient) processMessage(e *satori.Event) {
+	if e.Message == nil {
+		return
+	}
+
+	event, ok := sc.generateEvent(e)
+	if !ok {
+		return
+	}
+	event.ID = e.Message.ID
+	if e.Message.Quote != nil {
+		event.Reply = &common.ReplyInfo{
+			ID: e.Message.Quote.ID,
+		}
+	}
+
+	sc.mutex.LockKey(event.Chat.ID)
+	defer sc.mutex.UnlockKey(event.Chat.ID)
+
+	event.Type = common.EventText
+
+	var summary []string
+
+	photos := []*common.BlobData{}
+	elements := satori.Parse(e.Message.Content)
+	for _, elem := range elements {
+		switch elem.Type {
+		case satori.Text:
+			summary = append(summary, elem.Text)
+		case satori.At:
+			if elem.Attr("type") == "all" || elem.Attr("type") == "here" {
+				summary = append(summary, "@all ")
+				event.Mentions = append(event.Mentions, common.MentionAll)
+			} else {
+				summary = append(summary, fmt.Sprintf("@%s ", cmp.Or(elem.Attr("name"), elem.Attr("id"))))
+				event.Mentions = append(event.Mentions, elem.Attr("id"))
+			}
+		case satori.Sharp:
+			summary = append(summary, fmt.Sprintf("#%s ", cmp.Or(elem.Attr("name"), elem.Attr("id"))))
+		case satori.Quote:
+			event.Reply = &common.ReplyInfo{
+				ID: elem.Attr("id"),
+			}
+		case satori.Img:
+			summary = append(summary, "[图片]")
+			if bin, err := sc.download(elem.Attr("src")); err != nil {
+				log.Warnf("Download image failed: %v", err)
+			} else {
+				photos = append(photos, bin)
+			}
+		case satori.Audio:
+			if bin, err := sc.download(elem.Attr("src")); err != nil {
+				log.Warnf("Download audio failed: %v", err)
+				event.Content = "[语音下载失败]"
+			} else {
+				event.Type = common.EventAudio
+				event.Data = bin
+			}
+		case satori.Video:
+			if bin, err := sc.download(elem.Attr("src")); err != nil {
+				log.Warnf("Download video failed: %v", err)
+				event.Content = "[视频下载失败]"
+			} else {
+				event.Type = common.EventVideo
+				event.Data = bin
+			}
+		case satori.File:
+			if bin, err := sc.download(elem.Attr("src")); err != nil {
+				log.Warnf("Download file failed: %v", err)
+				event.Content = "[文件下载失败]"
+			} else {
+				if title := elem.Attr("title"); title != "" {
+					bin.Name = title
+				}
+				event.Type = common.EventFile
+				event.Data = bin
+			}
+		}
+	}
+
+	if len(summary) > 0 {
+		if len(summary) == 1 && elements[0].Type == satori.Img {
+			event.Type = common.EventPhoto
+			event.Data = photos
+		} else {
+			event.Content = strings.Join(summary, "")
+
+			if len(photos) > 0 {
+				event.Type = common.EventPhoto
+				event.Data = photos
+			}
+		}
+	}
+
+	if event.Type == common.EventPhoto && len(photos) == 0 {
+		event.Type = common.EventText
+		event.Data = nil
+	}
+
+	sc.pushEvent(event)
+}
+
+func (sc *SatoriClient) processRecall(e *satori.Event) {
+	if e.Message == nil {
+		return
+	}
+
+	event, ok := sc.generateEvent(e)
+	if !ok {
+		return
+	}
+	event.ID = fmt.Sprint(time.Now().Unix())
+	event.Timestamp = time.Now().UnixMilli()
+
+	event.Type = common.EventRevoke
+	event.Content = "recalled a message"
+
+	event.Reply = &common.ReplyInfo{
+		ID:        e.Message.ID,
+		Timestamp: 0,
+		Sender:    cmp.Or(event.From.Remark, event.From.Username, event.From.ID),
+	}
+
+	sc.pushEvent(event)
+}
+
+// generate octopus event with sender and chat info
+func (sc *SatoriClient) generateEvent(e *satori.Event) (*common.OctopusEvent, bool) {
+	channel := cmp.Or(e.Channel, e.Message.Channel)
+	guild := cmp.Or(e.Guild, e.Message.Guild)
+	user := cmp.Or(e.User, e.Message.User, e.Operator)
+	member := cmp.Or(e.Member, e.Message.Member)
+	if channel == nil || user == nil {
+		log.Debugf("Ignore event #%d without channel or user: %s", e.ID, e.Type)
+		return nil, false
+	}
+
+	// satori timestamps are in milliseconds
+	ts := cmp.Or(e.Message.CreatedAt, e.Timestamp, time.Now().UnixMilli())
+
+	event := &common.OctopusEvent{
+		Vendor:    *sc.vendor,
+		Timestamp: ts / 1000,
+		From: common.User{
+			ID:       user.ID,
+			Username: cmp.Or(user.Nick, user.Name, user.ID),
+		},
+	}
+	if member != nil {
+		event.From.Remark = member.Nick
+	}
+
+	if channel.Type == satori.ChannelDirect {
+		targetID := user.ID
+		if user.ID == sc.self.ID { // sent by self
+			var ok bool
+			if targetID, ok = sc.getDirectUser(channel.ID); !ok {
+				log.Debugf("Ignore self sent message in unknown channel %s", channel.ID)
+				return nil, false
+			}
+		} else {
+			sc.channelsLock.Lock()
+			sc.channels[user.ID] = channel.ID
+			sc.channelsLock.Unlock()
+		}
+		event.Chat = common.Chat{
+			Type:  "private",
+			ID:    targetID,
+			Title: cmp.Or(user.Nick, user.Name, targetID),
+		}
+	} else {
+		event.Chat = common.Chat{
+			Type:  "group",
+			ID:    channel.ID,
+			Title: channelTitle(guild, channel),
+		}
+	}
+
+	return event, true
+}
+
+func (sc *SatoriClient) updateChats() {
+	chats := []*common.Chat{{
+		ID:    sc.self.ID,
+		Type:  "private",
+		Title: cmp.Or(sc.self.Nick, sc.self.Name, sc.self.ID),
+	}}
+
+	// incomplete chat list will be treated as removal by master, skip sync on failure.
+	// lists not implemented by platform are empty
+	friends, err := listAll[*satori.User](sc, satori.FriendList, nil)
+	if isNotImplemented(err) {
+		log.Debugf("SatoriClient(%s) friend list not implemented: %v", sc.vendor, err)
+	} else if err != nil {
+		log.Warnf("Failed to get friend list: %v", err)
+		return
+	}
+	for _, f := range friends {
+		if f.ID == sc.self.ID {
+			continue
+		}
+		chats = append(chats, &common.Chat{
+			ID:    f.ID,
+			Type:  "private",
+			Title: cmp.Or(f.Nick, f.Name, f.ID),
+		})
+	}
+
+	guilds, err := listAll[*satori.Guild](sc, satori.GuildList, nil)
+	if isNotImplemented(err) {
+		log.Debugf("SatoriClient(%s) guild list not implemented: %v", sc.vendor, err)
+	} else if err != nil {
+		log.Warnf("Failed to get guild list: %v", err)
+		return
+	}
+	for _, g := range guilds {
+		channels, err := listAll[*satori.Channel](sc, satori.ChannelList, map[string]interface{}{"guild_id": g.ID})
+		if isNotImplemented(err) {
+			log.Debugf("SatoriClient(%s) channel list not implemented: %v", sc.vendor, err)
+			continue
+		} else if err != nil {
+			log.Warnf("Failed to get channel list of guild %s: %v", g.ID, err)
+			return
+		}
+		for _, c := range channels {
+			if c.Type != satori.ChannelText {
+				continue
+			}
+			chats = append(chats, &common.Chat{
+				ID:    c.ID,
+				Type:  "group",
+				Title: channelTitle(g, c),
+			})
+		}
+	}
+
+	// Sync chats
+	event := &common.OctopusEvent{
+		Vendor:    *sc.vendor,
+		ID:        "sync",
+		Timestamp: time.Now().UnixMilli(),
+		Type:      common.EventSync,
+		Data:      chats,
+	}
+
+	sc.pushEvent(event)
+}
+
+func (sc *SatoriClient) getDirectChannel(userID string) (string, error) {
+	sc.channelsLock.RLock()
+	channelID, ok := sc.channels[userID]
+	sc.channelsLock.RUnlock()
+	if ok {
+		return channelID, nil
+	}
+
+	var channel satori.Channel
+	if err := sc.request(satori.UserChannelCreate, map[string]interface{}{"user_id": userID}, &channel); err != nil {
+		return "", err
+	}
+
+	sc.channelsLock.Lock()
+	sc.channels[userID] = channel.ID
+	sc.channelsLock.Unlock()
+
+	return channel.ID, nil
+}
+
+func (sc *SatoriClient) getDirectUser(channelID string) (string, bool) {
+	sc.channelsLock.RLock()
+	defer sc.channelsLock.RUnlock()
+
+	for userID, id := range sc.channels {
+		if id == channelID {
+			return userID, true
+		}
+	}
+	return "", false
+}
+
+// download resource element
+func (sc *SatoriClient) download(src string) (*common.BlobData, error) {
+	if strings.HasPrefix(src, "data:") {
+		idx := strings.Index(src, ",")
+		if idx == -1 || !strings.HasSuffix(src[:idx], ";base64") {
+			return nil, errors.New("data url format invalid")
+		}
+		data, err := base64.StdEncoding.DecodeString(src[idx+1:])
+		if err != nil {
+			return nil, err
+		}
+		return &common.BlobData{
+			Mime:   mimetype.Detect(data).String(),
+			Binary: data,
+		}, nil
+	} else if strings.HasPrefix(src, "internal:") {
+		return common.Download(sc.apiURL + "proxy/" + src)
+	}
+
+	return common.Download(src)
+}
+
+func (sc *SatoriClient) pushEvent(event *common.OctopusEvent) {
+	if event = sc.s2m.Apply(event); event == nil {
+		return
+	}
+
+	sc.out <- event
+}
+
+// call satori http api
+func (sc *SatoriClient) request(method satori.RequestType, params any, result any) error {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sc.apiURL+string(method), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Satori-Platform", sc.platform)
+	req.Header.Set("Satori-User-ID", sc.vendor.UID)
+	req.Header.Set("X-Platform", sc.platform)
+	req.Header.Set("X-Self-ID", sc.vendor.UID)
+	if sc.endpoint.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+sc.endpoint.Token)
+	}
+
+	// body may carry media as data url
+	log.Debugf("Send request %s (%d bytes)", method, len(body))
+	resp, err := sc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &satoriStatusError{method: method, status: resp.StatusCode, body: data}
+	}
+
+	if result != nil && len(data) > 0 {
+		return json.Unmarshal(data, result)
+	}
+	return nil
+}
+
+// non-ok http status of satori api
+type satoriStatusError struct {
+	method satori.RequestType
+	status int
+	body   []byte
+}
+
+func (e *satoriStatusError) Error() string {
+	return fmt.Sprintf("%s response status: %d %s", e.method, e.status, e.body)
+}
+
+// whether api is not provided by implementation, rather than failed
+func isNotImplemented(err error) bool {
+	var statusErr *satoriStatusError
+	return errors.As(err, &statusErr) &&
+		(statusErr.status == http.StatusNotFound || statusErr.status == http.StatusNotImplemented)
+}
+
+func (sc *SatoriClient) sendSignal(signal *satori.Signal) error {
+	conn := sc.conn
+	if conn == nil {
+		return ErrWebsocketNotConnected
+	}
+	sc.writeLock.Lock()
+	defer sc.writeLock.Unlock()
+	_ = conn.SetWriteDeadline(time.Now().Add(sc.config.Service.SendTiemout))
+	return conn.WriteJSON(signal)
+}
+
+// fetch all pages of satori list api
+func listAll[T any](sc *SatoriClient, method satori.RequestType, params map[string]interface{}) ([]T, error) {
+	items := []T{}
+
+	next := ""
+	for {
+		req := map[string]interface{}{}
+		for k, v := range params {
+			req[k] = v
+		}
+		if next != "" {
+			req["next"] = next
+		}
+
+		var list satori.List[T]
+		if err := sc.request(method, req, &list); err != nil {
+			return items, err
+		}
+		items = append(items, list.Data...)
+
+		if list.Next == "" || list.Next == next {
+			return items, nil
+		}
+		next = list.Next
+	}
+}
+
+func channelTitle(guild *satori.Guild, channel *satori.Channel) string {
+	if guild == nil || guild.Name == "" {
+		return cmp.Or(channel.Name, channel.ID)
+	}
+	if channel.Name == "" || channel.Name == guild.Name {
+		return guild.Name
+	}
+	return fmt.Sprintf("%s #%s", guild.Name, channel.Name)
+}
+
+func dataURL(blob *common.BlobData) string {
+	mime := blob.Mime
+	if mime == "" {
+		mime = mimetype.Detect(blob.Binary).String()
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(blob.Binary))
+}
@@ -0,0 +1,304 @@
+package slave
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/satori"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	fakeSatoriToken = "secret"
+	fakeSatoriSelf  = "10001"
+)
+
+type fakeRequest struct {
+	method string
+	auth   string
+	body   map[string]any
+}
+
+// fakeSatori serves satori events websocket and http api of one login
+type fakeSatori struct {
+	t      *testing.T
+	server *httptest.Server
+
+	identify chan satori.Identify
+	conns    chan *websocket.Conn
+
+	// apis answered with 501 Not Implemented
+	unimplemented map[satori.RequestType]bool
+
+	requestsLock sync.Mutex
+	requests     []*fakeRequest
+}
+
+func newFakeSatori(t *testing.T) *fakeSatori {
+	fs := &fakeSatori{
+		t:        t,
+		identify: make(chan satori.Identify, 4),
+		conns:    make(chan *websocket.Conn, 4),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/events", fs.serveEvents)
+	mux.HandleFunc("/v1/", fs.serveAPI)
+	fs.server = httptest.NewServer(mux)
+	t.Cleanup(fs.server.Close)
+
+	return fs
+}
+
+func (fs *fakeSatori) serveEvents(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		fs.t.Errorf("upgrade: %v", err)
+		return
+	}
+
+	var signal satori.Signal
+	if err := conn.ReadJSON(&signal); err != nil || signal.Op != satori.OpIdentify {
+		fs.t.Errorf("expect identify signal, got %+v: %v", signal, err)
+		conn.Close()
+		return
+	}
+	var identify satori.Identify
+	_ = json.Unmarshal(signal.Body, &identify)
+	fs.identify <- identify
+
+	body, _ := json.Marshal(&satori.Ready{Logins: []*satori.Login{{
+		User:     &satori.User{ID: fakeSatoriSelf, Name: "Octopus"},
+		Platform: "qq",
+	}}})
+	if err := conn.WriteJSON(&satori.Signal{Op: satori.OpReady, Body: body}); err != nil {
+		fs.t.Errorf("write ready: %v", err)
+		conn.Close()
+		return
+	}
+
+	fs.conns <- conn
+}
+
+func (fs *fakeSatori) serveAPI(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	var body map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	fs.requestsLock.Lock()
+	fs.requests = append(fs.requests, &fakeRequest{
+		method: method,
+		auth:   r.Header.Get("Authorization"),
+		body:   body,
+	})
+	fs.requestsLock.Unlock()
+
+	if fs.unimplemented[satori.RequestType(method)] {
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+		return
+	}
+
+	var resp any
+	switch satori.RequestType(method) {
+	case satori.FriendList, satori.GuildList, satori.ChannelList:
+		resp = map[string]any{"data": []any{}}
+	case satori.UserChannelCreate:
+		resp = &satori.Channel{ID: "dm-" + body["user_id"].(string), Type: satori.ChannelDirect}
+	case satori.MessageCreate:
+		resp = []*satori.Message{{ID: "m100", Content: body["content"].(string)}}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (fs *fakeSatori) sendEvent(conn *websocket.Conn, event *satori.Event) {
+	body, _ := json.Marshal(event)
+	if err := conn.WriteJSON(&satori.Signal{Op: satori.OpEvent, Body: body}); err != nil {
+		fs.t.Fatalf("write event: %v", err)
+	}
+}
+
+func (fs *fakeSatori) requestsOf(method satori.RequestType) []*fakeRequest {
+	fs.requestsLock.Lock()
+	defer fs.requestsLock.Unlock()
+
+	var requests []*fakeRequest
+	for _, r := range fs.requests {
+		if r.method == string(method) {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+func waitEvent(t *testing.T, out <-chan *common.OctopusEvent, eventType common.EventType) *common.OctopusEvent {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-out:
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("no %s event received", eventType)
+		}
+	}
+}
+
+func connectFakeSatori(t *testing.T, fs *fakeSatori, sequence int64, out chan<- *common.OctopusEvent) (*SatoriClient, *websocket.Conn, satori.Identify, chan struct{}) {
+	t.Helper()
+
+	config := &common.Configure{}
+	config.Service.SendTiemout = 5 * time.Second
+
+	endpoint := common.SatoriEndpoint{Endpoint: fs.server.URL, Token: fakeSatoriToken}
+	sc, err := NewSatoriClient(endpoint, sequence, config, out)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	identify := <-fs.identify
+
+	stopped := make(chan struct{})
+	go sc.run(func() { close(stopped) })
+
+	return sc, <-fs.conns, identify, stopped
+}
+
+func TestSatoriClient(t *testing.T) {
+	fs := newFakeSatori(t)
+	out := make(chan *common.OctopusEvent, 16)
+
+	sc, conn, identify, stopped := connectFakeSatori(t, fs, 0, out)
+
+	t.Run("identify", func(t *testing.T) {
+		if identify.Token != fakeSatoriToken || identify.Sequence != 0 {
+			t.Errorf("identify = %+v", identify)
+		}
+		if got := sc.Vendor(); got != "qq;"+fakeSatoriSelf {
+			t.Errorf("vendor = %s", got)
+		}
+
+		// chats are synced on ready
+		sync := waitEvent(t, out, common.EventSync)
+		chats := sync.Data.([]*common.Chat)
+		if len(chats) != 1 || chats[0].ID != fakeSatoriSelf {
+			t.Errorf("synced chats = %+v", chats)
+		}
+		for _, r := range fs.requestsOf(satori.FriendList) {
+			if r.auth != "Bearer "+fakeSatoriToken {
+				t.Errorf("authorization = %q", r.auth)
+			}
+		}
+	})
+
+	t.Run("dispatch", func(t *testing.T) {
+		fs.sendEvent(conn, &satori.Event{
+			ID:      7,
+			Type:    satori.MessageCreated,
+			SelfID:  fakeSatoriSelf,
+			Channel: &satori.Channel{ID: "g1", Type: satori.ChannelText, Name: "general"},
+			Guild:   &satori.Guild{ID: "g1", Name: "Group"},
+			User:    &satori.User{ID: "20002", Name: "Alice"},
+			Message: &satori.Message{
+				ID:      "m7",
+				Content: `hello <at id="` + fakeSatoriSelf + `" name="Octopus"/>`,
+			},
+		})
+
+		event := waitEvent(t, out, common.EventText)
+		if event.ID != "m7" || event.Chat.ID != "g1" || event.Chat.Type != "group" || event.From.ID != "20002" {
+			t.Errorf("event = %+v", event)
+		}
+		if event.Content != "hello @Octopus " {
+			t.Errorf("content = %q", event.Content)
+		}
+		if !slices.Contains(event.Mentions, fakeSatoriSelf) {
+			t.Errorf("mentions = %v", event.Mentions)
+		}
+		if got := sc.Sequence(); got != 7 {
+			t.Errorf("sequence = %d", got)
+		}
+	})
+
+	t.Run("send", func(t *testing.T) {
+		resp, err := sc.SendEvent(&common.OctopusEvent{
+			Type:    common.EventText,
+			Chat:    common.Chat{ID: "g1", Type: "group"},
+			Content: "hi & bye",
+		})
+		if err != nil {
+			t.Fatalf("send: %v", err)
+		}
+		if resp.ID != "m100" {
+			t.Errorf("message id = %s", resp.ID)
+		}
+
+		if _, err := sc.SendEvent(&common.OctopusEvent{
+			Type:    common.EventText,
+			Chat:    common.Chat{ID: "30003", Type: "private"},
+			Content: "direct",
+		}); err != nil {
+			t.Fatalf("send direct: %v", err)
+		}
+
+		creates := fs.requestsOf(satori.MessageCreate)
+		if len(creates) != 2 {
+			t.Fatalf("message.create requests = %d", len(creates))
+		}
+		if creates[0].body["channel_id"] != "g1" || creates[0].body["content"] != "hi &amp; bye" {
+			t.Errorf("message.create = %v", creates[0].body)
+		}
+		if creates[1].body["channel_id"] != "dm-30003" {
+			t.Errorf("direct message.create = %v", creates[1].body)
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		conn.Close()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("client not stopped after disconnect")
+		}
+
+		sc, conn, identify, _ := connectFakeSatori(t, fs, sc.Sequence(), out)
+		defer sc.Dispose()
+		defer conn.Close()
+
+		if identify.Sequence != 7 {
+			t.Errorf("resume sequence = %d", identify.Sequence)
+		}
+	})
+}
+
+func TestSatoriClientUnimplementedList(t *testing.T) {
+	fs := newFakeSatori(t)
+	fs.unimplemented = map[satori.RequestType]bool{satori.FriendList: true}
+	out := make(chan *common.OctopusEvent, 16)
+
+	sc, conn, _, _ := connectFakeSatori(t, fs, 0, out)
+	defer sc.Dispose()
+	defer conn.Close()
+
+	// chats are still synced without friends
+	sync := waitEvent(t, out, common.EventSync)
+	if chats := sync.Data.([]*common.Chat); len(chats) != 1 {
+		t.Errorf("synced chats = %+v", chats)
+	}
+	if len(fs.requestsOf(satori.GuildList)) == 0 {
+		t.Error("guild list not requested")
+	}
+}
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// content addressed blob files referenced by webhook payloads
+type blobStore struct {
+	path string
+}
+
+func (s *blobStore) file(hash string) (string, error) {
+	if !hashPattern.MatchString(hash) {
+		return "", errors.New("invalid blob hash")
+	}
+	return filepath.Join(s.path, hash), nil
+}
+
+// write blob if missing, otherwise refresh its modification time
+func (s *blobStore) put(ref *blobRef) error {
+	path, err := s.file(ref.SHA256)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if _, err := os.Stat(path); err == nil {
+		return os.Chtimes(path, now, now)
+	}
+
+	if err := os.MkdirAll(s.path, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.path, ".blob-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(ref.binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// remove blobs not referenced since before
+func (s *blobStore) expire(before time.Time) (int, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if !hashPattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.path, entry.Name())); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
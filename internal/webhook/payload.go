@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/duo/octopus/internal/common"
+)
+
+// json copy of OctopusEvent, blobs are replaced by references
+type eventPayload struct {
+	Direction string            `json:"direction,omitempty"`
+	Vendor    common.Vendor     `json:"vendor"`
+	ID        string            `json:"id,omitempty"`
+	ThreadID  string            `json:"thread_id,omitempty"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	From      common.User       `json:"from"`
+	Chat      common.Chat       `json:"chat"`
+	Type      string            `json:"type"`
+	Content   string            `json:"content,omitempty"`
+	Reply     *common.ReplyInfo `json:"reply,omitempty"`
+	Data      any               `json:"data,omitempty"`
+}
+
+type appPayload struct {
+	Title       string              `json:"title,omitempty"`
+	Description string              `json:"desc,omitempty"`
+	Source      string              `json:"source,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Content     string              `json:"raw,omitempty"`
+	Blobs       map[string]*blobRef `json:"blobs,omitempty"`
+}
+
+type forwardPayload struct {
+	Title    string          `json:"title,omitempty"`
+	Messages []*eventPayload `json:"messages,omitempty"`
+}
+
+type blobRef struct {
+	Name   string `json:"name,omitempty"`
+	Mime   string `json:"mime,omitempty"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+	URL    string `json:"url"`
+
+	binary []byte
+}
+
+func newEventPayload(event *common.OctopusEvent, blobURL func(string) string, refs *[]*blobRef) *eventPayload {
+	return &eventPayload{
+		Vendor:    event.Vendor,
+		ID:        event.ID,
+		ThreadID:  event.ThreadID,
+		Timestamp: event.Timestamp,
+		From:      event.From,
+		Chat:      event.Chat,
+		Type:      event.Type.String(),
+		Content:   event.Content,
+		Reply:     event.Reply,
+		Data:      newDataPayload(event.Data, blobURL, refs),
+	}
+}
+
+func newDataPayload(data any, blobURL func(string) string, refs *[]*blobRef) any {
+	switch v := data.(type) {
+	case *common.BlobData:
+		return newBlobRef(v, blobURL, refs)
+	case []*common.BlobData:
+		blobs := make([]*blobRef, 0, len(v))
+		for _, blob := range v {
+			blobs = append(blobs, newBlobRef(blob, blobURL, refs))
+		}
+		return blobs
+	case *common.AppData:
+		if v == nil {
+			return nil
+		}
+		app := &appPayload{
+			Title:       v.Title,
+			Description: v.Description,
+			Source:      v.Source,
+			URL:         v.URL,
+			Content:     v.Content,
+		}
+		if len(v.Blobs) > 0 {
+			app.Blobs = make(map[string]*blobRef, len(v.Blobs))
+			for key, blob := range v.Blobs {
+				app.Blobs[key] = newBlobRef(blob, blobURL, refs)
+			}
+		}
+		return app
+	case *common.ForwardData:
+		if v == nil {
+			return nil
+		}
+		forward := &forwardPayload{Title: v.Title}
+		for _, message := range v.Messages {
+			forward.Messages = append(forward.Messages, newEventPayload(message, blobURL, refs))
+		}
+		return forward
+	default:
+		return data
+	}
+}
+
+func newBlobRef(blob *common.BlobData, blobURL func(string) string, refs *[]*blobRef) *blobRef {
+	if blob == nil {
+		return nil
+	}
+
+	sum := sha256.Sum256(blob.Binary)
+	hash := hex.EncodeToString(sum[:])
+	ref := &blobRef{
+		Name:   blob.Name,
+		Mime:   blob.Mime,
+		Size:   len(blob.Binary),
+		SHA256: hash,
+		URL:    blobURL(hash),
+		binary: blob.Binary,
+	}
+	*refs = append(*refs, ref)
+
+	return ref
+}
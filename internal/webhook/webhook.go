@@ -0,0 +1,352 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DirectionIn  = "in"  // slave to master
+	DirectionOut = "out" // master to slave
+
+	queueSize       = 1024
+	workerCount     = 4
+	initialBackoff  = time.Second
+	maxBackoff      = time.Minute
+	cleanupInterval = time.Hour
+	maxErrorLength  = 256
+)
+
+type job struct {
+	direction string
+	event     *common.OctopusEvent
+	payload   *eventPayload
+	refs      []*blobRef
+	endpoints []*common.WebhookEndpoint
+}
+
+type Dispatcher struct {
+	config *common.Configure
+	client *http.Client
+	blobs  *blobStore
+
+	endpoints []*common.WebhookEndpoint
+
+	queue chan *job
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+var dispatcher atomic.Pointer[Dispatcher]
+
+// Init start webhook workers, nothing is published without endpoints
+func Init(config *common.Configure) {
+	d := &Dispatcher{
+		config: config,
+		client: &http.Client{Timeout: config.Webhook.Timeout},
+		blobs:  &blobStore{path: config.Webhook.BlobPath},
+		queue:  make(chan *job, queueSize),
+		done:   make(chan struct{}),
+	}
+
+	for i := range config.Webhook.Endpoints {
+		endpoint := &config.Webhook.Endpoints[i]
+		if endpoint.URL == "" {
+			log.Warnf("Webhook %d has no url, ignored", i)
+			continue
+		}
+		if endpoint.Name == "" {
+			endpoint.Name = endpoint.URL
+		}
+		d.endpoints = append(d.endpoints, endpoint)
+	}
+	if len(d.endpoints) == 0 {
+		return
+	}
+
+	for i := 0; i < workerCount; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	d.wg.Add(1)
+	go d.cleanup()
+
+	dispatcher.Store(d)
+	log.Infof("Webhook started with %d endpoints", len(d.endpoints))
+}
+
+// Stop wait for workers, queued events are dropped
+func Stop() {
+	d := dispatcher.Swap(nil)
+	if d == nil {
+		return
+	}
+	close(d.done)
+	d.wg.Wait()
+}
+
+// Publish queue event for matched endpoints, never block the caller
+func Publish(direction string, event *common.OctopusEvent) {
+	d := dispatcher.Load()
+	if d == nil {
+		return
+	}
+
+	var endpoints []*common.WebhookEndpoint
+	for _, endpoint := range d.endpoints {
+		if match(endpoint, direction, event) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) == 0 {
+		return
+	}
+
+	// snapshot before filters modify the event
+	j := &job{direction: direction, event: event, endpoints: endpoints}
+	j.payload = newEventPayload(event, d.blobURL, &j.refs)
+	j.payload.Direction = direction
+
+	select {
+	case d.queue <- j:
+	default:
+		log.Warnf("Webhook queue full, drop %s event %s of %s", direction, event.ID, event.Vendor)
+		for _, endpoint := range endpoints {
+			delivery := newDelivery(endpoint, j)
+			delivery.Status = manager.DeliveryDropped
+			delivery.Error = "queue full"
+			if err := manager.AddDelivery(delivery); err != nil {
+				log.Warnf("Failed to add webhook delivery: %v", err)
+			}
+		}
+	}
+}
+
+// BlobFile path of stored blob by sha256
+func BlobFile(hash string) (string, error) {
+	d := dispatcher.Load()
+	if d == nil {
+		return "", fmt.Errorf("webhook disabled")
+	}
+	return d.blobs.file(hash)
+}
+
+func match(endpoint *common.WebhookEndpoint, direction string, event *common.OctopusEvent) bool {
+	if len(endpoint.Directions) > 0 && !slices.Contains(endpoint.Directions, direction) {
+		return false
+	}
+	vendor := event.Vendor.String()
+	if len(endpoint.Vendors) > 0 &&
+		!slices.Contains(endpoint.Vendors, vendor) && !slices.Contains(endpoint.Vendors, event.Vendor.Type) {
+		return false
+	}
+	if len(endpoint.Chats) > 0 {
+		limb := common.Limb{Type: event.Vendor.Type, UID: event.Vendor.UID, ChatID: event.Chat.ID}.String()
+		if !slices.Contains(endpoint.Chats, limb) && !slices.Contains(endpoint.Chats, event.Chat.ID) {
+			return false
+		}
+	}
+	if len(endpoint.Events) > 0 && !slices.Contains(endpoint.Events, event.Type.String()) {
+		return false
+	}
+	return true
+}
+
+func (d *Dispatcher) blobURL(hash string) string {
+	return strings.TrimRight(d.config.Webhook.PublicURL, "/") + "/api/v1/blobs/" + hash
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case j := <-d.queue:
+			d.process(j)
+		}
+	}
+}
+
+func (d *Dispatcher) process(j *job) {
+	defer func() {
+		panicErr := recover()
+		if panicErr != nil {
+			log.Errorf("Panic in webhook delivery: %v\n%s", panicErr, debug.Stack())
+		}
+	}()
+
+	for _, ref := range j.refs {
+		if err := d.blobs.put(ref); err != nil {
+			log.Warnf("Failed to store webhook blob %s: %v", ref.SHA256, err)
+		}
+	}
+
+	body, err := json.Marshal(j.payload)
+	if err != nil {
+		log.Warnf("Failed to marshal webhook payload: %v", err)
+		return
+	}
+
+	for _, endpoint := range j.endpoints {
+		d.deliver(endpoint, j, body)
+	}
+}
+
+// post body to endpoint, retry on network error, 429 and 5xx with exponential backoff
+func (d *Dispatcher) deliver(endpoint *common.WebhookEndpoint, j *job, body []byte) {
+	delivery := newDelivery(endpoint, j)
+	if err := manager.AddDelivery(delivery); err != nil {
+		log.Warnf("Failed to add webhook delivery: %v", err)
+	}
+	deliveryID := newDeliveryID()
+
+	backoff := initialBackoff
+	for {
+		delivery.Attempts++
+		code, err := d.post(endpoint, deliveryID, j.event.Type.String(), body)
+		delivery.ResponseCode = code
+		if err == nil {
+			delivery.Status = manager.DeliverySuccess
+			delivery.Error = ""
+			break
+		}
+
+		delivery.Status = manager.DeliveryFailed
+		delivery.Error = truncate(err.Error(), maxErrorLength)
+		if !retryable(code) || delivery.Attempts > d.config.Webhook.MaxRetries {
+			log.Warnf("Webhook %s delivery %s failed after %d attempts: %v",
+				endpoint.Name, deliveryID, delivery.Attempts, err)
+			break
+		}
+
+		select {
+		case <-d.done:
+			delivery.Error = "stopped before retry"
+		case <-time.After(backoff):
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+		break
+	}
+
+	if delivery.ID > 0 {
+		if err := manager.UpdateDelivery(delivery); err != nil {
+			log.Warnf("Failed to update webhook delivery: %v", err)
+		}
+	}
+}
+
+func (d *Dispatcher) post(endpoint *common.WebhookEndpoint, deliveryID, eventType string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := common.Itoa(time.Now().Unix())
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Octopus-Webhook")
+	req.Header.Set("X-Octopus-Delivery", deliveryID)
+	req.Header.Set("X-Octopus-Event", eventType)
+	req.Header.Set("X-Octopus-Timestamp", timestamp)
+	if endpoint.Secret != "" {
+		req.Header.Set("X-Octopus-Signature", "sha256="+Sign(endpoint.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign hex HMAC-SHA256 of "timestamp.body"
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// remove expired blobs and delivery logs
+func (d *Dispatcher) cleanup() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			if ttl := d.config.Webhook.BlobTTL; ttl > 0 {
+				if removed, err := d.blobs.expire(time.Now().Add(-ttl)); err != nil {
+					log.Warnf("Failed to remove expired webhook blobs: %v", err)
+				} else if removed > 0 {
+					log.Infof("Removed %d expired webhook blobs", removed)
+				}
+			}
+			if ttl := d.config.Webhook.LogTTL; ttl > 0 {
+				if _, err := manager.PurgeDeliveries(time.Now().Add(-ttl)); err != nil {
+					log.Warnf("Failed to purge webhook deliveries: %v", err)
+				}
+			}
+		}
+	}
+}
+
+func newDelivery(endpoint *common.WebhookEndpoint, j *job) *manager.Delivery {
+	return &manager.Delivery{
+		Webhook:   endpoint.Name,
+		Direction: j.direction,
+		Vendor:    j.event.Vendor.String(),
+		Chat:      j.event.Chat.ID,
+		EventType: j.event.Type.String(),
+		EventID:   j.event.ID,
+		Status:    manager.DeliveryPending,
+	}
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func retryable(code int) bool {
+	return code == 0 || code == http.StatusTooManyRequests || code >= 500
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
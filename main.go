@@ -4,41 +4,130 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/db"
+	"github.com/duo/octopus/internal/manager"
 	"github.com/duo/octopus/internal/master"
+	"github.com/duo/octopus/internal/metrics"
 	"github.com/duo/octopus/internal/slave"
+	"github.com/duo/octopus/internal/webhook"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const configPath = "configure.yaml"
+
 func main() {
-	config, err := common.LoadConfig("configure.yaml")
+	config, err := common.LoadConfig(configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	setupLog(config)
 
-	logLevel, err := log.ParseLevel(config.Log.Level)
-	if err == nil {
-		log.SetLevel(logLevel)
+	if len(os.Args) > 1 && os.Args[1] == "migrate-db" {
+		if err := migrateDB(config, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		if err := healthcheck(config); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
-	log.SetFormatter(&log.TextFormatter{TimestampFormat: "2006-01-02 15:04:05", FullTimestamp: true})
 
-	masterToSlave := common.NewMessageChan(1024)
-	slaveToMaster := common.NewMessageChan(1024)
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := exportChat(config, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
+	conn, err := db.Open(config.Database.Driver, databaseDSN(config, config.Database.Driver))
+	if err != nil {
+		log.Fatal(err)
+	}
+	manager.Init(manager.NewStore(config.Database.Driver, conn))
+	webhook.Init(config)
+
+	masterToSlave := newMessageChan(config, "master_to_slave")
+	slaveToMaster := newMessageChan(config, "slave_to_master")
+
+	slave := slave.NewLimbService(config, masterToSlave.Out(), slaveToMaster.In())
 	master := master.NewMasterService(config, slaveToMaster.Out(), masterToSlave.In())
+	master.SetForwardSupport(slave.SupportsForward)
+	slave.SetCallbackRestorer(master.RestoreCallback)
 	master.Start()
-	slave := slave.NewLimbService(config, masterToSlave.Out(), slaveToMaster.In())
+	slave.AddHealthChecks(master.HealthChecks()...)
+	slave.Handle("/api/", master.APIHandler())
 	slave.Start()
 
+	go restoreUndelivered(slaveToMaster.In())
+
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := <-c; sig == syscall.SIGHUP; sig = <-c {
+		config = reloadConfig(config, master)
+	}
 
 	fmt.Printf("\n")
 
-	slave.Stop()
-	master.Stop()
+	shutdown(config, master, slave, masterToSlave, slaveToMaster, conn)
+}
+
+// event channel bounded by memory budget of config, spilled to database if enabled
+func newMessageChan(config *common.Configure, name string) *common.MessageChan {
+	budget := int64(config.Service.EventBuffer.MemoryMB) << 20
+
+	var spill common.SpillQueue
+	if budget > 0 && config.Service.EventBuffer.Spill {
+		spill = manager.NewEventSpill(name)
+	}
+
+	ch := common.NewBoundedMessageChan(1024, budget, spill)
+	metrics.RegisterChanDepth(name, ch.Len)
+	metrics.RegisterChanBuffer(name, ch.Memory, ch.Spilled, ch.SpillTotal)
+
+	return ch
+}
+
+func setupLog(config *common.Configure) {
+	logLevel, err := log.ParseLevel(config.Log.Level)
+	if err == nil {
+		log.SetLevel(logLevel)
+	}
+	if config.Log.Format == common.LogFormatJSON {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{TimestampFormat: "2006-01-02 15:04:05", FullTimestamp: true})
+	}
+	common.SetRedaction(common.Redaction{MaskContent: config.Log.MaskContent, MaskIDs: config.Log.MaskIDs})
+}
+
+// apply safe changes of config file on SIGHUP, keep current config if invalid
+func reloadConfig(config *common.Configure, ms *master.MasterService) *common.Configure {
+	next, applied, restart, err := common.ReloadConfig(configPath, config)
+	if err != nil {
+		log.Warnf("Failed to reload config, keep current one: %v", err)
+		return config
+	}
+
+	setupLog(next)
+	ms.SetConfig(next)
+
+	if len(applied) > 0 {
+		log.Infof("Config reloaded, applied: %s", strings.Join(applied, ", "))
+	} else {
+		log.Infof("Config reloaded, nothing changed")
+	}
+	if len(restart) > 0 {
+		log.Warnf("Config changes need restart: %s", strings.Join(restart, ", "))
+	}
+
+	return next
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"flag"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/db"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// copy data between database backends, e.g. octopus migrate-db --from sqlite --to postgres
+func migrateDB(config *common.Configure, args []string) error {
+	flags := flag.NewFlagSet("migrate-db", flag.ExitOnError)
+	from := flags.String("from", db.DriverSQLite, "source database driver (sqlite or postgres)")
+	to := flags.String("to", db.DriverPostgres, "target database driver (sqlite or postgres)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == *to {
+		return errors.New("source and target database are the same")
+	}
+
+	src, err := db.Open(*from, databaseDSN(config, *from))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := db.Open(*to, databaseDSN(config, *to))
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	counts, err := db.Copy(src, *from, dst, *to)
+	for table, count := range counts {
+		log.Infof("Copied %d rows of table %s from %s to %s", count, table, *from, *to)
+	}
+	return err
+}
+
+func databaseDSN(config *common.Configure, driver string) string {
+	if driver == db.DriverPostgres {
+		return config.Database.DSN
+	}
+	return config.Database.Path
+}
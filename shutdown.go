@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"sync/atomic"
+	"time"
+
+	"github.com/duo/octopus/internal/common"
+	"github.com/duo/octopus/internal/manager"
+	"github.com/duo/octopus/internal/master"
+	"github.com/duo/octopus/internal/slave"
+	"github.com/duo/octopus/internal/webhook"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	drainPollInterval = 100 * time.Millisecond
+	restoreBatchSize  = 100
+)
+
+// persist events to queue, count what was kept and lost
+type eventSpill struct {
+	queue     string
+	persisted atomic.Int64
+	dropped   atomic.Int64
+}
+
+func (s *eventSpill) spill(event *common.OctopusEvent) {
+	payload, err := common.EncodeEvent(event)
+	if err == nil {
+		err = manager.PushEvent(s.queue, event.Vendor.String(), payload)
+	}
+	if err != nil {
+		common.EventLog(event).Warnf("Failed to persist undelivered event: %v", err)
+		s.dropped.Add(1)
+		return
+	}
+	s.persisted.Add(1)
+}
+
+// stop intake, drain both channels within drain timeout, persist the rest, then close database
+func shutdown(config *common.Configure, ms *master.MasterService, ls *slave.LimbService,
+	masterToSlave, slaveToMaster *common.MessageChan, conn *sql.DB) {
+	start := time.Now()
+	inSpill := &eventSpill{queue: manager.QueueShutdownIn}
+	outSpill := &eventSpill{queue: manager.QueueShutdownOut}
+
+	log.Infof("Shutting down, draining events for up to %v", config.Service.DrainTimeout)
+
+	// new limb events wait in queue for next start, Telegram updates not fetched yet are left on server
+	ms.StopUpdates()
+	ls.StopAccepting()
+	slaveToMaster.Seal(inSpill.spill)
+
+	inStart, outStart := slaveToMaster.Consumed(), masterToSlave.Consumed()
+
+	deadline := time.Now().Add(config.Service.DrainTimeout)
+	for time.Now().Before(deadline) {
+		if slaveToMaster.Len() == 0 && masterToSlave.Len() == 0 && ms.Pending() == 0 && ls.Pending() == 0 {
+			break
+		}
+		time.Sleep(drainPollInterval)
+	}
+
+	masterToSlave.Seal(outSpill.spill)
+	masterToSlave.Flush()
+	slaveToMaster.Flush()
+	inflight := ms.Pending() + ls.Pending()
+
+	ls.Stop()
+	ms.Stop()
+	webhook.Stop()
+
+	log.Infof("Shutdown in %v: drained %d limb and %d Telegram events, persisted %d limb and %d Telegram events, dropped %d, %d still in flight",
+		time.Since(start).Round(time.Millisecond),
+		slaveToMaster.Consumed()-inStart, masterToSlave.Consumed()-outStart,
+		inSpill.persisted.Load(), outSpill.persisted.Load(),
+		inSpill.dropped.Load()+outSpill.dropped.Load(), inflight)
+
+	if err := conn.Close(); err != nil {
+		log.Warnf("Failed to close database: %v", err)
+	}
+}
+
+// send limb events persisted on last shutdown to master, Telegram events are replayed when limb connects
+func restoreUndelivered(in chan<- *common.OctopusEvent) {
+	restored := 0
+	for {
+		queued, err := manager.GetQueuedEvents(manager.QueueShutdownIn, "", restoreBatchSize)
+		if err != nil {
+			log.Warnf("Failed to get undelivered events: %v", err)
+			return
+		}
+		if len(queued) == 0 {
+			break
+		}
+
+		// removed once handed to channel, a crash in between sends it again
+		for _, q := range queued {
+			if event, err := common.DecodeEvent(q.Payload); err != nil {
+				log.Warnf("Failed to decode undelivered event %d: %v", q.ID, err)
+			} else {
+				in <- event
+				restored++
+			}
+			if err := manager.DelQueuedEvent(q.ID); err != nil {
+				log.Warnf("Failed to delete undelivered event %d: %v", q.ID, err)
+				return
+			}
+		}
+	}
+
+	if restored > 0 {
+		log.Infof("Restored %d undelivered limb events", restored)
+	}
+}